@@ -0,0 +1,56 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+)
+
+// pattern is a smooth textured test image
+func pattern(x, y float64) float32 {
+	return float32(127.5 + 50*math.Sin(0.3*x+0.1*y) + 50*math.Cos(0.25*y-0.05*x))
+}
+
+// shiftedPair returns w x h images with dummy borders where the second one is
+// the first one moved by (dx, dy), i.e. the true flow is (dx, dy) everywhere
+func shiftedPair(w, h int, dx, dy float64) (f1, f2 *floatimage.FloatImg) {
+	f1 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	f2 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			f1.Set(x, y, 0, pattern(float64(x), float64(y)))
+			f2.Set(x, y, 0, pattern(float64(x)-dx, float64(y)-dy))
+		}
+	}
+	return f1.AddDummies(), f2.AddDummies()
+}
+
+// constantFlow returns a 2 channel flow field covering r with the vector
+// (u, v) everywhere
+func constantFlow(r image.Rectangle, u, v float32) *floatimage.FloatImg {
+	flow := floatimage.NewFloatImg(r, 2)
+	for i := 0; i < len(flow.Pix); i += 2 {
+		flow.Pix[i], flow.Pix[i+1] = u, v
+	}
+	return flow
+}
+
+// meanEPE is the mean endpoint error of flow against the constant flow
+// (u, v) over the interior r.Inset(border)
+func meanEPE(flow *floatimage.FloatImg, u, v float32, border int) float64 {
+	r := flow.Bounds().Inset(border)
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			du, dv := float64(vec[0]-u), float64(vec[1]-v)
+			sum += math.Sqrt(du*du + dv*dv)
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+// near reports whether a and b differ by at most eps
+func near(a, b, eps float64) bool {
+	return math.Abs(a-b) <= eps
+}
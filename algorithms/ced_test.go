@@ -0,0 +1,60 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"testing"
+)
+
+func TestCoherenceEnhancingDiffusion(t *testing.T) {
+	// a 2 pixel thick horizontal line of 200 on 0 with a 4 pixel gap at
+	// x = 22 to 25, channel 1 must be ignored
+	r := image.Rect(0, 0, 48, 32)
+	img := floatimage.NewFloatImg(r, 2)
+	for y := 15; y < 17; y++ {
+		for x := 4; x < 44; x++ {
+			if x < 22 || x >= 26 {
+				img.Set(x, y, 0, 200)
+			}
+		}
+	}
+	for i := 1; i < len(img.Pix); i += 2 {
+		img.Pix[i] = 1000
+	}
+
+	out := CoherenceEnhancingDiffusion(img, 50, 0.5, 4)
+	if out.Bounds() != r || out.Chancnt != 1 {
+		t.Fatalf("result bounds %v with %d channels", out.Bounds(), out.Chancnt)
+	}
+	tests := []struct {
+		name     string
+		x, y     int
+		min, max float32
+	}{
+		// the gap is filled along the line
+		{"gap", 23, 15, 100, 200},
+		{"gap lower row", 24, 16, 100, 200},
+		// the line itself stays bright and sharp across, nothing leaks
+		// above or below
+		{"line", 12, 15, 180, 200},
+		{"3 above the line", 12, 12, -1, 1},
+		{"3 below the line", 30, 19, -1, 1},
+		{"above the gap", 23, 11, -1, 1},
+		{"far away", 2, 2, -1, 1},
+	}
+	for _, tt := range tests {
+		if v := out.AtF(tt.x, tt.y)[0]; v < tt.min || v > tt.max {
+			t.Errorf("%s: %f at %d, %d, want %f to %f", tt.name, v, tt.x, tt.y, tt.min, tt.max)
+		}
+	}
+
+	// no iterations return channel 0 unchanged
+	same := CoherenceEnhancingDiffusion(img, 0, 0.5, 4)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if got, want := same.AtF(x, y)[0], img.AtF(x, y)[0]; got != want {
+				t.Fatalf("no iterations: %f at %d, %d, want %f", got, x, y, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+)
+
+// ConsistencyMask checks the forward flow (f1 to f2) against the backward flow
+// (f2 to f1). Following the forward vector and then the backward vector found
+// there should lead back to the start, the result is a single channel mask
+// that is 1 where the distance to the start is at most threshold and 0 otherwise
+// (e.g. at occlusions or flow errors)
+func ConsistencyMask(forward, backward *floatimage.FloatImg, threshold float32) *floatimage.FloatImg {
+	bounds := forward.Bounds()
+	mask := floatimage.NewFloatImg(bounds, 1)
+	back := make([]float32, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			fw := forward.AtF(x, y)
+			backward.AtBilinear(float32(x)+fw[0], float32(y)+fw[1], back)
+			du, dv := fw[0]+back[0], fw[1]+back[1]
+			if du*du+dv*dv <= threshold*threshold {
+				mask.Set(x, y, 0, 1)
+			}
+		}
+	}
+	return mask
+}
+
+// ApplyConfidenceOverlay dims the flow color image flowColor by multiplying
+// all its channels with the single channel confidence (clamped to 0 <= c <= 1)
+// at each pixel, full confidence leaves the color unchanged
+func ApplyConfidenceOverlay(flowColor, confidence *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := flowColor.Bounds()
+	overlay := floatimage.NewFloatImg(bounds, flowColor.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := confidence.AtF(x, y)[0]
+			switch {
+			case c < 0:
+				c = 0
+			case c > 1:
+				c = 1
+			}
+			in := flowColor.AtF(x, y)
+			out := overlay.AtF(x, y)
+			for i := range out {
+				out[i] = in[i] * c
+			}
+		}
+	}
+	return overlay
+}
+
+// OcclusionFraction returns the fraction of interior pixels (excluding the
+// dummy borders) where the single channel mask, e.g. from ConsistencyMask, is 0
+func OcclusionFraction(mask *floatimage.FloatImg) float32 {
+	bounds := mask.Bounds()
+	var occluded, total int
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			if mask.AtF(x, y)[0] == 0 {
+				occluded++
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float32(occluded) / float32(total)
+}
@@ -0,0 +1,74 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"testing"
+)
+
+func TestApplyConfidenceOverlay(t *testing.T) {
+	color := []float32{200, 100, 50}
+	tests := []struct {
+		confidence float32
+		want       []float32
+	}{
+		{0, []float32{0, 0, 0}},
+		{-0.5, []float32{0, 0, 0}},
+		{0.5, []float32{100, 50, 25}},
+		{1, color},
+		{1.5, color},
+	}
+	r := image.Rect(0, 0, len(tests), 1)
+	flowColor := floatimage.NewFloatImg(r, 3)
+	confidence := floatimage.NewFloatImg(r, 1)
+	for x, tt := range tests {
+		copy(flowColor.AtF(x, 0), color)
+		confidence.Set(x, 0, 0, tt.confidence)
+	}
+	overlay := ApplyConfidenceOverlay(flowColor, confidence)
+	for x, tt := range tests {
+		got := overlay.AtF(x, 0)
+		for c := range got {
+			if got[c] != tt.want[c] {
+				t.Errorf("confidence %.1f: got %v, want %v", tt.confidence, got, tt.want)
+				break
+			}
+		}
+	}
+	if got := flowColor.AtF(0, 0)[0]; got != color[0] {
+		t.Errorf("flow color changed to %f", got)
+	}
+}
+
+func TestOcclusionFraction(t *testing.T) {
+	// the interior of a 12 x 7 mask is 10 x 5 = 50 pixels, the dummy border
+	// is always 0 and must not count
+	tests := []struct {
+		zeros int
+		want  float32
+	}{
+		{0, 0},
+		{1, 0.02},
+		{10, 0.2},
+		{25, 0.5},
+		{50, 1},
+	}
+	for _, tt := range tests {
+		mask := floatimage.NewFloatImg(image.Rect(0, 0, 12, 7), 1)
+		n := 0
+		for y := 1; y < 6; y++ {
+			for x := 1; x < 11; x++ {
+				if n >= tt.zeros {
+					mask.Set(x, y, 0, 1)
+				}
+				n++
+			}
+		}
+		if got := OcclusionFraction(mask); got != tt.want {
+			t.Errorf("%d zeros: fraction %f, want %f", tt.zeros, got, tt.want)
+		}
+	}
+	if got := OcclusionFraction(floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), 1)); got != 0 {
+		t.Errorf("empty interior: fraction %f, want 0", got)
+	}
+}
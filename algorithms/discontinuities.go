@@ -0,0 +1,25 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+)
+
+// FlowDiscontinuities returns a single channel image that is 1 where the
+// gradient magnitude of the 2 channel flow, sqrt(|∇u|² + |∇v|²), exceeds
+// threshold and 0 elsewhere
+func FlowDiscontinuities(flow *floatimage.FloatImg, threshold float32) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	gradU := flow.ChannelGradient(0)
+	gradV := flow.ChannelGradient(1)
+	edges := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gu, gv := gradU.AtF(x, y), gradV.AtF(x, y)
+			mag2 := gu[0]*gu[0] + gu[1]*gu[1] + gv[0]*gv[0] + gv[1]*gv[1]
+			if mag2 > threshold*threshold {
+				edges.Set(x, y, 0, 1)
+			}
+		}
+	}
+	return edges
+}
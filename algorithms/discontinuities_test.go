@@ -0,0 +1,67 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"testing"
+)
+
+func TestFlowDiscontinuities(t *testing.T) {
+	r := image.Rect(0, 0, 20, 16)
+	tests := []struct {
+		name    string
+		flow    func(x, y int) (u, v float32)
+		flagged func(x, y int) bool
+	}{
+		// the central differences at x = 9 and 10 are 3/2
+		{"vertical boundary in u",
+			func(x, y int) (float32, float32) {
+				if x < 10 {
+					return 3, 0
+				}
+				return 0, 0
+			},
+			func(x, y int) bool { return x == 9 || x == 10 }},
+		{"horizontal boundary in v",
+			func(x, y int) (float32, float32) {
+				if y < 6 {
+					return 1, -2
+				}
+				return 1, 2
+			},
+			func(x, y int) bool { return y == 5 || y == 6 }},
+		{"smooth rotation",
+			func(x, y int) (float32, float32) { return -0.1 * float32(y), 0.1 * float32(x) },
+			func(x, y int) bool { return false }},
+		{"small step",
+			func(x, y int) (float32, float32) {
+				if x < 10 {
+					return 1.5, 0
+				}
+				return 0, 0
+			},
+			func(x, y int) bool { return false }},
+	}
+	for _, tt := range tests {
+		flow := floatimage.NewFloatImg(r, 2)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				u, v := tt.flow(x, y)
+				flow.Set(x, y, 0, u)
+				flow.Set(x, y, 1, v)
+			}
+		}
+		edges := FlowDiscontinuities(flow, 1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				want := float32(0)
+				if tt.flagged(x, y) {
+					want = 1
+				}
+				if got := edges.AtF(x, y)[0]; got != want {
+					t.Errorf("%s: %f at %d, %d, want %f", tt.name, got, x, y, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+)
+
+// EnergyMap returns a single channel image holding the density of the Horn &
+// Schunk energy the solver minimizes,
+//
+//	(fx*u + fy*v + fz)² + alpha*(|∇u|² + |∇v|²)
+//
+// at each interior pixel, using central differences for the image derivatives
+// and forward differences for the flow gradient. Large values show where the
+// brightness constancy or smoothness assumptions are violated, e.g. at
+// occlusions or fast motion. The images need to have dummy borders
+func EnergyMap(f1, f2, flow *floatimage.FloatImg, alpha float32) *floatimage.FloatImg {
+	return EnergyMapOptions(f1, f2, flow, &HornSchunkOptions{Alpha: alpha})
+}
+
+// EnergyMapOptions is like EnergyMap but takes alpha and the derivative
+// kernel from opts so the energy matches the one the solver minimized with
+// the same options, the other options are ignored
+func EnergyMapOptions(f1, f2, flow *floatimage.FloatImg, opts *HornSchunkOptions) *floatimage.FloatImg {
+	bounds := f1.Bounds()
+	alpha := opts.Alpha
+	derivs := deriveMixed(f1, f2, &HornSchunkOptions{Deriv: opts.Deriv}, floatimage.NewFloatImg(bounds, 3))
+	energy := floatimage.NewFloatImg(bounds, 1)
+	for j := bounds.Min.Y + 1; j < bounds.Max.Y-1; j++ {
+		for i := bounds.Min.X + 1; i < bounds.Max.X-1; i++ {
+			dvs := derivs.AtF(i, j)
+			uv := flow.AtF(i, j)
+			data := dvs[Fxc]*uv[0] + dvs[Fyc]*uv[1] + dvs[Fzc]
+			right, down := flow.AtF(i+1, j), flow.AtF(i, j+1)
+			var smooth float32
+			for c := 0; c < 2; c++ {
+				dx, dy := right[c]-uv[c], down[c]-uv[c]
+				smooth += dx*dx + dy*dy
+			}
+			energy.Set(i, j, 0, data*data+alpha*smooth)
+		}
+	}
+	return energy
+}
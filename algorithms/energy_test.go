@@ -0,0 +1,50 @@
+package algorithms
+
+import (
+	"image"
+	"testing"
+)
+
+func TestEnergyMapViolation(t *testing.T) {
+	f1, f2 := shiftedPair(40, 40, 1, 0)
+	// a bright spot only in the second frame violates brightness constancy
+	spot := image.Rect(20, 20, 23, 23)
+	for y := spot.Min.Y; y < spot.Max.Y; y++ {
+		for x := spot.Min.X; x < spot.Max.X; x++ {
+			f2.Set(x, y, 0, f2.AtF(x, y)[0]+100)
+		}
+	}
+	energy := EnergyMap(f1, f2, constantFlow(f1.Bounds(), 1, 0), 100)
+	inside := energy.AtF(21, 21)[0]
+	outside := energy.AtF(8, 8)[0]
+	if inside < 100*outside || inside < 1000 {
+		t.Errorf("energy inside the violation %f, outside %f", inside, outside)
+	}
+}
+
+func TestEnergyMapOptionsDeriv(t *testing.T) {
+	f1, f2 := shiftedPair(30, 30, 0.5, 0.5)
+	flow := constantFlow(f1.Bounds(), 0.3, 0.2)
+	central := EnergyMap(f1, f2, flow, 50)
+	tests := []struct {
+		deriv DerivMode
+		same  bool
+	}{
+		{DerivCentral, true},
+		{DerivSobel, false},
+		{DerivScharr, false},
+	}
+	for _, tc := range tests {
+		energy := EnergyMapOptions(f1, f2, flow, &HornSchunkOptions{Alpha: 50, Deriv: tc.deriv})
+		same := true
+		for i := range energy.Pix {
+			if energy.Pix[i] != central.Pix[i] {
+				same = false
+				break
+			}
+		}
+		if same != tc.same {
+			t.Errorf("deriv %d: same as central %v, want %v", tc.deriv, same, tc.same)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package algorithms
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// nextPow2 returns the smallest power of two >= n
+func nextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// fft computes the in place discrete Fourier transform of a whose length
+// needs to be a power of two using the iterative radix-2 Cooley-Tukey scheme.
+// The inverse transform includes the 1/n normalization
+func fft(a []complex128, inverse bool) {
+	n := len(a)
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := a[start+k]
+				v := a[start+k+size/2] * wk
+				a[start+k] = u + v
+				a[start+k+size/2] = u - v
+				wk *= w
+			}
+		}
+	}
+
+	if inverse {
+		scale := complex(1/float64(n), 0)
+		for i := range a {
+			a[i] *= scale
+		}
+	}
+}
+
+// fft2D computes the in place 2D transform of the row major w x h data,
+// both w and h need to be powers of two
+func fft2D(data []complex128, w, h int, inverse bool) {
+	for y := 0; y < h; y++ {
+		fft(data[y*w:(y+1)*w], inverse)
+	}
+	col := make([]complex128, h)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			col[y] = data[y*w+x]
+		}
+		fft(col, inverse)
+		for y := 0; y < h; y++ {
+			data[y*w+x] = col[y]
+		}
+	}
+}
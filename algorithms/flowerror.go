@@ -0,0 +1,49 @@
+package algorithms
+
+import (
+	"fmt"
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+)
+
+// FlowError returns the average endpoint error, i.e. the mean Euclidean
+// distance between the vectors of the 2 channel flow fields computed and
+// truth, pixels are compared relative to the origin of each field
+func FlowError(computed, truth *floatimage.FloatImg) (float32, error) {
+	return FlowErrorMasked(computed, truth, nil)
+}
+
+// FlowErrorMasked is like FlowError but skips pixels where channel 0 of mask
+// is 0, e.g. occlusions, and averages over the remaining ones. The mask needs
+// the size of the flow fields, a nil mask uses all pixels. Without valid
+// pixels the error is 0
+func FlowErrorMasked(computed, truth, mask *floatimage.FloatImg) (float32, error) {
+	boundsC, boundsT := computed.Bounds(), truth.Bounds()
+	if boundsC.Size() != boundsT.Size() {
+		return 0, fmt.Errorf("flow sizes %v and %v don't match", boundsC.Size(), boundsT.Size())
+	}
+	if computed.Chancnt != 2 || truth.Chancnt != 2 {
+		return 0, fmt.Errorf("flow fields need 2 channels, got %d and %d", computed.Chancnt, truth.Chancnt)
+	}
+	if mask != nil && mask.Bounds().Size() != boundsC.Size() {
+		return 0, fmt.Errorf("mask size %v doesn't match flow size %v", mask.Bounds().Size(), boundsC.Size())
+	}
+	var sum float64
+	var count int
+	for y := 0; y < boundsC.Dy(); y++ {
+		for x := 0; x < boundsC.Dx(); x++ {
+			if mask != nil && mask.AtF(mask.Bounds().Min.X+x, mask.Bounds().Min.Y+y)[0] == 0 {
+				continue
+			}
+			c := computed.AtF(boundsC.Min.X+x, boundsC.Min.Y+y)
+			t := truth.AtF(boundsT.Min.X+x, boundsT.Min.Y+y)
+			du, dv := float64(c[0]-t[0]), float64(c[1]-t[1])
+			sum += math.Sqrt(du*du + dv*dv)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return float32(sum / float64(count)), nil
+}
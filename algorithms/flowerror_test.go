@@ -0,0 +1,68 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestFlowErrorMasked(t *testing.T) {
+	r := image.Rect(0, 0, 8, 4)
+	truth := constantFlow(r, 1, -1)
+	// the computed flow is off by (3, 4) in the 2 x 2 occluded square and
+	// by (0.3, 0.4) elsewhere, it and the mask lie at other origins
+	occluded := image.Rect(5, 1, 7, 3)
+	computed := constantFlow(r.Add(image.Point{-2, 5}), 1.3, -0.6)
+	mask := filled(r.Add(image.Point{4, 4}), 1)
+	for y := occluded.Min.Y; y < occluded.Max.Y; y++ {
+		for x := occluded.Min.X; x < occluded.Max.X; x++ {
+			vec := computed.AtF(x-2, y+5)
+			vec[0], vec[1] = 4, 3
+			mask.Set(x+4, y+4, 0, 0)
+		}
+	}
+	unmasked := float32(28*0.5+4*5) / 32
+	tests := []struct {
+		name string
+		mask *floatimage.FloatImg
+		want float32
+	}{
+		{"no mask", nil, unmasked},
+		{"occlusions masked", mask, 0.5},
+		{"nothing masked", filled(r, 2), unmasked},
+		{"all masked", filled(r, 0), 0},
+	}
+	for _, tt := range tests {
+		got, err := FlowErrorMasked(computed, truth, tt.mask)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(float64(got-tt.want)) > 1e-5 {
+			t.Errorf("%s: EPE %f, want %f", tt.name, got, tt.want)
+		}
+	}
+	if got, err := FlowError(computed, truth); err != nil || math.Abs(float64(got-unmasked)) > 1e-5 {
+		t.Errorf("FlowError = %f, %v, want %f", got, err, unmasked)
+	}
+}
+
+func TestFlowErrorMaskedInvalid(t *testing.T) {
+	r := image.Rect(0, 0, 8, 4)
+	flow := constantFlow(r, 1, 0)
+	tests := []struct {
+		name            string
+		computed, truth *floatimage.FloatImg
+		mask            *floatimage.FloatImg
+	}{
+		{"size mismatch", flow, constantFlow(image.Rect(0, 0, 8, 5), 1, 0), nil},
+		{"3 channels", flow, floatimage.NewFloatImg(r, 3), nil},
+		{"mask size mismatch", flow, flow, filled(image.Rect(0, 0, 7, 4), 1)},
+	}
+	for _, tt := range tests {
+		if _, err := FlowErrorMasked(tt.computed, tt.truth, tt.mask); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package algorithms
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"io"
+	"strconv"
+)
+
+// floMagic is the tag at the start of Middlebury .flo files
+const floMagic float32 = 202021.25
+
+// WriteFlowCSV writes every step-th vector of the 2 channel flow field as CSV
+// with the header x,y,u,v (see floatimage.FloatImg.SampleGrid)
+func WriteFlowCSV(w io.Writer, flow *floatimage.FloatImg, step int) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"x", "y", "u", "v"}); err != nil {
+		return fmt.Errorf("writing csv header: %v", err)
+	}
+	for _, s := range flow.SampleGrid(step) {
+		record := []string{
+			strconv.Itoa(s.X),
+			strconv.Itoa(s.Y),
+			strconv.FormatFloat(float64(s.U), 'g', -1, 32),
+			strconv.FormatFloat(float64(s.V), 'g', -1, 32),
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("writing csv records: %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("flushing csv: %v", err)
+	}
+	return nil
+}
+
+// WriteFlo writes the 2 channel flow field in the Middlebury .flo format,
+// little endian tag, width, height followed by the u, v pairs row by row
+func WriteFlo(w io.Writer, flow *floatimage.FloatImg) error {
+	if flow.Chancnt != 2 {
+		return fmt.Errorf("flo needs a 2 channel flow, got %d channels", flow.Chancnt)
+	}
+	bounds := flow.Bounds()
+	header := []interface{}{floMagic, int32(bounds.Dx()), int32(bounds.Dy())}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("writing flo header: %v", err)
+		}
+	}
+	row := make([]float32, 2*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		copy(row, flow.Pix[flow.PixOffset(bounds.Min.X, y):flow.PixOffset(bounds.Max.X, y)])
+		if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+			return fmt.Errorf("writing flo row %d: %v", y-bounds.Min.Y, err)
+		}
+	}
+	return nil
+}
+
+// ReadFlo reads a flow field in the Middlebury .flo format and returns it as
+// 2 channel image with its Rect starting at (0, 0)
+func ReadFlo(r io.Reader) (*floatimage.FloatImg, error) {
+	var magic float32
+	var width, height int32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != floMagic {
+		return nil, fmt.Errorf("not a flo file, bad tag %v", magic)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &width); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &height); err != nil {
+		return nil, err
+	}
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("invalid flo size %dx%d", width, height)
+	}
+	flow := floatimage.NewFloatImg(image.Rect(0, 0, int(width), int(height)), 2)
+	if err := binary.Read(r, binary.LittleEndian, flow.Pix); err != nil {
+		return nil, err
+	}
+	return flow, nil
+}
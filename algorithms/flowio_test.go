@@ -0,0 +1,152 @@
+package algorithms
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fractionalFlow returns a 2 channel flow field covering r with non trivial
+// fractional vectors
+func fractionalFlow(r image.Rectangle) *floatimage.FloatImg {
+	flow := floatimage.NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			flow.Set(x, y, 0, float32(x)/3-0.1)
+			flow.Set(x, y, 1, -float32(y*y)/7+1e-4)
+		}
+	}
+	return flow
+}
+
+func TestWriteFlowCSV(t *testing.T) {
+	flow := fractionalFlow(image.Rect(1, -2, 8, 4))
+	tests := []struct {
+		step, rows int
+	}{
+		{1, 7 * 6},
+		{2, 4 * 3},
+		{5, 2 * 2},
+		{10, 1},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteFlowCSV(&buf, flow, tt.step); err != nil {
+			t.Fatalf("step %d: %v", tt.step, err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("step %d: parsing csv: %v", tt.step, err)
+		}
+		if len(records) != tt.rows+1 {
+			t.Errorf("step %d: %d records, want header and %d rows", tt.step, len(records), tt.rows)
+			continue
+		}
+		if h := records[0]; len(h) != 4 || h[0] != "x" || h[1] != "y" || h[2] != "u" || h[3] != "v" {
+			t.Errorf("step %d: header %v", tt.step, h)
+		}
+		for _, rec := range records[1:] {
+			x, errX := strconv.Atoi(rec[0])
+			y, errY := strconv.Atoi(rec[1])
+			u, errU := strconv.ParseFloat(rec[2], 32)
+			v, errV := strconv.ParseFloat(rec[3], 32)
+			if errX != nil || errY != nil || errU != nil || errV != nil {
+				t.Errorf("step %d: bad record %v", tt.step, rec)
+				continue
+			}
+			if (x-1)%tt.step != 0 || (y+2)%tt.step != 0 {
+				t.Errorf("step %d: unexpected position %d, %d", tt.step, x, y)
+			}
+			if vec := flow.AtF(x, y); float32(u) != vec[0] || float32(v) != vec[1] {
+				t.Errorf("step %d: at %d, %d read (%v, %v), want %v", tt.step, x, y, u, v, vec)
+			}
+		}
+	}
+}
+
+// errWriteFailed is returned by limitWriter once its limit is used up
+var errWriteFailed = errors.New("write failed")
+
+// limitWriter accepts n bytes and then fails with errWriteFailed, writing the
+// part of the last buffer that still fits
+type limitWriter struct {
+	n int
+}
+
+func (p *limitWriter) Write(b []byte) (int, error) {
+	if len(b) <= p.n {
+		p.n -= len(b)
+		return len(b), nil
+	}
+	written := p.n
+	p.n = 0
+	return written, errWriteFailed
+}
+
+func TestWriteFloFailing(t *testing.T) {
+	// 12 header bytes followed by 2 rows of 3 vectors of 8 bytes each
+	flow := fractionalFlow(image.Rect(2, 1, 5, 3))
+	tests := []struct {
+		limit int
+		stage string
+	}{
+		{0, "header"},
+		{11, "header"},
+		{12, "row 0"},
+		{35, "row 0"},
+		{36, "row 1"},
+		{59, "row 1"},
+		{60, ""},
+	}
+	for _, tt := range tests {
+		err := WriteFlo(&limitWriter{tt.limit}, flow)
+		checkWriteError(t, "flo", tt.limit, err, tt.stage)
+	}
+}
+
+func TestWriteFlowCSVFailing(t *testing.T) {
+	// the small field fits into the buffer of the csv writer and only fails
+	// when flushing, the large one already while writing the records
+	small := fractionalFlow(image.Rect(0, 0, 3, 2))
+	large := fractionalFlow(image.Rect(0, 0, 40, 40))
+	tests := []struct {
+		name  string
+		flow  *floatimage.FloatImg
+		limit int
+		stage string
+	}{
+		{"small", small, 0, "flushing csv"},
+		{"small", small, 20, "flushing csv"},
+		{"small", small, 10000, ""},
+		{"large", large, 0, "writing csv records"},
+		{"large", large, 5000, "writing csv records"},
+		{"large", large, 1000000, ""},
+	}
+	for _, tt := range tests {
+		err := WriteFlowCSV(&limitWriter{tt.limit}, tt.flow, 1)
+		checkWriteError(t, tt.name+" csv", tt.limit, err, tt.stage)
+	}
+}
+
+// checkWriteError reports unless err names the failed stage and the cause,
+// or is nil if stage is empty
+func checkWriteError(t *testing.T, name string, limit int, err error, stage string) {
+	if stage == "" {
+		if err != nil {
+			t.Errorf("%s, limit %d: %v", name, limit, err)
+		}
+		return
+	}
+	if err == nil {
+		t.Errorf("%s, limit %d: no error", name, limit)
+		return
+	}
+	if !strings.Contains(err.Error(), stage) || !strings.Contains(err.Error(), errWriteFailed.Error()) {
+		t.Errorf("%s, limit %d: error %q doesn't mention %q and the cause", name, limit, err, stage)
+	}
+}
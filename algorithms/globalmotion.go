@@ -0,0 +1,287 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+)
+
+// MeanFlow returns the average vector of the 2 channel flow field over the
+// interior (excluding the dummy borders), e.g. the global camera motion
+func MeanFlow(flow *floatimage.FloatImg) (u, v float32) {
+	interior := flow.Bounds().Inset(1)
+	n := float32(interior.Dx() * interior.Dy())
+	if n == 0 {
+		return 0, 0
+	}
+	sum := flow.Sum()
+	return sum[0] / n, sum[1] / n
+}
+
+// SubtractMeanFlow returns a copy of the flow field with MeanFlow removed from
+// every vector so only the motion relative to the global motion remains
+func SubtractMeanFlow(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	u, v := MeanFlow(flow)
+	residual := flow.Clone()
+	bounds := residual.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := residual.AtF(x, y)
+			vec[0] -= u
+			vec[1] -= v
+		}
+	}
+	return residual
+}
+
+// affineFit accumulates the normal equations of the least squares fit
+//
+//	u = a[0] + a[1]*x + a[2]*y
+//	v = a[3] + a[4]*x + a[5]*y
+type affineFit struct {
+	ata      [3][3]float64
+	atu, atv [3]float64
+	n        int
+}
+
+// add adds the vector u, v at x, y to the fit
+func (p *affineFit) add(x, y int, u, v float32) {
+	row := [3]float64{1, float64(x), float64(y)}
+	for i := range row {
+		for j := range row {
+			p.ata[i][j] += row[i] * row[j]
+		}
+		p.atu[i] += row[i] * float64(u)
+		p.atv[i] += row[i] * float64(v)
+	}
+	p.n++
+}
+
+// solve returns the affine parameters, ok is false if the points are
+// collinear
+func (p *affineFit) solve() (params [6]float32, ok bool) {
+	m := p.ata
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if p.n < 3 || math.Abs(det) < 1e-9 {
+		return params, false
+	}
+	// Cramer's rule for both right hand sides
+	for k, rhs := range [2][3]float64{p.atu, p.atv} {
+		for i := 0; i < 3; i++ {
+			mi := m
+			for r := 0; r < 3; r++ {
+				mi[r][i] = rhs[r]
+			}
+			deti := mi[0][0]*(mi[1][1]*mi[2][2]-mi[1][2]*mi[2][1]) -
+				mi[0][1]*(mi[1][0]*mi[2][2]-mi[1][2]*mi[2][0]) +
+				mi[0][2]*(mi[1][0]*mi[2][1]-mi[1][1]*mi[2][0])
+			params[3*k+i] = float32(deti / det)
+		}
+	}
+	return params, true
+}
+
+// affineResidual is the distance between the flow vector vec at x, y and the
+// affine motion params
+func affineResidual(params [6]float32, x, y int, vec []float32) float32 {
+	fx, fy := float32(x), float32(y)
+	du := params[0] + params[1]*fx + params[2]*fy - vec[0]
+	dv := params[3] + params[4]*fx + params[5]*fy - vec[1]
+	return float32(math.Sqrt(float64(du*du + dv*dv)))
+}
+
+// FitAffineFlow fits the affine motion
+//
+//	u = a[0] + a[1]*x + a[2]*y
+//	v = a[3] + a[4]*x + a[5]*y
+//
+// to the interior of the 2 channel flow field by least squares, x and y are
+// image coordinates. A degenerate field gives all zero parameters
+func FitAffineFlow(flow *floatimage.FloatImg) [6]float32 {
+	var fit affineFit
+	interior := flow.Bounds().Inset(1)
+	for y := interior.Min.Y; y < interior.Max.Y; y++ {
+		for x := interior.Min.X; x < interior.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			fit.add(x, y, vec[0], vec[1])
+		}
+	}
+	params, _ := fit.solve()
+	return params
+}
+
+// FitAffineFlowRobust is FitAffineFlow with RANSAC outlier rejection. In each
+// of iters rounds the affine motion through 3 random interior pixels is
+// computed and the pixels whose vector is within inlierThresh of it vote for
+// it, the model is then refit on the consensus set of the best voted one.
+// The flow of textureless pixels is only filled in by the smoothness term of
+// the solver, so with the images f1 and f2 the flow was computed from (with
+// dummy borders, covering the flow bounds) each vote weighs 1 + fx² + fy² of
+// their mixed derivatives. f1 and f2 may be nil to weigh all votes equally.
+// The inlier mask is indexed (y-Min.Y)*Dx + x-Min.X over the flow bounds, the
+// dummy border is never an inlier. The random sequence is fixed so the
+// result is reproducible
+func FitAffineFlowRobust(f1, f2, flow *floatimage.FloatImg, inlierThresh float32, iters int) (params [6]float32, inliers []bool) {
+	bounds := flow.Bounds()
+	interior := bounds.Inset(1)
+	inliers = make([]bool, bounds.Dx()*bounds.Dy())
+	if interior.Empty() {
+		return
+	}
+	weight := func(x, y int) float32 { return 1 }
+	if f1 != nil && f2 != nil {
+		derivs := deriveMixed(f1, f2, &HornSchunkOptions{}, floatimage.NewFloatImg(bounds, 3))
+		weight = func(x, y int) float32 {
+			dvs := derivs.AtF(x, y)
+			return 1 + dvs[Fxc]*dvs[Fxc] + dvs[Fyc]*dvs[Fyc]
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	best, bestScore := params, float32(-1)
+	for i := 0; i < iters; i++ {
+		var sample affineFit
+		for k := 0; k < 3; k++ {
+			x := interior.Min.X + rng.Intn(interior.Dx())
+			y := interior.Min.Y + rng.Intn(interior.Dy())
+			vec := flow.AtF(x, y)
+			sample.add(x, y, vec[0], vec[1])
+		}
+		model, ok := sample.solve()
+		if !ok {
+			continue
+		}
+		var score float32
+		for y := interior.Min.Y; y < interior.Max.Y; y++ {
+			for x := interior.Min.X; x < interior.Max.X; x++ {
+				if affineResidual(model, x, y, flow.AtF(x, y)) <= inlierThresh {
+					score += weight(x, y)
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = model, score
+		}
+	}
+	if bestScore < 0 {
+		return FitAffineFlow(flow), inliers
+	}
+
+	var fit affineFit
+	for y := interior.Min.Y; y < interior.Max.Y; y++ {
+		for x := interior.Min.X; x < interior.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			if affineResidual(best, x, y, vec) <= inlierThresh {
+				inliers[(y-bounds.Min.Y)*bounds.Dx()+x-bounds.Min.X] = true
+				fit.add(x, y, vec[0], vec[1])
+			}
+		}
+	}
+	params, ok := fit.solve()
+	if !ok {
+		params = best
+	}
+	return
+}
+
+// RegionMeanFlow returns the mean vector (u, v) of the 2 channel flow field
+// within each of the regions, which may overlap and are clipped to the flow
+// bounds. Regions without pixels inside the field get a zero vector
+func RegionMeanFlow(flow *floatimage.FloatImg, regions []image.Rectangle) [][2]float32 {
+	means := make([][2]float32, len(regions))
+	for i, region := range regions {
+		r := region.Intersect(flow.Bounds())
+		if r.Empty() {
+			continue
+		}
+		var u, v float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				vec := flow.AtF(x, y)
+				u += float64(vec[0])
+				v += float64(vec[1])
+			}
+		}
+		n := float64(r.Dx() * r.Dy())
+		means[i] = [2]float32{float32(u / n), float32(v / n)}
+	}
+	return means
+}
+
+// FocusOfExpansion estimates the point fx, fy the flow radiates from (or
+// converges to) as the least squares intersection of the lines through each
+// interior pixel along its flow vector, longer vectors get more weight. The
+// residual is the root mean square distance of these lines to the point in
+// pixels, it is small for radial fields. If the vectors are all parallel or
+// zero there is no intersection and the residual is +Inf
+func FocusOfExpansion(flow *floatimage.FloatImg) (fx, fy float32, residual float32) {
+	interior := flow.Bounds().Inset(1)
+	// normal equations of n·q = n·p with the line normal n = (-v, u)
+	var a11, a12, a22, b1, b2 float64
+	for y := interior.Min.Y; y < interior.Max.Y; y++ {
+		for x := interior.Min.X; x < interior.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			nx, ny := -float64(vec[1]), float64(vec[0])
+			d := nx*float64(x) + ny*float64(y)
+			a11 += nx * nx
+			a12 += nx * ny
+			a22 += ny * ny
+			b1 += nx * d
+			b2 += ny * d
+		}
+	}
+	det := a11*a22 - a12*a12
+	if det <= 1e-9*(a11+a22)*(a11+a22) {
+		return 0, 0, float32(math.Inf(1))
+	}
+	qx := (a22*b1 - a12*b2) / det
+	qy := (a11*b2 - a12*b1) / det
+
+	var sum float64
+	var n int
+	for y := interior.Min.Y; y < interior.Max.Y; y++ {
+		for x := interior.Min.X; x < interior.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			mag := math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1]))
+			if mag == 0 {
+				continue
+			}
+			dist := (-float64(vec[1])*(qx-float64(x)) + float64(vec[0])*(qy-float64(y))) / mag
+			sum += dist * dist
+			n++
+		}
+	}
+	return float32(qx), float32(qy), float32(math.Sqrt(sum / float64(n)))
+}
+
+// TimeToContact returns a single channel map of the time to contact in frames
+// for an observer moving towards the scene. Relative to the FocusOfExpansion
+// q a pixel p with flow f approaches in
+//
+//	|p - q|² / ((p - q) · f)
+//
+// frames, for a pure expansion (p - q)/τ this is τ. Faster expanding (closer)
+// regions thus get shorter times. Pixels moving towards the focus or without
+// motion and fields without a focus of expansion give 0
+func TimeToContact(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	ttc := floatimage.NewFloatImg(bounds, 1)
+	qx, qy, residual := FocusOfExpansion(flow)
+	if math.IsInf(float64(residual), 1) {
+		return ttc
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			dx, dy := float32(x)-qx, float32(y)-qy
+			radial := dx*vec[0] + dy*vec[1]
+			if radial <= 0 {
+				continue
+			}
+			ttc.Set(x, y, 0, (dx*dx+dy*dy)/radial)
+		}
+	}
+	return ttc
+}
@@ -0,0 +1,306 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// affineField returns a 2 channel field covering r with the affine motion
+// params and the vector (ou, ov) inside of outlier
+func affineField(r image.Rectangle, params [6]float32, outlier image.Rectangle, ou, ov float32) *floatimage.FloatImg {
+	flow := floatimage.NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			if (image.Point{x, y}).In(outlier) {
+				vec[0], vec[1] = ou, ov
+				continue
+			}
+			fx, fy := float32(x), float32(y)
+			vec[0] = params[0] + params[1]*fx + params[2]*fy
+			vec[1] = params[3] + params[4]*fx + params[5]*fy
+		}
+	}
+	return flow
+}
+
+func TestFitAffineFlowRobust(t *testing.T) {
+	truth := [6]float32{0.5, 0.01, -0.02, -0.3, 0.02, 0.01}
+	outlier := image.Rect(5, 5, 17, 17)
+	f1, f2 := shiftedPair(40, 40, 0.5, -0.3)
+	bounds := f1.Bounds()
+	flow := affineField(bounds, truth, outlier, 5, -4)
+
+	plain := FitAffineFlow(flow)
+	if near(float64(plain[0]), float64(truth[0]), 0.1) {
+		t.Fatalf("the outliers don't disturb the plain fit %v, the test needs a stronger outlier", plain)
+	}
+	tests := []struct {
+		name   string
+		f1, f2 *floatimage.FloatImg
+	}{
+		{"unweighted", nil, nil},
+		{"weighted", f1, f2},
+	}
+	for _, tc := range tests {
+		params, inliers := FitAffineFlowRobust(tc.f1, tc.f2, flow, 0.1, 50)
+		for i := range params {
+			if !near(float64(params[i]), float64(truth[i]), 1e-3) {
+				t.Errorf("%s: params %v, want %v", tc.name, params, truth)
+				break
+			}
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				p := image.Point{x, y}
+				want := p.In(bounds.Inset(1)) && !p.In(outlier)
+				if got := inliers[(y-bounds.Min.Y)*bounds.Dx()+x-bounds.Min.X]; got != want {
+					t.Errorf("%s: inlier at %v = %v, want %v", tc.name, p, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFitAffineFlowRobustTexture(t *testing.T) {
+	// the larger right part is flat so its flow is unreliable, the votes of
+	// the textured left part weigh more
+	f1, f2 := shiftedPair(40, 40, 1, 0)
+	bounds := f1.Bounds()
+	flat := image.Rect(16, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
+	for y := flat.Min.Y; y < flat.Max.Y; y++ {
+		for x := flat.Min.X; x < flat.Max.X; x++ {
+			f1.Set(x, y, 0, 128)
+			f2.Set(x, y, 0, 128)
+		}
+	}
+	flow := affineField(bounds, [6]float32{1, 0, 0, 0, 0, 0}, flat.Inset(1), -2, 3)
+
+	unweighted, _ := FitAffineFlowRobust(nil, nil, flow, 0.1, 50)
+	if !near(float64(unweighted[0]), -2, 1e-3) {
+		t.Errorf("unweighted u = %f, want the majority -2", unweighted[0])
+	}
+	weighted, _ := FitAffineFlowRobust(f1, f2, flow, 0.1, 50)
+	if !near(float64(weighted[0]), 1, 1e-3) || !near(float64(weighted[3]), 0, 1e-3) {
+		t.Errorf("weighted params %v, want the textured motion (1, 0)", weighted)
+	}
+}
+
+func TestMeanFlow(t *testing.T) {
+	bounds := image.Rect(-1, -1, 19, 15)
+	interior := bounds.Inset(1)
+	a, b := image.Rect(2, 2, 6, 5), image.Rect(10, 8, 13, 12)
+	tests := []struct {
+		name string
+		// the local motion in a and b on top of the global motion
+		au, av, bu, bv float32
+		// the mean of the local motion, the 18 x 14 interior has 252
+		// pixels, a and b 12 each
+		u, v float32
+	}{
+		{"no local motion", 0, 0, 0, 0, 0, 0},
+		{"balanced local motion", 2, 1, -2, -1, 0, 0},
+		{"one object", 3, -4, 0, 0, 3 * 12 / 252.0, -4 * 12 / 252.0},
+		{"two objects", 1, 2, 4, 0, 5 * 12 / 252.0, 2 * 12 / 252.0},
+	}
+	for _, tt := range tests {
+		const gu, gv = 1.5, -0.5
+		flow := affineField(bounds, [6]float32{gu, 0, 0, gv, 0, 0}, image.Rectangle{}, 0, 0)
+		local := func(x, y int) (float32, float32) {
+			switch p := (image.Point{x, y}); {
+			case p.In(a):
+				return tt.au, tt.av
+			case p.In(b):
+				return tt.bu, tt.bv
+			}
+			return 0, 0
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				vec := flow.AtF(x, y)
+				if !(image.Point{x, y}).In(interior) {
+					// the dummy border doesn't count
+					vec[0], vec[1] = 1000, -1000
+					continue
+				}
+				du, dv := local(x, y)
+				vec[0] += du
+				vec[1] += dv
+			}
+		}
+
+		u, v := MeanFlow(flow)
+		if !near(float64(u), gu+float64(tt.u), 1e-5) || !near(float64(v), gv+float64(tt.v), 1e-5) {
+			t.Errorf("%s: mean (%f, %f), want (%f, %f)", tt.name, u, v, gu+tt.u, gv+tt.v)
+		}
+
+		// the global motion is gone and only the local motion relative to
+		// the mean is left
+		residual := SubtractMeanFlow(flow)
+		for y := interior.Min.Y; y < interior.Max.Y; y++ {
+			for x := interior.Min.X; x < interior.Max.X; x++ {
+				du, dv := local(x, y)
+				vec := residual.AtF(x, y)
+				if !near(float64(vec[0]), float64(du-tt.u), 1e-5) || !near(float64(vec[1]), float64(dv-tt.v), 1e-5) {
+					t.Errorf("%s: residual at %d, %d = %v, want (%f, %f)", tt.name, x, y, vec, du-tt.u, dv-tt.v)
+				}
+			}
+		}
+		if flow.AtF(5, 5)[0] == residual.AtF(5, 5)[0] {
+			t.Errorf("%s: SubtractMeanFlow changed its argument", tt.name)
+		}
+	}
+
+	if u, v := MeanFlow(floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), 2)); u != 0 || v != 0 {
+		t.Errorf("mean (%f, %f) without interior, want 0", u, v)
+	}
+}
+
+func TestRegionMeanFlow(t *testing.T) {
+	// (2, -1) in the left half and (-0.5, 3) in the right half
+	bounds := image.Rect(-4, 0, 16, 10)
+	flow := constantFlow(bounds, 2, -1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := 6; x < bounds.Max.X; x++ {
+			copy(flow.AtF(x, y), []float32{-0.5, 3})
+		}
+	}
+	tests := []struct {
+		name   string
+		region image.Rectangle
+		want   [2]float32
+	}{
+		{"left", image.Rect(-3, 2, 4, 8), [2]float32{2, -1}},
+		{"right", image.Rect(8, 1, 15, 9), [2]float32{-0.5, 3}},
+		// 4 columns of each motion
+		{"straddling", image.Rect(2, 0, 10, 5), [2]float32{0.75, 1}},
+		// clipped to columns 12 to 15
+		{"outside right", image.Rect(12, -5, 30, 20), [2]float32{-0.5, 3}},
+		// clipped to columns -4 to 5 and 6 to 15, half each
+		{"whole field", image.Rect(-100, -100, 100, 100), [2]float32{0.75, 1}},
+		{"disjoint", image.Rect(20, 20, 30, 30), [2]float32{0, 0}},
+		{"empty", image.Rectangle{}, [2]float32{0, 0}},
+	}
+	regions := make([]image.Rectangle, len(tests))
+	for i, tt := range tests {
+		regions[i] = tt.region
+	}
+	means := RegionMeanFlow(flow, regions)
+	if len(means) != len(tests) {
+		t.Fatalf("got %d means for %d regions", len(means), len(tests))
+	}
+	for i, tt := range tests {
+		if !near(float64(means[i][0]), float64(tt.want[0]), 1e-6) || !near(float64(means[i][1]), float64(tt.want[1]), 1e-6) {
+			t.Errorf("%s: mean %v, want %v", tt.name, means[i], tt.want)
+		}
+	}
+
+	if means := RegionMeanFlow(flow, nil); len(means) != 0 {
+		t.Errorf("no regions give %v", means)
+	}
+}
+
+// radialField returns a 2 channel field covering r with the expansion
+// (p - c)/tau away from c = (cx, cy), negative tau contracts
+func radialField(r image.Rectangle, cx, cy, tau float32) *floatimage.FloatImg {
+	flow := floatimage.NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			vec[0], vec[1] = (float32(x)-cx)/tau, (float32(y)-cy)/tau
+		}
+	}
+	return flow
+}
+
+func TestFocusOfExpansion(t *testing.T) {
+	bounds := image.Rect(-5, 0, 25, 20)
+	rotation := floatimage.NewFloatImg(bounds, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := rotation.AtF(x, y)
+			vec[0], vec[1] = -0.1*(float32(y)-10), 0.1*(float32(x)-10)
+		}
+	}
+	noisy := radialField(bounds, 4, 9, 6)
+	rng := rand.New(rand.NewSource(5))
+	for i := range noisy.Pix {
+		noisy.Pix[i] += 0.1 * (2*rng.Float32() - 1)
+	}
+	tests := []struct {
+		name           string
+		flow           *floatimage.FloatImg
+		fx, fy, eps    float64
+		minRes, maxRes float64
+	}{
+		{"expansion", radialField(bounds, 7.3, 4.6, 5), 7.3, 4.6, 1e-3, 0, 1e-3},
+		{"contraction", radialField(bounds, 12, 15.5, -8), 12, 15.5, 1e-3, 0, 1e-3},
+		{"outside", radialField(bounds, 40, -10, 20), 40, -10, 1e-2, 0, 1e-3},
+		{"noisy", noisy, 4, 9, 0.3, 0.01, 1},
+		// tangential lines have no common point, only the residual matters
+		{"rotation", rotation, 0, 0, math.Inf(1), 5, math.Inf(1)},
+	}
+	for _, tt := range tests {
+		fx, fy, residual := FocusOfExpansion(tt.flow)
+		if !near(float64(fx), tt.fx, tt.eps) || !near(float64(fy), tt.fy, tt.eps) {
+			t.Errorf("%s: focus (%f, %f), want (%f, %f)", tt.name, fx, fy, tt.fx, tt.fy)
+		}
+		if r := float64(residual); r < tt.minRes || r > tt.maxRes {
+			t.Errorf("%s: residual %f, want %f to %f", tt.name, r, tt.minRes, tt.maxRes)
+		}
+	}
+
+	// parallel or zero vectors have no intersection
+	for _, flow := range []*floatimage.FloatImg{constantFlow(bounds, 1, 2), constantFlow(bounds, 0, 0)} {
+		if _, _, residual := FocusOfExpansion(flow); !math.IsInf(float64(residual), 1) {
+			t.Errorf("field of %v: residual %f, want +Inf", flow.AtF(0, 0), residual)
+		}
+	}
+}
+
+func TestTimeToContact(t *testing.T) {
+	bounds := image.Rect(0, 0, 30, 20)
+	const cx, cy = 14, 9
+	// the left half expands at tau 4 and is closer than the right at 10
+	split := radialField(bounds, cx, cy, 4)
+	far := radialField(bounds, cx, cy, 10)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := cx + 1; x < bounds.Max.X; x++ {
+			copy(split.AtF(x, y), far.AtF(x, y))
+		}
+	}
+	tests := []struct {
+		name        string
+		flow        *floatimage.FloatImg
+		left, right float64
+	}{
+		{"uniform", radialField(bounds, cx, cy, 8), 8, 8},
+		{"split", split, 4, 10},
+		{"contraction", radialField(bounds, cx, cy, -8), 0, 0},
+		{"translation", constantFlow(bounds, 1, 0), 0, 0},
+	}
+	for _, tt := range tests {
+		ttc := TimeToContact(tt.flow)
+		if ttc.Chancnt != 1 || ttc.Bounds() != bounds {
+			t.Fatalf("%s: %d channels and bounds %v", tt.name, ttc.Chancnt, ttc.Bounds())
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := tt.left
+				switch {
+				case x == cx && y == cy:
+					// no motion at the focus
+					want = 0
+				case x > cx:
+					want = tt.right
+				}
+				if got := float64(ttc.AtF(x, y)[0]); !near(got, want, 1e-3*want+1e-6) {
+					t.Errorf("%s: time to contact at (%d, %d) is %f, want %f", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
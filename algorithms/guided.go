@@ -0,0 +1,57 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+)
+
+// GuidedFilter smoothes each channel of input with the guided filter of He et
+// al. using channel 0 of guide, typically the gray source image. In every
+// (2*radius+1)² window the output is modeled as a linear function of the
+// guide, so edges of the guide carry over to the output while flat regions
+// get averaged. eps regularizes the fit, larger values smooth more across weak
+// guide edges. The window means use box filters over integral images. input
+// and guide need the same bounds
+func GuidedFilter(input, guide *floatimage.FloatImg, radius int, eps float32) *floatimage.FloatImg {
+	bounds := input.Bounds()
+	// products builds a single channel image of fn evaluated at each pixel
+	products := func(fn func(x, y int) float32) *floatimage.FloatImg {
+		img := floatimage.NewFloatImg(bounds, 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				img.Set(x, y, 0, fn(x, y))
+			}
+		}
+		return img
+	}
+	guideAt := func(x, y int) float32 { return guide.AtF(x, y)[0] }
+	meanI := products(guideAt).BoxBlur(radius)
+	corrI := products(func(x, y int) float32 { return guideAt(x, y) * guideAt(x, y) }).BoxBlur(radius)
+
+	filtered := floatimage.NewFloatImg(bounds, input.Chancnt)
+	for c := 0; c < input.Chancnt; c++ {
+		meanP := products(func(x, y int) float32 { return input.AtF(x, y)[c] }).BoxBlur(radius)
+		corrIP := products(func(x, y int) float32 { return guideAt(x, y) * input.AtF(x, y)[c] }).BoxBlur(radius)
+
+		// coefficients of q = a*I + b per window
+		a := floatimage.NewFloatImg(bounds, 1)
+		b := floatimage.NewFloatImg(bounds, 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				mI, mP := meanI.AtF(x, y)[0], meanP.AtF(x, y)[0]
+				variance := corrI.AtF(x, y)[0] - mI*mI
+				cov := corrIP.AtF(x, y)[0] - mI*mP
+				ak := cov / (variance + eps)
+				a.Set(x, y, 0, ak)
+				b.Set(x, y, 0, mP-ak*mI)
+			}
+		}
+		meanA := a.BoxBlur(radius)
+		meanB := b.BoxBlur(radius)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				filtered.Set(x, y, c, meanA.AtF(x, y)[0]*guideAt(x, y)+meanB.AtF(x, y)[0])
+			}
+		}
+	}
+	return filtered
+}
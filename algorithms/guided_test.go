@@ -0,0 +1,83 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGuidedFilter(t *testing.T) {
+	// the guide steps from 0 to 255 at x = 16, the noisy flow has u = 1 left
+	// and 3 right of it and v = -1 everywhere
+	r := image.Rect(0, 0, 32, 24)
+	guide := floatimage.NewFloatImg(r, 1)
+	flow := floatimage.NewFloatImg(r, 2)
+	rnd := rand.New(rand.NewSource(1))
+	truth := func(x int) (u, v float32) {
+		if x >= 16 {
+			return 3, -1
+		}
+		return 1, -1
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if x >= 16 {
+				guide.Set(x, y, 0, 255)
+			}
+			u, v := truth(x)
+			flow.Set(x, y, 0, u+float32(rnd.NormFloat64()*0.3))
+			flow.Set(x, y, 1, v+float32(rnd.NormFloat64()*0.3))
+		}
+	}
+
+	tests := []struct {
+		eps float32
+		// the largest error next to the edge
+		maxEdgeErr float64
+		// the edge is only kept while eps is small compared to the guide
+		// variance of up to 127.5² in the windows across the edge
+		smeared bool
+	}{
+		{0.01, 0.25, false},
+		{100, 0.25, false},
+		{1e6, 0, true},
+	}
+	for _, tt := range tests {
+		filtered := GuidedFilter(flow, guide, 3, tt.eps)
+		if filtered.Bounds() != r || filtered.Chancnt != 2 {
+			t.Fatalf("eps %g: result bounds %v with %d channels", tt.eps, filtered.Bounds(), filtered.Chancnt)
+		}
+		var sq [2]float64
+		var edgeErr float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				u, v := truth(x)
+				vec := filtered.AtF(x, y)
+				du, dv := float64(vec[0]-u), float64(vec[1]-v)
+				if x == 15 || x == 16 {
+					edgeErr = math.Max(edgeErr, math.Abs(du))
+				}
+				sq[0] += du * du
+				sq[1] += dv * dv
+			}
+		}
+		if tt.smeared {
+			if edgeErr < 0.3 {
+				t.Errorf("eps %g: largest error %f next to the edge, want it smeared", tt.eps, edgeErr)
+			}
+			continue
+		}
+		if edgeErr > tt.maxEdgeErr {
+			t.Errorf("eps %g: largest error %f next to the edge, want <= %f", tt.eps, edgeErr, tt.maxEdgeErr)
+		}
+		// the noise of standard deviation 0.3 is averaged out
+		n := float64(r.Dx() * r.Dy())
+		for c, s := range sq {
+			if rms := math.Sqrt(s / n); rms > 0.1 {
+				t.Errorf("eps %g: channel %d has RMS error %f, want <= 0.1", tt.eps, c, rms)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+)
+
+// splat forward warps img by scale*flow, each pixel is distributed
+// bilinearly onto the 4 pixels around its target. It returns the weighted
+// sums and the accumulated weights
+func splat(img, flow *floatimage.FloatImg, scale float32) (sums, weights *floatimage.FloatImg) {
+	bounds := img.Bounds()
+	sums = floatimage.NewFloatImg(bounds, img.Chancnt)
+	weights = floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			tx, ty := float32(x)+scale*vec[0], float32(y)+scale*vec[1]
+			fx, fy := math.Floor(float64(tx)), math.Floor(float64(ty))
+			x0, y0 := int(fx), int(fy)
+			ax, ay := tx-float32(fx), ty-float32(fy)
+			src := img.AtF(x, y)
+			for k, w := range [4]float32{(1 - ax) * (1 - ay), ax * (1 - ay), (1 - ax) * ay, ax * ay} {
+				dx, dy := x0+k%2, y0+k/2
+				if w == 0 || dx < bounds.Min.X || dx >= bounds.Max.X || dy < bounds.Min.Y || dy >= bounds.Max.Y {
+					continue
+				}
+				dst := sums.AtF(dx, dy)
+				for c := range dst {
+					dst[c] += w * src[c]
+				}
+				weights.AtF(dx, dy)[0] += w
+			}
+		}
+	}
+	return
+}
+
+// InterpolateFrame synthesizes the frame at time 0 <= t <= 1 between f1 and
+// f2 from their flow. f1 is forward warped by t*flow and f2 by -(1-t)*flow
+// (using the flow at the f2 pixel as approximation), the results are blended
+// with the weights 1-t and t. Where only one of them lands a pixel it is used
+// alone and holes hit by neither are filled with the blend of f1 and f2 at
+// the same position
+func InterpolateFrame(f1, f2, flow *floatimage.FloatImg, t float32) *floatimage.FloatImg {
+	sums1, weights1 := splat(f1, flow, t)
+	sums2, weights2 := splat(f2, flow, t-1)
+	bounds := f1.Bounds()
+	frame := floatimage.NewFloatImg(bounds, f1.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			w1, w2 := weights1.AtF(x, y)[0], weights2.AtF(x, y)[0]
+			s1, s2 := sums1.AtF(x, y), sums2.AtF(x, y)
+			out := frame.AtF(x, y)
+			for c := range out {
+				switch {
+				case w1 > 0 && w2 > 0:
+					out[c] = (1-t)*s1[c]/w1 + t*s2[c]/w2
+				case w1 > 0:
+					out[c] = s1[c] / w1
+				case w2 > 0:
+					out[c] = s2[c] / w2
+				default:
+					out[c] = (1-t)*f1.AtF(x, y)[c] + t*f2.AtF(x, y)[c]
+				}
+			}
+		}
+	}
+	return frame
+}
+
+// FillHoles returns a copy of img where the holes, pixels whose channels all
+// equal holeValue, are filled from outside in. In each of the iterations every
+// hole with known 4-neighbors gets their average and becomes known itself, so
+// holes up to about 2*iterations pixels wide are closed. Holes that remain
+// keep holeValue
+func FillHoles(img *floatimage.FloatImg, holeValue float32, iterations int) *floatimage.FloatImg {
+	bounds := img.Bounds()
+	w := bounds.Dx()
+	filled := img.Clone()
+	known := make([]bool, w*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for _, v := range img.AtF(x, y) {
+				if v != holeValue {
+					known[(y-bounds.Min.Y)*w+x-bounds.Min.X] = true
+					break
+				}
+			}
+		}
+	}
+
+	type fill struct {
+		x, y int
+		vals []float32
+	}
+	offsets := [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	for k := 0; k < iterations; k++ {
+		// collect all fills first so this iteration only uses known pixels
+		var fills []fill
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if known[(y-bounds.Min.Y)*w+x-bounds.Min.X] {
+					continue
+				}
+				vals := make([]float32, img.Chancnt)
+				n := 0
+				for _, o := range offsets {
+					nx, ny := x+o[0], y+o[1]
+					if nx < bounds.Min.X || nx >= bounds.Max.X || ny < bounds.Min.Y || ny >= bounds.Max.Y ||
+						!known[(ny-bounds.Min.Y)*w+nx-bounds.Min.X] {
+						continue
+					}
+					for c, v := range filled.AtF(nx, ny) {
+						vals[c] += v
+					}
+					n++
+				}
+				if n == 0 {
+					continue
+				}
+				for c := range vals {
+					vals[c] /= float32(n)
+				}
+				fills = append(fills, fill{x, y, vals})
+			}
+		}
+		if len(fills) == 0 {
+			break
+		}
+		for _, f := range fills {
+			copy(filled.AtF(f.x, f.y), f.vals)
+			known[(f.y-bounds.Min.Y)*w+f.x-bounds.Min.X] = true
+		}
+	}
+	return filled
+}
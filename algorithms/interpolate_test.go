@@ -0,0 +1,183 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestInterpolateFrame(t *testing.T) {
+	// the pattern moves 2 pixels right, at time t it is moved by 2t
+	f1, f2 := shiftedPair(40, 32, 2, 0)
+	flow := constantFlow(f1.Bounds(), 2, 0)
+	interior := image.Rect(4, 4, 36, 28)
+	tests := []struct {
+		t      float32
+		maxErr float64
+	}{
+		{0, 1e-4},
+		{0.25, 1},
+		{0.5, 1e-4},
+		{0.75, 1},
+		{1, 1e-4},
+	}
+	for _, tt := range tests {
+		frame := InterpolateFrame(f1, f2, flow, tt.t)
+		if frame.Bounds() != f1.Bounds() || frame.Chancnt != 1 {
+			t.Fatalf("t = %g: frame bounds %v with %d channels", tt.t, frame.Bounds(), frame.Chancnt)
+		}
+		for y := interior.Min.Y; y < interior.Max.Y; y++ {
+			for x := interior.Min.X; x < interior.Max.X; x++ {
+				want := pattern(float64(x)-2*float64(tt.t), float64(y))
+				if got := frame.AtF(x, y)[0]; math.Abs(float64(got-want)) > tt.maxErr {
+					t.Fatalf("t = %g: pixel (%d, %d) is %f, want %f", tt.t, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	// without motion the frames are blended, when both frames are moved out
+	// of the image the holes get the blend as well
+	r := image.Rect(0, 0, 10, 6)
+	flat1, flat2 := filled(r, 10), filled(r, 30)
+	for _, motion := range []float32{0, 40} {
+		frame := InterpolateFrame(flat1, flat2, constantFlow(r, motion, 0), 0.25)
+		for i, v := range frame.Pix {
+			if v != 15 {
+				t.Fatalf("motion %g: pixel %d is %f, want 15", motion, i, v)
+			}
+		}
+	}
+}
+
+// filled returns a single channel image covering r with the value v
+func filled(r image.Rectangle, v float32) *floatimage.FloatImg {
+	img := floatimage.NewFloatImg(r, 1)
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func TestFillHoles(t *testing.T) {
+	const hole = -1
+	bounds := image.Rect(-3, 0, 17, 14)
+	ramp := func(x, y int) float32 { return float32(2*x + y + 20) }
+	tests := []struct {
+		name       string
+		holes      []image.Rectangle
+		iterations int
+		// the maximum error against the ramp and whether holes remain
+		maxErr float64
+		remain bool
+	}{
+		{"none", nil, 3, 0, false},
+		// a linear ramp is the average of its 4 neighbors
+		{"scattered", []image.Rectangle{image.Rect(2, 3, 3, 4), image.Rect(10, 9, 11, 10), image.Rect(-2, 12, -1, 13)}, 1, 1e-4, false},
+		{"corner", []image.Rectangle{image.Rect(-3, 0, -2, 1)}, 1, 2, false},
+		{"block", []image.Rectangle{image.Rect(4, 4, 8, 8)}, 2, 4, false},
+		{"too wide", []image.Rectangle{image.Rect(0, 2, 10, 12)}, 2, 6, true},
+		{"no iterations", []image.Rectangle{image.Rect(2, 3, 3, 4)}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		img := floatimage.NewFloatImg(bounds, 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				img.Set(x, y, 0, ramp(x, y))
+			}
+		}
+		for _, r := range tt.holes {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					img.Set(x, y, 0, hole)
+				}
+			}
+		}
+		orig := img.Clone()
+		filledImg := FillHoles(img, hole, tt.iterations)
+		if filledImg.Bounds() != bounds || filledImg.Chancnt != 1 {
+			t.Fatalf("%s: bounds %v with %d channels", tt.name, filledImg.Bounds(), filledImg.Chancnt)
+		}
+		var remain bool
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				got := filledImg.AtF(x, y)[0]
+				switch {
+				case orig.AtF(x, y)[0] != hole:
+					if got != orig.AtF(x, y)[0] {
+						t.Errorf("%s: known pixel (%d, %d) changed to %f", tt.name, x, y, got)
+					}
+				case got == hole:
+					remain = true
+				case math.Abs(float64(got-ramp(x, y))) > tt.maxErr:
+					t.Errorf("%s: filled pixel (%d, %d) is %f, want %f", tt.name, x, y, got, ramp(x, y))
+				}
+			}
+		}
+		if remain != tt.remain {
+			t.Errorf("%s: holes remain %v, want %v", tt.name, remain, tt.remain)
+		}
+		// the input is left alone
+		for i, v := range img.Pix {
+			if v != orig.Pix[i] {
+				t.Fatalf("%s: input changed at %d", tt.name, i)
+			}
+		}
+	}
+
+	// forward warping an expanding ramp leaves holes between the spread
+	// pixels which are filled within the range of the row
+	r := image.Rect(0, 0, 24, 8)
+	src := floatimage.NewFloatImg(r, 1)
+	flow := floatimage.NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			src.Set(x, y, 0, float32(10*x))
+			flow.Set(x, y, 0, 1.5*float32(x-12))
+		}
+	}
+	sums, weights := splat(src, flow, 1)
+	warped := floatimage.NewFloatImg(r, 1)
+	var holes int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if w := weights.AtF(x, y)[0]; w > 0 {
+				warped.Set(x, y, 0, sums.AtF(x, y)[0]/w)
+			} else {
+				warped.Set(x, y, 0, hole)
+				holes++
+			}
+		}
+	}
+	if holes == 0 {
+		t.Fatal("forward warp left no holes")
+	}
+	dense := FillHoles(warped, hole, 3)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X + 1; x < r.Max.X-1; x++ {
+			got := dense.AtF(x, y)[0]
+			if got == hole {
+				t.Errorf("forward warp: hole at (%d, %d) remains", x, y)
+				continue
+			}
+			// a hole between known pixels lies between their values
+			left, right := dense.AtF(x-1, y)[0], dense.AtF(x+1, y)[0]
+			if warped.AtF(x, y)[0] == hole && (got < left-1e-3 || got > right+1e-3) {
+				t.Errorf("forward warp: filled (%d, %d) = %f outside of %f to %f", x, y, got, left, right)
+			}
+		}
+	}
+
+	// pixels with only some channels at holeValue are known
+	rgb := floatimage.NewFloatImg(image.Rect(0, 0, 3, 1), 3)
+	copy(rgb.Pix, []float32{5, 5, 5, hole, 7, hole, hole, hole, hole})
+	got := FillHoles(rgb, hole, 1)
+	want := []float32{5, 5, 5, hole, 7, hole, hole, 7, hole}
+	for i, v := range got.Pix {
+		if v != want[i] {
+			t.Errorf("partial holes: %v, want %v", got.Pix, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+)
+
+// Differential invariants divergence and curl as 2 channel FloatImg
+const (
+	Divc  = iota
+	Curlc = iota
+)
+
+// FlowDifferentialInvariants returns a 2 channel image holding the
+// Divergence (see Divc) and the Curl (see Curlc) of the 2 channel flow field
+func FlowDifferentialInvariants(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	div, curl := Divergence(flow), Curl(flow)
+	invariants := floatimage.NewFloatImg(bounds, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out := invariants.AtF(x, y)
+			out[Divc], out[Curlc] = div.AtF(x, y)[0], curl.AtF(x, y)[0]
+		}
+	}
+	return invariants
+}
+
+// partial is the central difference of channel c of img at x, y along
+// (dx, dy), one sided at the image border and 0 for a single pixel wide
+// image like floatimage.FloatImg.ChannelGradient
+func partial(img *floatimage.FloatImg, c, x, y, dx, dy int) float32 {
+	bounds := img.Bounds()
+	x0, y0, x1, y1 := x-dx, y-dy, x+dx, y+dy
+	if !(image.Point{x0, y0}).In(bounds) {
+		x0, y0 = x, y
+	}
+	if !(image.Point{x1, y1}).In(bounds) {
+		x1, y1 = x, y
+	}
+	steps := x1 - x0 + y1 - y0
+	if steps == 0 {
+		return 0
+	}
+	return (img.AtF(x1, y1)[c] - img.AtF(x0, y0)[c]) / float32(steps)
+}
+
+// Divergence returns the divergence du/dx + dv/dy of the 2 channel flow field
+// as single channel image using central differences, positive divergence
+// means expansion
+func Divergence(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	div := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			div.Set(x, y, 0, partial(flow, 0, x, y, 1, 0)+partial(flow, 1, x, y, 0, 1))
+		}
+	}
+	return div
+}
+
+// Curl returns the curl dv/dx - du/dy of the 2 channel flow field as single
+// channel image using central differences, positive curl is a clockwise
+// rotation on screen as y points down
+func Curl(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	curl := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			curl.Set(x, y, 0, partial(flow, 1, x, y, 1, 0)-partial(flow, 0, x, y, 0, 1))
+		}
+	}
+	return curl
+}
@@ -0,0 +1,72 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"testing"
+)
+
+// linearField returns a 2 channel field with u = a*x + b*y, v = c*x + d*y
+func linearField(r image.Rectangle, a, b, c, d float32) *floatimage.FloatImg {
+	flow := floatimage.NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			vec[0] = a*float32(x) + b*float32(y)
+			vec[1] = c*float32(x) + d*float32(y)
+		}
+	}
+	return flow
+}
+
+func TestDivergenceCurl(t *testing.T) {
+	bounds := image.Rect(-3, 2, 12, 14)
+	tests := []struct {
+		name       string
+		a, b, c, d float32
+		div, curl  float32
+	}{
+		{"expansion", 0.1, 0, 0, 0.1, 0.2, 0},
+		{"rotation", 0, -0.2, 0.2, 0, 0, 0.4},
+		{"shear", 0, 0.3, 0, 0, 0, -0.3},
+		{"mixed", 0.5, 0.25, -0.25, 1, 1.5, -0.5},
+	}
+	for _, tc := range tests {
+		flow := linearField(bounds, tc.a, tc.b, tc.c, tc.d)
+		div, curl := Divergence(flow), Curl(flow)
+		inv := FlowDifferentialInvariants(flow)
+		if inv.Chancnt != 2 || div.Chancnt != 1 || curl.Chancnt != 1 {
+			t.Fatalf("%s: channel counts %d, %d, %d", tc.name, inv.Chancnt, div.Chancnt, curl.Chancnt)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				d, c := div.AtF(x, y)[0], curl.AtF(x, y)[0]
+				if !near(float64(d), float64(tc.div), 1e-5) || !near(float64(c), float64(tc.curl), 1e-5) {
+					t.Fatalf("%s at %d,%d: div %f curl %f, want %f %f", tc.name, x, y, d, c, tc.div, tc.curl)
+				}
+				if got := inv.AtF(x, y); got[Divc] != d || got[Curlc] != c {
+					t.Fatalf("%s at %d,%d: invariants %v, want standalone %f %f", tc.name, x, y, got, d, c)
+				}
+			}
+		}
+	}
+}
+
+func TestDivergenceMatchesChannelGradient(t *testing.T) {
+	f1, _ := shiftedPair(12, 9, 0, 0)
+	flow := floatimage.NewFloatImg(f1.Bounds(), 2)
+	for i := range flow.Pix {
+		flow.Pix[i] = f1.Pix[i/2] * float32(1+i%2)
+	}
+	gu, gv := flow.ChannelGradient(0), flow.ChannelGradient(1)
+	div, curl := Divergence(flow), Curl(flow)
+	bounds := flow.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			u, v := gu.AtF(x, y), gv.AtF(x, y)
+			if !near(float64(div.AtF(x, y)[0]), float64(u[0]+v[1]), 1e-4) || !near(float64(curl.AtF(x, y)[0]), float64(v[0]-u[1]), 1e-4) {
+				t.Fatalf("at %d,%d: div %f curl %f, want %f %f", x, y, div.AtF(x, y)[0], curl.AtF(x, y)[0], u[0]+v[1], v[0]-u[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+	"sort"
+)
+
+// weightedValue is a sample of the weighted median
+type weightedValue struct {
+	value, weight float32
+}
+
+// byValue sorts weighted values ascending by value
+type byValue []weightedValue
+
+func (s byValue) Len() int           { return len(s) }
+func (s byValue) Less(i, j int) bool { return s[i].value < s[j].value }
+func (s byValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// WeightedMedianFilter replaces each channel of flow by its weighted median
+// over the (2*radius+1)² window clipped to the image. The weight of a
+// neighbor q of p is the bilateral weight
+//
+//	exp(-|q-p|²/(2 sigmaSpatial²)) * exp(-(guide(q)-guide(p))²/(2 sigmaColor²))
+//
+// using channel 0 of guide, so neighbors across an edge of the guide image
+// hardly contribute and motion boundaries along image edges are preserved
+func WeightedMedianFilter(flow, guide *floatimage.FloatImg, radius int, sigmaSpatial, sigmaColor float32) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	filtered := floatimage.NewFloatImg(bounds, flow.Chancnt)
+	spatial := -1.0 / (2 * float64(sigmaSpatial) * float64(sigmaSpatial))
+	rangeScale := -1.0 / (2 * float64(sigmaColor) * float64(sigmaColor))
+
+	window := make(byValue, 0, (2*radius+1)*(2*radius+1))
+	weights := make([]float32, 0, cap(window))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g := guide.AtF(x, y)[0]
+			weights = weights[:0]
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					qx, qy := x+dx, y+dy
+					if qx < bounds.Min.X || qx >= bounds.Max.X || qy < bounds.Min.Y || qy >= bounds.Max.Y {
+						continue
+					}
+					dg := float64(guide.AtF(qx, qy)[0] - g)
+					w := math.Exp(spatial*float64(dx*dx+dy*dy) + rangeScale*dg*dg)
+					weights = append(weights, float32(w))
+				}
+			}
+
+			out := filtered.AtF(x, y)
+			for c := range out {
+				window = window[:0]
+				k := 0
+				var total float32
+				for dy := -radius; dy <= radius; dy++ {
+					for dx := -radius; dx <= radius; dx++ {
+						qx, qy := x+dx, y+dy
+						if qx < bounds.Min.X || qx >= bounds.Max.X || qy < bounds.Min.Y || qy >= bounds.Max.Y {
+							continue
+						}
+						window = append(window, weightedValue{flow.AtF(qx, qy)[c], weights[k]})
+						total += weights[k]
+						k++
+					}
+				}
+				sort.Sort(window)
+				var acc float32
+				for _, wv := range window {
+					acc += wv.weight
+					if acc >= total/2 {
+						out[c] = wv.value
+						break
+					}
+				}
+			}
+		}
+	}
+	return filtered
+}
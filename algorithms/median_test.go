@@ -0,0 +1,80 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"sort"
+	"testing"
+)
+
+// plainMedian is the unweighted median of each channel over the
+// (2*radius+1)² window clipped to the image
+func plainMedian(flow *floatimage.FloatImg, radius int) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	filtered := floatimage.NewFloatImg(bounds, flow.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for c := 0; c < flow.Chancnt; c++ {
+				var values []float64
+				window := image.Rect(x-radius, y-radius, x+radius+1, y+radius+1).Intersect(bounds)
+				for qy := window.Min.Y; qy < window.Max.Y; qy++ {
+					for qx := window.Min.X; qx < window.Max.X; qx++ {
+						values = append(values, float64(flow.AtF(qx, qy)[c]))
+					}
+				}
+				sort.Float64s(values)
+				filtered.Set(x, y, c, float32(values[(len(values)-1)/2]))
+			}
+		}
+	}
+	return filtered
+}
+
+func TestWeightedMedianFilter(t *testing.T) {
+	// the moving object covers the region in the guide image and the flow,
+	// the flow has impulse outliers away from the object
+	tests := []struct {
+		name   string
+		object image.Rectangle
+	}{
+		{"stripe", image.Rect(8, 0, 10, 20)},
+		{"corner", image.Rect(6, 6, 20, 20)},
+		{"square", image.Rect(5, 5, 10, 10)},
+	}
+	r := image.Rect(0, 0, 20, 20)
+	outliers := []image.Point{{1, 1}, {3, 16}, {16, 2}}
+	for _, tt := range tests {
+		guide := floatimage.NewFloatImg(r, 1)
+		truth := floatimage.NewFloatImg(r, 2)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				guide.Set(x, y, 0, 50)
+				if (image.Point{x, y}).In(tt.object) {
+					guide.Set(x, y, 0, 200)
+					truth.Set(x, y, 0, 2)
+					truth.Set(x, y, 1, -1)
+				}
+			}
+		}
+		flow := truth.Clone()
+		for _, p := range outliers {
+			flow.Set(p.X, p.Y, 0, 10)
+			flow.Set(p.X, p.Y, 1, 10)
+		}
+
+		weighted := WeightedMedianFilter(flow, guide, 2, 3, 10)
+		plain := plainMedian(flow, 2)
+		weightedEPE, plainEPE := fieldEPE(weighted, truth, r), fieldEPE(plain, truth, r)
+		if weightedEPE > 1e-6 {
+			t.Errorf("%s: weighted median EPE %f, want 0", tt.name, weightedEPE)
+		}
+		if plainEPE < 0.01 {
+			t.Errorf("%s: plain median EPE %f, the object survives without a guide", tt.name, plainEPE)
+		}
+		for _, p := range outliers {
+			if vec := weighted.AtF(p.X, p.Y); vec[0] != 0 || vec[1] != 0 {
+				t.Errorf("%s: outlier at %v kept as %v", tt.name, p, vec)
+			}
+		}
+	}
+}
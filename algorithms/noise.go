@@ -0,0 +1,40 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+	"sort"
+)
+
+// EstimateNoise estimates the standard deviation of additive Gaussian noise
+// in channel 0 of img. It applies the Laplacian [0 1 0; 1 -4 1; 0 1 0] over
+// the interior and takes the median absolute deviation of the response which
+// is robust against the image structure, scaled by 1.4826 (MAD to standard
+// deviation) and divided by the kernel's norm sqrt(20). The image needs to have
+// dummy borders
+func EstimateNoise(img *floatimage.FloatImg) float32 {
+	bounds := img.Bounds()
+	responses := make([]float64, 0, (bounds.Dx()-2)*(bounds.Dy()-2))
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			l := img.AtF(x-1, y)[0] + img.AtF(x+1, y)[0] + img.AtF(x, y-1)[0] + img.AtF(x, y+1)[0] - 4*img.AtF(x, y)[0]
+			responses = append(responses, float64(l))
+		}
+	}
+	if len(responses) == 0 {
+		return 0
+	}
+	median := func(values []float64) float64 {
+		sort.Float64s(values)
+		n := len(values)
+		if n%2 == 1 {
+			return values[n/2]
+		}
+		return (values[n/2-1] + values[n/2]) / 2
+	}
+	m := median(responses)
+	for i, r := range responses {
+		responses[i] = math.Abs(r - m)
+	}
+	return float32(1.4826 * median(responses) / math.Sqrt(20))
+}
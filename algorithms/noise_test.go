@@ -0,0 +1,64 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// smoothImg returns a w x h image with dummy borders of a ramp plus a slow
+// sine wave, its Laplacian is small everywhere
+func smoothImg(w, h int) *floatimage.FloatImg {
+	img := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, 0, float32(100+0.5*float64(x)+40*math.Sin(0.1*float64(x)+0.07*float64(y))))
+		}
+	}
+	return img.AddDummies()
+}
+
+func TestEstimateNoise(t *testing.T) {
+	clean := smoothImg(96, 96)
+	if est := EstimateNoise(clean); est > 0.3 {
+		t.Errorf("clean image: estimate %f, want <= 0.3", est)
+	}
+
+	tests := []struct {
+		sigma float64
+		seed  int64
+	}{
+		{1, 1},
+		{3, 2},
+		{6, 3},
+		{12, 4},
+	}
+	for _, tt := range tests {
+		rnd := rand.New(rand.NewSource(tt.seed))
+		noisy := clean.Clone()
+		for i := range noisy.Pix {
+			noisy.Pix[i] += float32(rnd.NormFloat64() * tt.sigma)
+		}
+		noisy.Dummies()
+		if est := float64(EstimateNoise(noisy)); math.Abs(est-tt.sigma) > 0.1*tt.sigma {
+			t.Errorf("sigma %g: estimate %f", tt.sigma, est)
+		}
+	}
+
+	// the Laplacian vanishes on linear images and there is nothing to
+	// estimate on an image without interior
+	ramp := floatimage.NewFloatImg(image.Rect(0, 0, 10, 10), 1)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			ramp.Set(x, y, 0, float32(3*x-2*y))
+		}
+	}
+	if est := EstimateNoise(ramp); est != 0 {
+		t.Errorf("ramp: estimate %f, want 0", est)
+	}
+	if est := EstimateNoise(floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), 1)); est != 0 {
+		t.Errorf("2 x 2 image: estimate %f, want 0", est)
+	}
+}
@@ -5,8 +5,12 @@ Horn & Schunk and an iterative Jacobi scheme
 package algorithms
 
 import (
+	"fmt"
 	"github.com/niklas88/imgtest/floatimage"
+	"image"
 	"math"
+	"sync"
+	"time"
 )
 
 // Derivatives fx, fy, fz as 3 channel FloatImg to make access sane
@@ -16,15 +20,69 @@ const (
 	Fzc = iota
 )
 
-func deriveMixed(f1, f2 *floatimage.FloatImg) *floatimage.FloatImg {
+// DerivMode selects the kernel used for the spatial derivatives fx, fy
+type DerivMode int
+
+const (
+	// DerivCentral uses plain central differences
+	DerivCentral DerivMode = iota
+	// DerivSobel smoothes perpendicular to the derivative with [1,2,1]/4
+	DerivSobel
+	// DerivScharr smoothes perpendicular to the derivative with [3,10,3]/16
+	// which has better rotational symmetry than Sobel
+	DerivScharr
+)
+
+// smoothing returns the weights applied perpendicular to the [-1,0,1]
+// difference, they always sum up to 1
+func (m DerivMode) smoothing() [3]float32 {
+	switch m {
+	case DerivSobel:
+		return [3]float32{1.0 / 4.0, 2.0 / 4.0, 1.0 / 4.0}
+	case DerivScharr:
+		return [3]float32{3.0 / 16.0, 10.0 / 16.0, 3.0 / 16.0}
+	}
+	return [3]float32{0, 1, 0}
+}
+
+// deriveMixed computes the derivatives of f1, f2 into the 3 channel image derivs
+// which needs to cover the same bounds. Unless opts.NoDummies is set the dummy
+// borders of derivs are left untouched. With opts.Wrap the neighbors wrap
+// around the interior
+func deriveMixed(f1, f2 *floatimage.FloatImg, opts *HornSchunkOptions, derivs *floatimage.FloatImg) *floatimage.FloatImg {
 	const hx = 1.0
 	const hy = 1.0
+	w := opts.Deriv.smoothing()
 	bounds := f1.Bounds()
-	derivs := floatimage.NewFloatImg(bounds, 3)
-	for j := bounds.Min.Y + 1; j < bounds.Max.Y-1; j++ {
-		for i := bounds.Min.X + 1; i < bounds.Max.X-1; i++ {
-			Fx := (f1.AtF(i+1, j)[0] - f1.AtF(i-1, j)[0] + f2.AtF(i+1, j)[0] - f2.AtF(i-1, j)[0]) / (4.0 * hx)
-			Fy := (f1.AtF(i, j+1)[0] - f1.AtF(i, j-1)[0] + f2.AtF(i, j+1)[0] - f2.AtF(i, j-1)[0]) / (4.0 * hy)
+	inner := bounds.Inset(1)
+	if opts.NoDummies {
+		inner = bounds
+	}
+	// averaged gray value of both images at i, j, without dummies neighbors
+	// outside of the image are replicated from the border
+	mode := floatimage.BoundaryReplicate
+	if opts.Wrap {
+		mode = floatimage.BoundaryWrap
+	}
+	avg := func(i, j int) float32 {
+		if opts.NoDummies || opts.Wrap {
+			i, _ = mode.Resolve(i, inner.Min.X, inner.Max.X)
+			j, _ = mode.Resolve(j, inner.Min.Y, inner.Max.Y)
+		}
+		return f1.AtF(i, j)[0] + f2.AtF(i, j)[0]
+	}
+	for j := inner.Min.Y; j < inner.Max.Y; j++ {
+		for i := inner.Min.X; i < inner.Max.X; i++ {
+			var Fx, Fy float32
+			for k := -1; k <= 1; k++ {
+				if w[k+1] == 0 {
+					continue
+				}
+				Fx += w[k+1] * (avg(i+1, j+k) - avg(i-1, j+k))
+				Fy += w[k+1] * (avg(i+k, j+1) - avg(i+k, j-1))
+			}
+			Fx /= 4.0 * hx
+			Fy /= 4.0 * hy
 			Fz := f2.AtF(i, j)[0] - f1.AtF(i, j)[0]
 			dvs := derivs.AtF(i, j)
 			dvs[Fxc], dvs[Fyc], dvs[Fzc] = Fx, Fy, Fz
@@ -33,14 +91,130 @@ func deriveMixed(f1, f2 *floatimage.FloatImg) *floatimage.FloatImg {
 	return derivs
 }
 
-func flow(alpha float32, derivs, oldvec, vecField *floatimage.FloatImg) {
+// flow runs a single Jacobi step, or with opts.Omega > 0 a red-black SOR
+// step in place on vecField which then has to hold the same flow as oldvec.
+// The rows are processed in parallel chunks of opts.RowsPerGo rows (0
+// chooses the chunk size automatically)
+func flow(derivs, oldvec, vecField *floatimage.FloatImg, opts *HornSchunkOptions) {
+	if opts.Omega > 0 {
+		sor(derivs, vecField, opts)
+		return
+	}
+	if opts.Wrap {
+		region := vecField.Bounds()
+		if !opts.NoDummies {
+			region = region.Inset(1)
+		}
+		floatimage.ParallelRows(region, opts.RowsPerGo, func(minY, maxY int) {
+			flowRowsWrap(opts.Alpha, derivs, oldvec, vecField, region, minY, maxY)
+		})
+		return
+	}
+	floatimage.ParallelRows(vecField.Bounds(), opts.RowsPerGo, func(minY, maxY int) {
+		flowRows(opts.Alpha, derivs, oldvec, vecField, minY, maxY)
+	})
+}
+
+// flowRowsWrap is flowRows for periodic images, the neighbors wrap around
+// region so every pixel in it has 4 neighbors. Pixels outside of region are
+// left untouched
+func flowRowsWrap(alpha float32, derivs, oldvec, vecField *floatimage.FloatImg, region image.Rectangle, minY, maxY int) {
+	help := 1.0 / alpha
+	wrap := floatimage.BoundaryWrap
+	for j := minY; j < maxY; j++ {
+		up, _ := wrap.Resolve(j-1, region.Min.Y, region.Max.Y)
+		down, _ := wrap.Resolve(j+1, region.Min.Y, region.Max.Y)
+		for i := region.Min.X; i < region.Max.X; i++ {
+			left, _ := wrap.Resolve(i-1, region.Min.X, region.Max.X)
+			right, _ := wrap.Resolve(i+1, region.Min.X, region.Max.X)
+			var uSum, vSum float32
+			for _, uv := range [4][]float32{oldvec.AtF(left, j), oldvec.AtF(right, j), oldvec.AtF(i, up), oldvec.AtF(i, down)} {
+				uSum += uv[0]
+				vSum += uv[1]
+			}
+			dvs := derivs.AtF(i, j)
+			fxij, fyij, fzij := dvs[Fxc], dvs[Fyc], dvs[Fzc]
+			uv := oldvec.AtF(i, j)
+			uSum -= help * fxij * (fyij*uv[1] + fzij)
+			uSum /= 4 + help*fxij*fxij
+			vSum -= help * fyij * (fxij*uv[0] + fzij)
+			vSum /= 4 + help*fyij*fyij
+			uv = vecField.AtF(i, j)
+			uv[0], uv[1] = uSum, vSum
+		}
+	}
+}
+
+// sor runs a red-black SOR step in place on vecField, first all pixels with
+// even i+j are updated from their (odd) neighbors then all odd ones. Each
+// half sweep is processed in parallel chunks like the Jacobi step
+func sor(derivs, vecField *floatimage.FloatImg, opts *HornSchunkOptions) {
+	region := vecField.Bounds()
+	if opts.Wrap && !opts.NoDummies {
+		region = region.Inset(1)
+	}
+	for parity := 0; parity < 2; parity++ {
+		floatimage.ParallelRows(region, opts.RowsPerGo, func(minY, maxY int) {
+			sorRows(opts, derivs, vecField, region, parity, minY, maxY)
+		})
+	}
+}
+
+// sorRows updates the pixels with (i+j)&1 == parity in the rows minY <= j < maxY
+// of region, the Gauss-Seidel value of (u, v) is over-relaxed by opts.Omega. With
+// opts.Wrap the neighbors wrap around region otherwise only the neighbors
+// inside of it are used like in flowRows
+func sorRows(opts *HornSchunkOptions, derivs, vecField *floatimage.FloatImg, region image.Rectangle, parity, minY, maxY int) {
+	help := 1.0 / opts.Alpha
+	omega := opts.Omega
+	wrap := floatimage.BoundaryWrap
+	for j := minY; j < maxY; j++ {
+		i := region.Min.X
+		if (i+j)&1 != parity {
+			i++
+		}
+		for ; i < region.Max.X; i += 2 {
+			var nn int
+			var uSum, vSum float32
+			for _, d := range [4]image.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				x, y := i+d.X, j+d.Y
+				if opts.Wrap {
+					x, _ = wrap.Resolve(x, region.Min.X, region.Max.X)
+					y, _ = wrap.Resolve(y, region.Min.Y, region.Max.Y)
+				} else if !(image.Point{x, y}).In(region) {
+					continue
+				}
+				uv := vecField.AtF(x, y)
+				uSum += uv[0]
+				vSum += uv[1]
+				nn++
+			}
+			// solve the coupled 2x2 system of u and v at the pixel exactly,
+			// updating them one after the other can diverge when over-relaxed
+			dvs := derivs.AtF(i, j)
+			fxij, fyij, fzij := dvs[Fxc], dvs[Fyc], dvs[Fzc]
+			n := float32(nn)
+			bu := uSum - help*fxij*fzij
+			bv := vSum - help*fyij*fzij
+			det := n * (n + help*(fxij*fxij+fyij*fyij))
+			u := ((n+help*fyij*fyij)*bu - help*fxij*fyij*bv) / det
+			v := ((n+help*fxij*fxij)*bv - help*fxij*fyij*bu) / det
+			uv := vecField.AtF(i, j)
+			uv[0] += omega * (u - uv[0])
+			uv[1] += omega * (v - uv[1])
+		}
+	}
+}
+
+// flowRows runs the Jacobi step for the rows minY <= j < maxY
+func flowRows(alpha float32, derivs, oldvec, vecField *floatimage.FloatImg, minY, maxY int) {
 	bounds := vecField.Bounds()
 
 	help := 1.0 / alpha
 	var nn int
 	var uSum, vSum float32
 	var uv []float32
-	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+	for j := minY; j < maxY; j++ {
 		for i := bounds.Min.X; i < bounds.Max.X; i++ {
 			nn = 0
 			uSum, vSum = 0, 0
@@ -84,29 +258,240 @@ func flow(alpha float32, derivs, oldvec, vecField *floatimage.FloatImg) {
 	}
 }
 
+// HornSchunkOptions holds the parameters of the Horn & Schunk solver
+type HornSchunkOptions struct {
+	// Alpha is the smoothing weight alpha > 0
+	Alpha float32
+	// Iterations is the number of Jacobi iterations
+	Iterations int
+	// Deriv selects the spatial derivative kernel
+	Deriv DerivMode
+	// NoDummies treats the whole image as interior, for images without dummy
+	// borders e.g. from floatimage.GrayFloatFromImage
+	NoDummies bool
+	// Wrap treats the image as periodic, e.g. for panoramas, the neighbors
+	// of the derivatives and the smoothness term wrap around the interior
+	// (see floatimage.BoundaryWrap) instead of using the dummy borders. The
+	// dummy border of the flow stays 0
+	Wrap bool
+	// RowsPerGo is the number of rows each goroutine processes per
+	// iteration, 0 chooses it with floatimage.AutoRowChunk
+	RowsPerGo int
+	// Omega > 0 replaces the Jacobi iterations by red-black successive over
+	// relaxation with this relaxation factor, 1 is Gauss-Seidel and values
+	// up to 2 converge faster. 0 keeps the Jacobi method
+	Omega float32
+	// OnIteration is called after each iteration that is due according to
+	// LogInterval with its number (starting at 1) and the current flow which
+	// must not be modified, it may be nil
+	OnIteration func(iter int, uv *floatimage.FloatImg)
+	// OnResidual is called after each iteration that is due according to
+	// LogInterval with the Euclidean norm of the change of the flow in that
+	// iteration, the norm is only computed then. It may be nil
+	OnResidual func(iter int, residual float32)
+	// LogInterval is the number of iterations between the diagnostics, i.e.
+	// the calls of OnIteration, OnResidual and OnSnapshot. 0 (the default)
+	// and 1 run them after every iteration which costs a full image scan for
+	// the residual, a negative value disables them
+	LogInterval int
+	// SnapshotEvery is the number of iterations between calls of OnSnapshot,
+	// 0 disables snapshots. Snapshots are only taken in iterations that are
+	// also due according to LogInterval
+	SnapshotEvery int
+	// OnSnapshot is called every SnapshotEvery iterations with a copy of the
+	// current flow that the callee may keep
+	OnSnapshot func(iter int, uv *floatimage.FloatImg)
+}
+
+// logInterval is the effective LogInterval, 0 if the diagnostics are
+// disabled
+func (p *HornSchunkOptions) logInterval() int {
+	switch {
+	case p.LogInterval < 0:
+		return 0
+	case p.LogInterval == 0:
+		return 1
+	}
+	return p.LogInterval
+}
+
+// logEvery reports whether the diagnostics are due in iteration k
+func (p *HornSchunkOptions) logEvery(k int) bool {
+	interval := p.logInterval()
+	return interval > 0 && k%interval == 0
+}
+
 // OpticFlowHornSchunk computes the optic flow between two images
 // the images need to have Dummie borders (see floatimage.Dummies())
 // applied.
 // It returns the optic flow field as a 2 channel floatimage.FloatImg
 func OpticFlowHornSchunk(f1, f2 *floatimage.FloatImg, alpha float32, iterations int) (uv *floatimage.FloatImg) {
-	// Compute fx, fy, fz derivatives as FloatImg with 3 channels for faster access
-	derivs := deriveMixed(f1, f2)
-	// bounds without dummies
+	return OpticFlowHornSchunkOptions(f1, f2, &HornSchunkOptions{Alpha: alpha, Iterations: iterations})
+}
+
+// OpticFlowHornSchunkOptions is like OpticFlowHornSchunk but takes all
+// solver parameters from opts, with opts.NoDummies the images must not have
+// dummy borders
+func OpticFlowHornSchunkOptions(f1, f2 *floatimage.FloatImg, opts *HornSchunkOptions) (uv *floatimage.FloatImg) {
 	bounds := f1.Bounds()
+	// Compute fx, fy, fz derivatives as FloatImg with 3 channels for faster access
+	derivs := deriveMixed(f1, f2, opts, floatimage.NewFloatImg(bounds, 3))
 
 	// vector field as FloatImg with 2 channels
 	uv = floatimage.NewFloatImg(bounds, 2)
 	// temporary storage for vector field from previous iteration
 	uvOld := floatimage.NewFloatImg(bounds, 2)
-	// Process image using the Jacobi method to incrementally compute the vector field
-	for k := 1; k <= iterations; k++ {
-		flow(float32(alpha), derivs, uvOld, uv)
+	iterate(derivs, uvOld, uv, opts)
+	return
+}
+
+// OpticFlowHornSchunkInit is like OpticFlowHornSchunk but starts the iterations
+// from initFlow instead of a zero flow, e.g. the result for a previous frame
+// or a global translation estimate. initFlow needs to be a 2 channel image
+// with the same bounds as f1
+func OpticFlowHornSchunkInit(f1, f2, initFlow *floatimage.FloatImg, alpha float32, iterations int) (uv *floatimage.FloatImg, err error) {
+	return OpticFlowHornSchunkInitOptions(f1, f2, initFlow, &HornSchunkOptions{Alpha: alpha, Iterations: iterations})
+}
+
+// OpticFlowHornSchunkInitOptions is like OpticFlowHornSchunkInit but takes all
+// solver parameters from opts
+func OpticFlowHornSchunkInitOptions(f1, f2, initFlow *floatimage.FloatImg, opts *HornSchunkOptions) (uv *floatimage.FloatImg, err error) {
+	bounds := f1.Bounds()
+	if initFlow.Chancnt != 2 {
+		return nil, fmt.Errorf("initial flow needs 2 channels, got %d", initFlow.Chancnt)
+	}
+	if !initFlow.Bounds().Eq(bounds) {
+		return nil, fmt.Errorf("initial flow bounds %v don't match image bounds %v", initFlow.Bounds(), bounds)
+	}
+	derivs := deriveMixed(f1, f2, opts, floatimage.NewFloatImg(bounds, 3))
+	uv = initFlow.Clone()
+	uvOld := initFlow.Clone()
+	iterate(derivs, uvOld, uv, opts)
+	return uv, nil
+}
+
+// OpticFlowHornSchunkBudget is like OpticFlowHornSchunk but instead of a fixed
+// number of iterations it keeps iterating until budget has elapsed. The time
+// is checked between iterations so a started iteration always completes and
+// the returned flow is consistent. It also returns the number of iterations
+func OpticFlowHornSchunkBudget(f1, f2 *floatimage.FloatImg, alpha float32, budget time.Duration) (uv *floatimage.FloatImg, iterations int) {
+	start := time.Now()
+	bounds := f1.Bounds()
+	opts := &HornSchunkOptions{Alpha: alpha}
+	derivs := deriveMixed(f1, f2, opts, floatimage.NewFloatImg(bounds, 3))
+	uv = floatimage.NewFloatImg(bounds, 2)
+	uvOld := floatimage.NewFloatImg(bounds, 2)
+	for time.Since(start) < budget {
+		flow(derivs, uvOld, uv, opts)
 		uvOld.Copy(uv)
+		iterations++
 	}
+	return
+}
+
+// ComputeDerivatives computes the spatial and temporal derivatives of f1, f2
+// used by the solver as 3 channel image (see Fxc, Fyc, Fzc) with central
+// differences. The images need to have dummy borders. Together with
+// OpticFlowFromDerivatives this allows caching the derivatives when only
+// alpha or the number of iterations change
+func ComputeDerivatives(f1, f2 *floatimage.FloatImg) *floatimage.FloatImg {
+	return deriveMixed(f1, f2, &HornSchunkOptions{}, floatimage.NewFloatImg(f1.Bounds(), 3))
+}
 
+// OpticFlowFromDerivatives runs the Horn & Schunk solver on precomputed
+// derivatives from ComputeDerivatives, the result is the same as that of
+// OpticFlowHornSchunk on the original images
+func OpticFlowFromDerivatives(derivs *floatimage.FloatImg, alpha float32, iterations int) (uv *floatimage.FloatImg) {
+	bounds := derivs.Bounds()
+	uv = floatimage.NewFloatImg(bounds, 2)
+	uvOld := floatimage.NewFloatImg(bounds, 2)
+	iterate(derivs, uvOld, uv, &HornSchunkOptions{Alpha: alpha, Iterations: iterations})
 	return
 }
 
+// iterate runs opts.Iterations Jacobi steps starting from uvOld, the result
+// is stored in uv
+func iterate(derivs, uvOld, uv *floatimage.FloatImg, opts *HornSchunkOptions) {
+	// Process image using the Jacobi method to incrementally compute the vector field
+	for k := 1; k <= opts.Iterations; k++ {
+		flow(derivs, uvOld, uv, opts)
+		due := opts.logEvery(k)
+		if due && opts.OnResidual != nil {
+			opts.OnResidual(k, updateNorm(uvOld, uv, opts.RowsPerGo))
+		}
+		uvOld.Copy(uv)
+		if !due {
+			continue
+		}
+		if opts.OnIteration != nil {
+			opts.OnIteration(k, uv)
+		}
+		if opts.SnapshotEvery > 0 && opts.OnSnapshot != nil && k%opts.SnapshotEvery == 0 {
+			opts.OnSnapshot(k, uv.Clone())
+		}
+	}
+}
+
+// updateNorm is the Euclidean norm of the difference of the flow fields
+// uvOld and uv, the rows are summed up in parallel chunks
+func updateNorm(uvOld, uv *floatimage.FloatImg, rowsPerGo int) float32 {
+	bounds := uv.Bounds()
+	var sum float64
+	var mu sync.Mutex
+	floatimage.ParallelRows(bounds, rowsPerGo, func(minY, maxY int) {
+		var chunkSum float64
+		for y := minY; y < maxY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				a, b := uvOld.AtF(x, y), uv.AtF(x, y)
+				du, dv := float64(b[0]-a[0]), float64(b[1]-a[1])
+				chunkSum += du*du + dv*dv
+			}
+		}
+		mu.Lock()
+		sum += chunkSum
+		mu.Unlock()
+	})
+	return float32(math.Sqrt(sum))
+}
+
+// ConvergenceFactor estimates the asymptotic convergence factor from the
+// per iteration residuals (see HornSchunkOptions.OnResidual) as the mean
+// reduction per iteration over the second half, (r[n-1] / r[n/2])^(1/(n-1-n/2)).
+// Smaller values mean faster convergence, e.g. SOR (see HornSchunkOptions.Omega)
+// reports a smaller factor than Jacobi on the same input. 0 is returned if
+// there are too few residuals or they already reached zero
+func ConvergenceFactor(residuals []float32) float32 {
+	n := len(residuals)
+	m := n / 2
+	if n-1-m < 1 || residuals[m] == 0 {
+		return 0
+	}
+	ratio := float64(residuals[n-1]) / float64(residuals[m])
+	return float32(math.Pow(ratio, 1/float64(n-1-m)))
+}
+
+// OpticFlowHornSchunkConvergence is OpticFlowHornSchunkOptions that also
+// returns the ConvergenceFactor per iteration, an OnResidual callback in opts
+// is still called. The residuals are only computed every opts.LogInterval
+// iterations, with a negative LogInterval there are none and the factor is 0
+func OpticFlowHornSchunkConvergence(f1, f2 *floatimage.FloatImg, opts *HornSchunkOptions) (uv *floatimage.FloatImg, factor float32) {
+	residuals := make([]float32, 0, opts.Iterations)
+	tracked := *opts
+	tracked.OnResidual = func(iter int, residual float32) {
+		residuals = append(residuals, residual)
+		if opts.OnResidual != nil {
+			opts.OnResidual(iter, residual)
+		}
+	}
+	uv = OpticFlowHornSchunkOptions(f1, f2, &tracked)
+	factor = ConvergenceFactor(residuals)
+	if interval := opts.logInterval(); interval > 1 {
+		// the residuals are LogInterval iterations apart
+		factor = float32(math.Pow(float64(factor), 1/float64(interval)))
+	}
+	return uv, factor
+}
+
 // MagImage generates a magnitude image from an optic flow
 // field and returns it as a single channel floatimage.FloatImg
 func MagImage(uv *floatimage.FloatImg) (magImg *floatimage.FloatImg) {
@@ -124,3 +509,45 @@ func MagImage(uv *floatimage.FloatImg) (magImg *floatimage.FloatImg) {
 	return
 
 }
+
+// VectorMagnitude generates a single channel image holding the Euclidean norm
+// over all channels of img at each pixel, for 2 channel flow fields it is
+// the same as MagImage
+func VectorMagnitude(img *floatimage.FloatImg) (magImg *floatimage.FloatImg) {
+	bounds := img.Bounds()
+	magImg = floatimage.NewFloatImg(bounds, 1)
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			var tmp float32
+			for _, v := range img.AtF(i, j) {
+				tmp += v * v
+			}
+			magImg.Set(i, j, 0, float32(math.Sqrt(float64(tmp))))
+		}
+	}
+	return
+}
+
+// AngleImage generates a single channel image holding the direction
+// atan2(v, u) of each flow vector in the range -π < angle <= π, or in
+// degrees (-180 < angle <= 180) if degrees is set
+func AngleImage(uv *floatimage.FloatImg, degrees bool) (angleImg *floatimage.FloatImg) {
+	bounds := uv.Bounds()
+	angleImg = floatimage.NewFloatImg(bounds, 1)
+	scale := 1.0
+	if degrees {
+		scale = 180.0 / math.Pi
+	}
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			vec := uv.AtF(i, j)
+			angle := math.Atan2(float64(vec[1]), float64(vec[0]))
+			// atan2 gives -π for v = -0, e.g. after NegateFlow
+			if angle <= -math.Pi {
+				angle = math.Pi
+			}
+			angleImg.Set(i, j, 0, float32(scale*angle))
+		}
+	}
+	return
+}
@@ -0,0 +1,593 @@
+package algorithms
+
+import (
+	"bytes"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLogInterval(t *testing.T) {
+	f1, f2 := shiftedPair(20, 20, 1, 0)
+	tests := []struct {
+		interval, snapEvery  int
+		iterations, residual []int
+		snapshots            []int
+	}{
+		{1, 4, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []int{4, 8, 12}},
+		{5, 2, []int{5, 10}, []int{5, 10}, []int{10}},
+		{0, 4, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []int{4, 8, 12}},
+		{-1, 1, nil, nil, nil},
+	}
+	for _, tc := range tests {
+		var iters, residuals, snaps []int
+		opts := &HornSchunkOptions{
+			Alpha:         100,
+			Iterations:    12,
+			LogInterval:   tc.interval,
+			SnapshotEvery: tc.snapEvery,
+			OnIteration:   func(iter int, uv *floatimage.FloatImg) { iters = append(iters, iter) },
+			OnResidual:    func(iter int, residual float32) { residuals = append(residuals, iter) },
+			OnSnapshot:    func(iter int, uv *floatimage.FloatImg) { snaps = append(snaps, iter) },
+		}
+		OpticFlowHornSchunkOptions(f1, f2, opts)
+		check := func(what string, got, want []int) {
+			if len(got) != len(want) {
+				t.Errorf("interval %d: %s at %v, want %v", tc.interval, what, got, want)
+				return
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("interval %d: %s at %v, want %v", tc.interval, what, got, want)
+					return
+				}
+			}
+		}
+		check("OnIteration", iters, tc.iterations)
+		check("OnResidual", residuals, tc.residual)
+		check("OnSnapshot", snaps, tc.snapshots)
+	}
+}
+
+func TestConvergenceFactor(t *testing.T) {
+	tests := []struct {
+		residuals []float32
+		want      float64
+	}{
+		{nil, 0},
+		{[]float32{1}, 0},
+		{[]float32{8, 4, 2, 1}, 0.5},
+		{[]float32{1, 0.9, 0.81, 0.729, 0.6561}, 0.9},
+		{[]float32{1, 0, 0}, 0},
+	}
+	for _, tc := range tests {
+		if got := ConvergenceFactor(tc.residuals); !near(float64(got), tc.want, 1e-6) {
+			t.Errorf("ConvergenceFactor(%v) = %f, want %f", tc.residuals, got, tc.want)
+		}
+	}
+}
+
+func TestSORConvergesFaster(t *testing.T) {
+	f1, f2 := shiftedPair(40, 40, 0.5, 0.25)
+	tests := []struct {
+		name  string
+		omega float32
+	}{
+		{"jacobi", 0},
+		{"gauss-seidel", 1},
+		{"sor", 1.8},
+	}
+	var prev float32
+	var jacobi *floatimage.FloatImg
+	for i, tc := range tests {
+		opts := &HornSchunkOptions{Alpha: 100, Iterations: 60, Omega: tc.omega, LogInterval: 1}
+		uv, factor := OpticFlowHornSchunkConvergence(f1, f2, opts)
+		if factor <= 0 || factor >= 1 {
+			t.Fatalf("%s: convergence factor %f, want 0 < factor < 1", tc.name, factor)
+		}
+		if i > 0 && factor >= prev {
+			t.Errorf("%s: convergence factor %f, want less than %f of %s", tc.name, factor, prev, tests[i-1].name)
+		}
+		prev = factor
+
+		// all methods approach the same solution
+		opts.Iterations = 3000
+		opts.LogInterval = -1
+		uv = OpticFlowHornSchunkOptions(f1, f2, opts)
+		if jacobi == nil {
+			jacobi = uv
+			continue
+		}
+		for j := range uv.Pix {
+			if !near(float64(uv.Pix[j]), float64(jacobi.Pix[j]), 1e-3) {
+				t.Errorf("%s: solution differs from jacobi at %d: %f != %f", tc.name, j, uv.Pix[j], jacobi.Pix[j])
+				break
+			}
+		}
+	}
+}
+
+func TestConvergenceLogInterval(t *testing.T) {
+	f1, f2 := shiftedPair(30, 30, 0.5, 0)
+	opts := &HornSchunkOptions{Alpha: 100, Iterations: 40, LogInterval: 1}
+	_, every := OpticFlowHornSchunkConvergence(f1, f2, opts)
+	opts.LogInterval = 4
+	_, sparse := OpticFlowHornSchunkConvergence(f1, f2, opts)
+	if !near(float64(every), float64(sparse), 0.01) {
+		t.Errorf("factor with interval 4 %f, with interval 1 %f", sparse, every)
+	}
+	// the default interval 0 tracks every iteration
+	opts.LogInterval = 0
+	if _, def := OpticFlowHornSchunkConvergence(f1, f2, opts); def != every {
+		t.Errorf("factor with the default interval %f, with interval 1 %f", def, every)
+	}
+	opts.LogInterval = -1
+	if _, none := OpticFlowHornSchunkConvergence(f1, f2, opts); none != 0 {
+		t.Errorf("factor without residuals %f, want 0", none)
+	}
+}
+
+func TestUpdateNormMatchesSerial(t *testing.T) {
+	f1, f2 := shiftedPair(50, 37, 0.3, 0.7)
+	old := OpticFlowHornSchunk(f1, f2, 100, 3)
+	uv := OpticFlowHornSchunk(f1, f2, 100, 4)
+	var sum float64
+	for i := range uv.Pix {
+		d := float64(uv.Pix[i] - old.Pix[i])
+		sum += d * d
+	}
+	for _, rows := range []int{0, 1, 7, 100} {
+		if got := updateNorm(old, uv, rows); !near(float64(got), math.Sqrt(sum), 1e-5) {
+			t.Errorf("rows %d: updateNorm %f, want %f", rows, got, math.Sqrt(sum))
+		}
+	}
+}
+
+// directionError is the mean absolute angle in radians between the gradient
+// of derivs and the axis at angle over the interior r.Inset(border), pixels
+// with a tiny gradient are skipped
+func directionError(derivs *floatimage.FloatImg, angle float64, border int) float64 {
+	r := derivs.Bounds().Inset(border)
+	var sum float64
+	var n int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := derivs.AtF(x, y)
+			if d[Fxc]*d[Fxc]+d[Fyc]*d[Fyc] < 1 {
+				continue
+			}
+			// the sign of the gradient alternates along the wave
+			diff := math.Mod(math.Atan2(float64(d[Fyc]), float64(d[Fxc]))-angle+2*math.Pi, math.Pi)
+			sum += math.Min(diff, math.Pi-diff)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+func TestDerivScharrDirection(t *testing.T) {
+	var sobelTotal, scharrTotal float64
+	for _, deg := range []float64{10, 22.5, 30, 60, 75} {
+		angle := deg * math.Pi / 180
+		img := floatimage.Sinusoid(48, 48, 0.2, float32(angle)).AddDummies()
+		errs := make(map[DerivMode]float64)
+		for _, mode := range []DerivMode{DerivCentral, DerivSobel, DerivScharr} {
+			derivs := deriveMixed(img, img, &HornSchunkOptions{Deriv: mode}, floatimage.NewFloatImg(img.Bounds(), 3))
+			errs[mode] = directionError(derivs, angle, 2)
+		}
+		if errs[DerivScharr] > errs[DerivSobel] {
+			t.Errorf("%v°: Scharr direction error %f exceeds Sobel's %f", deg, errs[DerivScharr], errs[DerivSobel])
+		}
+		sobelTotal += errs[DerivSobel]
+		scharrTotal += errs[DerivScharr]
+	}
+	if scharrTotal > 0.5*sobelTotal {
+		t.Errorf("Scharr direction error %f isn't clearly below Sobel's %f", scharrTotal, sobelTotal)
+	}
+}
+
+// iterationsTo returns the first iteration after which the endpoint error of
+// the flow seeded with init against the true flow (u, v) is below epe, or
+// opts.Iterations+1 if it never is
+func iterationsTo(f1, f2, init *floatimage.FloatImg, u, v float32, epe float64, opts HornSchunkOptions) int {
+	first := opts.Iterations + 1
+	opts.LogInterval = 1
+	opts.OnIteration = func(iter int, uv *floatimage.FloatImg) {
+		if iter < first && meanEPE(uv, u, v, 3) < epe {
+			first = iter
+		}
+	}
+	if _, err := OpticFlowHornSchunkInitOptions(f1, f2, init, &opts); err != nil {
+		return -1
+	}
+	return first
+}
+
+func TestOpticFlowHornSchunkInit(t *testing.T) {
+	f1, f2 := shiftedPair(32, 32, 1, 0.5)
+	bounds := f1.Bounds()
+	opts := HornSchunkOptions{Alpha: 20, Iterations: 600}
+	cold := iterationsTo(f1, f2, constantFlow(bounds, 0, 0), 1, 0.5, 0.04, opts)
+	tests := []struct {
+		name string
+		u, v float32
+		max  int
+	}{
+		{"true flow", 1, 0.5, 1},
+		{"close", 0.9, 0.45, cold / 4},
+	}
+	for _, tt := range tests {
+		got := iterationsTo(f1, f2, constantFlow(bounds, tt.u, tt.v), 1, 0.5, 0.04, opts)
+		if got < 1 || got > tt.max {
+			t.Errorf("%s: converged after %d iterations, want <= %d (cold start %d)", tt.name, got, tt.max, cold)
+		}
+	}
+	if cold <= 100 {
+		t.Errorf("cold start converged after only %d iterations", cold)
+	}
+}
+
+func TestOpticFlowHornSchunkInitInvalid(t *testing.T) {
+	f1, f2 := shiftedPair(8, 8, 1, 0)
+	bounds := f1.Bounds()
+	tests := []struct {
+		name string
+		init *floatimage.FloatImg
+	}{
+		{"1 channel", floatimage.NewFloatImg(bounds, 1)},
+		{"3 channels", floatimage.NewFloatImg(bounds, 3)},
+		{"smaller", floatimage.NewFloatImg(bounds.Inset(1), 2)},
+		{"moved", floatimage.NewFloatImg(bounds.Add(image.Point{1, 0}), 2)},
+	}
+	for _, tt := range tests {
+		if _, err := OpticFlowHornSchunkInit(f1, f2, tt.init, 10, 5); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestVectorMagnitude(t *testing.T) {
+	tests := []struct {
+		vec  []float32
+		want float32
+	}{
+		{[]float32{0, 0, 0}, 0},
+		{[]float32{1, 2, 2}, 3},
+		{[]float32{-2, 3, -6}, 7},
+		{[]float32{0, 0, -5}, 5},
+		{[]float32{4, 4, 7}, 9},
+	}
+	r := image.Rect(2, 1, 2+len(tests), 2)
+	img := floatimage.NewFloatImg(r, 3)
+	for i, tt := range tests {
+		copy(img.AtF(r.Min.X+i, 1), tt.vec)
+	}
+	mag := VectorMagnitude(img)
+	if mag.Chancnt != 1 || mag.Bounds() != r {
+		t.Fatalf("magnitude with %d channels and bounds %v", mag.Chancnt, mag.Bounds())
+	}
+	for i, tt := range tests {
+		if got := mag.AtF(r.Min.X+i, 1)[0]; got != tt.want {
+			t.Errorf("|%v| = %f, want %f", tt.vec, got, tt.want)
+		}
+	}
+
+	// for 2 channels it matches MagImage
+	flow := constantFlow(image.Rect(0, 0, 4, 4), 0, 0)
+	for i := range flow.Pix {
+		flow.Pix[i] = float32(i%7) - 3.5
+	}
+	want := MagImage(flow)
+	for i, v := range VectorMagnitude(flow).Pix {
+		if v != want.Pix[i] {
+			t.Fatalf("pixel %d: %f, MagImage %f", i, v, want.Pix[i])
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	f1, f2 := shiftedPair(20, 20, 1, 0.5)
+	tests := []struct {
+		every, iterations, count int
+	}{
+		{1, 5, 5},
+		{4, 20, 5},
+		{7, 20, 2},
+		{30, 20, 0},
+		{0, 20, 0},
+	}
+	for _, tt := range tests {
+		var snaps []*floatimage.FloatImg
+		var last *floatimage.FloatImg
+		opts := &HornSchunkOptions{
+			Alpha:         20,
+			Iterations:    tt.iterations,
+			LogInterval:   1,
+			SnapshotEvery: tt.every,
+			OnSnapshot:    func(iter int, uv *floatimage.FloatImg) { snaps = append(snaps, uv) },
+			OnIteration:   func(iter int, uv *floatimage.FloatImg) { last = uv },
+		}
+		uv := OpticFlowHornSchunkOptions(f1, f2, opts)
+		if len(snaps) != tt.count {
+			t.Errorf("every %d of %d: %d snapshots, want %d", tt.every, tt.iterations, len(snaps), tt.count)
+			continue
+		}
+		for i, snap := range snaps {
+			if &snap.Pix[0] == &uv.Pix[0] || (last != nil && &snap.Pix[0] == &last.Pix[0]) {
+				t.Errorf("every %d: snapshot %d shares Pix with the solver", tt.every, i)
+			}
+			if i > 0 && meanEPE(snap, 1, 0.5, 3) >= meanEPE(snaps[i-1], 1, 0.5, 3) {
+				t.Errorf("every %d: snapshot %d doesn't improve on the previous one", tt.every, i)
+			}
+		}
+	}
+}
+
+func TestAngleImage(t *testing.T) {
+	negZero := float32(math.Copysign(0, -1))
+	tests := []struct {
+		u, v    float32
+		radians float64
+	}{
+		{1, 0, 0},
+		{0, 1, math.Pi / 2},
+		{0, -1, -math.Pi / 2},
+		{-1, 1, 3 * math.Pi / 4},
+		{-1, -1, -3 * math.Pi / 4},
+		{2, -2, -math.Pi / 4},
+		// the wraparound, -π is mapped to π
+		{-1, 0, math.Pi},
+		{-1, negZero, math.Pi},
+		{-1, 1e-6, math.Pi - 1e-6},
+		{-1, -1e-6, -math.Pi + 1e-6},
+		{0, 0, 0},
+	}
+	r := image.Rect(0, 0, len(tests), 1)
+	flow := floatimage.NewFloatImg(r, 2)
+	for x, tt := range tests {
+		flow.Set(x, 0, 0, tt.u)
+		flow.Set(x, 0, 1, tt.v)
+	}
+	radians, degrees := AngleImage(flow, false), AngleImage(flow, true)
+	for x, tt := range tests {
+		if got := radians.AtF(x, 0)[0]; !near(float64(got), tt.radians, 1e-6) {
+			t.Errorf("(%v, %v): %f radians, want %f", tt.u, tt.v, got, tt.radians)
+		}
+		want := tt.radians * 180 / math.Pi
+		if got := degrees.AtF(x, 0)[0]; !near(float64(got), want, 1e-4) {
+			t.Errorf("(%v, %v): %f degrees, want %f", tt.u, tt.v, got, want)
+		}
+	}
+}
+
+func TestNoDummies(t *testing.T) {
+	f1, f2 := shiftedPair(32, 24, 1, 0.5)
+	plain1, plain2 := f1.Dedummify().Clone(), f2.Dedummify().Clone()
+	tests := []struct {
+		name  string
+		deriv DerivMode
+		omega float32
+	}{
+		{"jacobi", DerivCentral, 0},
+		{"sor", DerivCentral, 1.5},
+		{"sobel", DerivSobel, 0},
+	}
+	for _, tt := range tests {
+		opts := &HornSchunkOptions{Alpha: 20, Iterations: 200, Deriv: tt.deriv, Omega: tt.omega}
+		dummied := OpticFlowHornSchunkOptions(f1, f2, opts)
+		opts.NoDummies = true
+		plain := OpticFlowHornSchunkOptions(plain1, plain2, opts)
+		if plain.Bounds() != plain1.Bounds() {
+			t.Fatalf("%s: flow bounds %v, want %v", tt.name, plain.Bounds(), plain1.Bounds())
+		}
+		// the boundary handling differs, away from it the flows agree
+		r := plain.Bounds().Inset(5)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				a, b := plain.AtF(x, y), dummied.AtF(x, y)
+				if d := math.Hypot(float64(a[0]-b[0]), float64(a[1]-b[1])); d > 0.05 {
+					t.Fatalf("%s: flows at %d, %d differ by %f", tt.name, x, y, d)
+				}
+			}
+		}
+		plainEPE, dummiedEPE := meanEPE(plain, 1, 0.5, 0), meanEPE(dummied.Dedummify(), 1, 0.5, 0)
+		if plainEPE > 1.2*dummiedEPE+0.01 {
+			t.Errorf("%s: EPE %f without dummies, %f with", tt.name, plainEPE, dummiedEPE)
+		}
+	}
+}
+
+func TestOpticFlowHornSchunkBudget(t *testing.T) {
+	f1, f2 := shiftedPair(64, 64, 1, 0.5)
+	// the derivatives count towards the budget, so tiny budgets may not
+	// complete a single sweep
+	tests := []struct {
+		budget             time.Duration
+		minIters, maxIters int
+	}{
+		{0, 0, 0},
+		{time.Microsecond, 0, 1},
+		{2 * time.Millisecond, 0, 1000},
+		{20 * time.Millisecond, 1, 10000},
+	}
+	prev := -1
+	for _, tt := range tests {
+		start := time.Now()
+		uv, iterations := OpticFlowHornSchunkBudget(f1, f2, 20, tt.budget)
+		elapsed := time.Since(start)
+		// a single sweep of 64x64 takes far less than 100ms
+		if elapsed > tt.budget+100*time.Millisecond {
+			t.Errorf("budget %v: returned after %v", tt.budget, elapsed)
+		}
+		if iterations < tt.minIters || iterations > tt.maxIters {
+			t.Errorf("budget %v: %d iterations, want %d to %d", tt.budget, iterations, tt.minIters, tt.maxIters)
+		}
+		if iterations < prev {
+			t.Errorf("budget %v: %d iterations, fewer than %d with a smaller budget", tt.budget, iterations, prev)
+		}
+		prev = iterations
+		// completed sweeps match the fixed iteration solver
+		want := OpticFlowHornSchunk(f1, f2, 20, iterations)
+		for i := range uv.Pix {
+			if uv.Pix[i] != want.Pix[i] {
+				t.Errorf("budget %v: flow differs from %d fixed iterations", tt.budget, iterations)
+				break
+			}
+		}
+	}
+}
+
+func TestMagImageSubImage(t *testing.T) {
+	flow := randomFlow(image.Rect(0, 0, 12, 10), 3, 7)
+	for _, r := range []image.Rectangle{
+		image.Rect(3, 2, 9, 7),
+		image.Rect(1, 4, 12, 10),
+		image.Rect(0, 0, 5, 5),
+	} {
+		sub := flow.SubImage(r)
+		// the same region as standalone image at the origin
+		alone := floatimage.NewFloatImg(image.Rect(0, 0, r.Dx(), r.Dy()), 2)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				copy(alone.AtF(x-r.Min.X, y-r.Min.Y), sub.AtF(x, y))
+			}
+		}
+		subMag, aloneMag := MagImage(sub), MagImage(alone)
+		if subMag.Bounds() != r {
+			t.Errorf("%v: magnitude bounds %v", r, subMag.Bounds())
+			continue
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if got, want := subMag.AtF(x, y)[0], aloneMag.AtF(x-r.Min.X, y-r.Min.Y)[0]; got != want {
+					t.Errorf("%v: magnitude at (%d, %d) is %f, standalone %f", r, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOpticFlowFromDerivatives(t *testing.T) {
+	tests := []struct {
+		name       string
+		dx, dy     float64
+		alpha      float32
+		iterations int
+	}{
+		{"no iterations", 1, 0, 100, 0},
+		{"single iteration", 0.5, -0.25, 100, 1},
+		{"small alpha", 1, 0.5, 10, 50},
+		{"large alpha", -0.75, 1, 400, 120},
+	}
+	for _, tt := range tests {
+		f1, f2 := shiftedPair(30, 24, tt.dx, tt.dy)
+		want := OpticFlowHornSchunk(f1, f2, tt.alpha, tt.iterations)
+		derivs := ComputeDerivatives(f1, f2)
+		if derivs.Chancnt != 3 || derivs.Bounds() != f1.Bounds() {
+			t.Fatalf("%s: derivatives with %d channels and bounds %v", tt.name, derivs.Chancnt, derivs.Bounds())
+		}
+
+		// the derivatives survive being saved and loaded again
+		var buf bytes.Buffer
+		if err := floatimage.WriteFloatImg(&buf, derivs); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := floatimage.ReadFloatImg(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, d := range []*floatimage.FloatImg{derivs, loaded} {
+			got := OpticFlowFromDerivatives(d, tt.alpha, tt.iterations)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("%s: flow bounds %v, want %v", tt.name, got.Bounds(), want.Bounds())
+			}
+			for i := range want.Pix {
+				if got.Pix[i] != want.Pix[i] {
+					t.Errorf("%s: flow differs at %d: %f != %f", tt.name, i, got.Pix[i], want.Pix[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+// periodicPair returns w x h images with dummy borders of a pattern with
+// whole periods across the image, the second one moved by (dx, 0) and
+// circularly shifted by roll columns
+func periodicPair(w, h int, dx float64, roll int) (f1, f2 *floatimage.FloatImg) {
+	periodic := func(x, y float64) float32 {
+		fx, fy := x/float64(w), y/float64(h)
+		return float32(127.5 + 50*math.Sin(2*math.Pi*(2*fx+fy)) + 40*math.Cos(2*math.Pi*(2*fy-fx)))
+	}
+	f1 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	f2 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			f1.Set(x, y, 0, periodic(float64(x-roll), float64(y)))
+			f2.Set(x, y, 0, periodic(float64(x-roll)-dx, float64(y)))
+		}
+	}
+	return f1.AddDummies(), f2.AddDummies()
+}
+
+func TestWrapSeam(t *testing.T) {
+	const w, h = 32, 24
+	// mean endpoint error against (0.5, 0) in the columns x
+	columnEPE := func(uv *floatimage.FloatImg, xs ...int) float64 {
+		var sum float64
+		for y := 0; y < h; y++ {
+			for _, x := range xs {
+				vec := uv.AtF(x, y)
+				sum += math.Hypot(float64(vec[0])-0.5, float64(vec[1]))
+			}
+		}
+		return sum / float64(h*len(xs))
+	}
+	f1, f2 := periodicPair(w, h, 0.5, 0)
+	tests := []struct {
+		name  string
+		omega float32
+	}{
+		{"jacobi", 0},
+		{"sor", 1.5},
+	}
+	for _, tc := range tests {
+		opts := &HornSchunkOptions{Alpha: 100, Iterations: 2000, Omega: tc.omega}
+		clamped := OpticFlowHornSchunkOptions(f1, f2, opts)
+		opts.Wrap = true
+		wrapped := OpticFlowHornSchunkOptions(f1, f2, opts)
+
+		// across the seam the wrapped flow is as good as in the middle while
+		// the replicated border disturbs it
+		seam, middle := columnEPE(wrapped, 0, w-1), columnEPE(wrapped, w/2-1, w/2)
+		if seam > 0.02 || seam > 1.1*middle {
+			t.Errorf("%s: wrapped error %f at the seam, %f in the middle", tc.name, seam, middle)
+		}
+		if clampedSeam := columnEPE(clamped, 0, w-1); clampedSeam < 5*seam {
+			t.Errorf("%s: error at the border %f without wrapping, %f with", tc.name, clampedSeam, seam)
+		}
+
+		// moving the seam by rolling the images rolls the flow with them
+		const roll = 11
+		r1, r2 := periodicPair(w, h, 0.5, roll)
+		rolled := OpticFlowHornSchunkOptions(r1, r2, opts)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				got, want := rolled.AtF((x+roll)%w, y), wrapped.AtF(x, y)
+				if !near(float64(got[0]), float64(want[0]), 1e-3) || !near(float64(got[1]), float64(want[1]), 1e-3) {
+					t.Fatalf("%s: rolled flow at (%d, %d) is %v, want %v", tc.name, (x+roll)%w, y, got, want)
+				}
+			}
+		}
+
+		// the dummy border of the flow stays 0
+		for _, p := range []image.Point{{-1, -1}, {-1, 5}, {w, 7}, {3, h}} {
+			if vec := wrapped.AtF(p.X, p.Y); vec[0] != 0 || vec[1] != 0 {
+				t.Errorf("%s: dummy border at %v is %v", tc.name, p, vec)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package algorithms
+
+import (
+	"errors"
+	"fmt"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+)
+
+// PSNR computes the peak signal to noise ratio in dB between channel 0 of the
+// equally sized images a and b assuming a peak value of 255. Pixels are
+// compared relative to the origin of each image. Identical images give +Inf
+func PSNR(a, b *floatimage.FloatImg) (float32, error) {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	if boundsA.Size() != boundsB.Size() {
+		return 0, fmt.Errorf("image sizes %v and %v don't match", boundsA.Size(), boundsB.Size())
+	}
+	if a.Chancnt != b.Chancnt {
+		return 0, fmt.Errorf("channel counts %d and %d don't match", a.Chancnt, b.Chancnt)
+	}
+	if boundsA.Empty() {
+		return 0, errors.New("psnr of empty images")
+	}
+	var sum float64
+	for y := 0; y < boundsA.Dy(); y++ {
+		for x := 0; x < boundsA.Dx(); x++ {
+			d := float64(a.AtF(boundsA.Min.X+x, boundsA.Min.Y+y)[0] - b.AtF(boundsB.Min.X+x, boundsB.Min.Y+y)[0])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(boundsA.Dx()*boundsA.Dy())
+	if mse == 0 {
+		return float32(math.Inf(1)), nil
+	}
+	return float32(10 * math.Log10(255*255/mse)), nil
+}
+
+// ssimSigma is the standard deviation of the standard 11 x 11 SSIM window
+const ssimSigma = 1.5
+
+// ssimKernel returns the normalized 1D Gaussian of length windowSize, its
+// standard deviation scales with the window so that 11 gives the standard
+// σ = 1.5
+func ssimKernel(windowSize int) []float32 {
+	sigma := ssimSigma * float64(windowSize) / 11
+	kernel := make([]float32, windowSize)
+	var sum float32
+	for i := range kernel {
+		d := float64(i - windowSize/2)
+		kernel[i] = float32(math.Exp(-d * d / (2 * sigma * sigma)))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// SSIM computes the mean structural similarity index of Wang et al. between
+// channel 0 of the equally sized images a and b, compared relative to their
+// origins, assuming a dynamic range of 255. The local means, variances and
+// covariance are weighted by a separable windowSize x windowSize Gaussian
+// window, windowSize needs to be odd and at least 3, 11 gives the standard
+// σ = 1.5 window. Like the reference implementation the mean only covers the
+// pixels whose window lies completely inside of the images. Identical images
+// give 1
+func SSIM(a, b *floatimage.FloatImg, windowSize int) (float32, error) {
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	const c2 = (0.03 * 255) * (0.03 * 255)
+	if windowSize < 3 || windowSize%2 == 0 {
+		return 0, fmt.Errorf("ssim window size %d needs to be odd and at least 3", windowSize)
+	}
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	if boundsA.Size() != boundsB.Size() {
+		return 0, fmt.Errorf("image sizes %v and %v don't match", boundsA.Size(), boundsB.Size())
+	}
+	w, h := boundsA.Dx(), boundsA.Dy()
+	if w < windowSize || h < windowSize {
+		return 0, fmt.Errorf("ssim of %dx%d images needs at least a %dx%d window", w, h, windowSize, windowSize)
+	}
+	kernel := ssimKernel(windowSize)
+	// products builds the window means of fn(va, vb) in a common frame
+	products := func(fn func(va, vb float32) float32) *floatimage.FloatImg {
+		img := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				va := a.AtF(boundsA.Min.X+x, boundsA.Min.Y+y)[0]
+				vb := b.AtF(boundsB.Min.X+x, boundsB.Min.Y+y)[0]
+				img.Set(x, y, 0, fn(va, vb))
+			}
+		}
+		return img.ConvolveSeparable(kernel, kernel)
+	}
+	meanA := products(func(va, vb float32) float32 { return va })
+	meanB := products(func(va, vb float32) float32 { return vb })
+	meanAA := products(func(va, vb float32) float32 { return va * va })
+	meanBB := products(func(va, vb float32) float32 { return vb * vb })
+	meanAB := products(func(va, vb float32) float32 { return va * vb })
+
+	valid := image.Rect(0, 0, w, h).Inset(windowSize / 2)
+	var sum float64
+	for y := valid.Min.Y; y < valid.Max.Y; y++ {
+		for x := valid.Min.X; x < valid.Max.X; x++ {
+			ma, mb := float64(meanA.AtF(x, y)[0]), float64(meanB.AtF(x, y)[0])
+			varA := float64(meanAA.AtF(x, y)[0]) - ma*ma
+			varB := float64(meanBB.AtF(x, y)[0]) - mb*mb
+			cov := float64(meanAB.AtF(x, y)[0]) - ma*mb
+			sum += (2*ma*mb + c1) * (2*cov + c2) / ((ma*ma + mb*mb + c1) * (varA + varB + c2))
+		}
+	}
+	return float32(sum / float64(valid.Dx()*valid.Dy())), nil
+}
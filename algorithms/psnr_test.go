@@ -0,0 +1,136 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+// texture is a single channel test image without dummy borders with fine
+// detail from a checkerboard of 2 pixel squares on the smooth pattern
+func texture(w, h int) *floatimage.FloatImg {
+	f1, _ := shiftedPair(w, h, 0, 0)
+	img := f1.Dedummify().Clone()
+	for i, v := range floatimage.Checkerboard(w, h, 2).Pix {
+		img.Pix[i] = img.Pix[i]/2 + v/4
+	}
+	return img
+}
+
+func TestSSIM(t *testing.T) {
+	img := texture(48, 40)
+	noisy := img.Clone()
+	for i := range noisy.Pix {
+		noisy.Pix[i] += 4 * (float32(i%7) - 3)
+	}
+	tests := []struct {
+		name     string
+		b        *floatimage.FloatImg
+		min, max float32
+	}{
+		// identical images
+		{"identical", img, 1, 1},
+		// the same image moved to another origin
+		{"reorigined", img.Reorigin(image.Point{-7, 30}), 1, 1},
+		// a Gaussian blur with sigma 0.8 mostly removes the checkerboard,
+		// the SSIM drops to about 0.51
+		{"blurred", img.GaussianBlur(0.8), 0.49, 0.53},
+		// ±12 gray levels of noise leave the structure intact, about 0.97
+		{"noisy", noisy, 0.96, 0.99},
+	}
+	for _, tc := range tests {
+		got, err := SSIM(img, tc.b, 11)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got < tc.min-1e-5 || got > tc.max+1e-5 {
+			t.Errorf("%s: SSIM %f, want %f..%f", tc.name, got, tc.min, tc.max)
+		}
+		sym, _ := SSIM(tc.b, img, 11)
+		if !near(float64(sym), float64(got), 1e-5) {
+			t.Errorf("%s: SSIM isn't symmetric, %f != %f", tc.name, sym, got)
+		}
+	}
+}
+
+func TestSSIMInvalid(t *testing.T) {
+	img := texture(20, 15)
+	tests := []struct {
+		name   string
+		b      *floatimage.FloatImg
+		window int
+	}{
+		{"zero window", img, 0},
+		{"single pixel window", img, 1},
+		{"even window", img, 8},
+		{"negative window", img, -3},
+		{"window larger than the image", img, 17},
+		{"size mismatch", texture(20, 16), 7},
+	}
+	for _, tc := range tests {
+		if _, err := SSIM(img, tc.b, tc.window); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+}
+
+// grid returns an image covering r with the channel values vals given pixel
+// by pixel in row major order
+func grid(r image.Rectangle, chancnt int, vals ...float32) *floatimage.FloatImg {
+	img := floatimage.NewFloatImg(r, chancnt)
+	copy(img.Pix, vals)
+	return img
+}
+
+func TestPSNR(t *testing.T) {
+	r := image.Rect(0, 0, 2, 2)
+	a := grid(r, 1, 10, 20, 30, 40)
+	tests := []struct {
+		name string
+		a, b *floatimage.FloatImg
+		want float64
+	}{
+		{"identical", a, a.Clone(), math.Inf(1)},
+		// differences 0, 2, -3, 0 give MSE 13/4
+		{"known difference", a, grid(r, 1, 10, 22, 27, 40), 10 * math.Log10(255*255/3.25)},
+		{"off by one", a, grid(r, 1, 11, 21, 31, 41), 10 * math.Log10(255*255)},
+		{"full range", grid(r, 1, 0, 0, 0, 0), grid(r, 1, 255, 255, 255, 255), 0},
+		{"other origin", a, grid(image.Rect(-3, 5, -1, 7), 1, 10, 22, 27, 40), 10 * math.Log10(255*255/3.25)},
+		// only channel 0 counts
+		{"second channel", grid(r, 2, 10, 0, 20, 0, 30, 0, 40, 0), grid(r, 2, 10, 99, 22, 99, 27, 99, 40, 99), 10 * math.Log10(255*255/3.25)},
+	}
+	for _, tt := range tests {
+		got, err := PSNR(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if math.IsInf(tt.want, 1) {
+			if !math.IsInf(float64(got), 1) {
+				t.Errorf("%s: PSNR %f, want +Inf", tt.name, got)
+			}
+			continue
+		}
+		if math.Abs(float64(got)-tt.want) > 1e-4 {
+			t.Errorf("%s: PSNR %f, want %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPSNRInvalid(t *testing.T) {
+	a := grid(image.Rect(0, 0, 2, 2), 1, 10, 20, 30, 40)
+	tests := []struct {
+		name string
+		a, b *floatimage.FloatImg
+	}{
+		{"size mismatch", a, floatimage.NewFloatImg(image.Rect(0, 0, 2, 3), 1)},
+		{"channel mismatch", a, floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), 2)},
+		{"empty", floatimage.NewFloatImg(image.Rect(0, 0, 0, 0), 1), floatimage.NewFloatImg(image.Rect(0, 0, 0, 0), 1)},
+	}
+	for _, tt := range tests {
+		if _, err := PSNR(tt.a, tt.b); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
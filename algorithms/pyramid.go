@@ -0,0 +1,165 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+)
+
+// minPyramidSize is the smallest interior width or height of a pyramid level
+const minPyramidSize = 8
+
+// PyramidOptions holds the parameters of the coarse to fine solver
+type PyramidOptions struct {
+	HornSchunkOptions
+	// Levels is the maximum number of pyramid levels, 1 is plain Horn & Schunk
+	Levels int
+	// Warps is the number of times each level warps f2 by the current flow
+	// and solves for an increment, values < 1 mean a single solve
+	Warps int
+	// ReuseBuffers preallocates the solver buffers at the finest level and
+	// reuses them for all coarser levels instead of allocating on each level
+	ReuseBuffers bool
+	// SmoothProlong smoothes the flow carried over from a coarser level with
+	// a [1,2,1]/4 binomial filter after the bilinear upsampling to avoid
+	// blocky artifacts in the refined flow
+	SmoothProlong bool
+}
+
+// prolongKernel is the binomial kernel used for SmoothProlong
+var prolongKernel = []float32{0.25, 0.5, 0.25}
+
+// downsample halves the interior of the image with dummy borders img by
+// averaging 2x2 blocks, the result has dummy borders applied and its
+// interior starts at the same point as that of img
+func downsample(img *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := img.Bounds()
+	o := bounds.Min.Add(image.Point{1, 1})
+	w, h := bounds.Dx()-2, bounds.Dy()-2
+	cw, ch := (w+1)/2, (h+1)/2
+	coarse := floatimage.NewFloatImg(image.Rect(o.X-1, o.Y-1, o.X+cw+1, o.Y+ch+1), img.Chancnt)
+	for y := 0; y < ch; y++ {
+		for x := 0; x < cw; x++ {
+			x0, y0 := 2*x, 2*y
+			x1, y1 := x0+1, y0+1
+			if x1 >= w {
+				x1 = x0
+			}
+			if y1 >= h {
+				y1 = y0
+			}
+			c00, c10 := img.AtF(o.X+x0, o.Y+y0), img.AtF(o.X+x1, o.Y+y0)
+			c01, c11 := img.AtF(o.X+x0, o.Y+y1), img.AtF(o.X+x1, o.Y+y1)
+			out := coarse.AtF(o.X+x, o.Y+y)
+			for c := range out {
+				out[c] = (c00[c] + c10[c] + c01[c] + c11[c]) / 4
+			}
+		}
+	}
+	coarse.Dummies()
+	return coarse
+}
+
+// upsampleFlow bilinearly interpolates the coarse flow field onto the grid of
+// fine and scales the vectors by 2 to match the finer resolution
+func upsampleFlow(coarse, fine *floatimage.FloatImg) {
+	bounds := fine.Bounds()
+	o := bounds.Min.Add(image.Point{1, 1})
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			// pixel centers of the fine level in coarse coordinates
+			x := float32(o.X) + (float32(i-o.X)+0.5)/2 - 0.5
+			y := float32(o.Y) + (float32(j-o.Y)+0.5)/2 - 0.5
+			vec := fine.AtF(i, j)
+			coarse.AtBilinear(x, y, vec)
+			vec[0] *= 2
+			vec[1] *= 2
+		}
+	}
+}
+
+// pyramidBuffers holds the per level working images of the pyramid solver
+type pyramidBuffers struct {
+	reuse                                  bool
+	derivs, uv, uvOld, warped, total, prev *floatimage.FloatImg
+}
+
+// get returns a zeroed image for r with channelCount channels either
+// recycling *buf or allocating a fresh one
+func (b *pyramidBuffers) get(buf **floatimage.FloatImg, r image.Rectangle, channelCount int) *floatimage.FloatImg {
+	if !b.reuse {
+		return floatimage.NewFloatImg(r, channelCount)
+	}
+	*buf = (*buf).Recycle(r, channelCount)
+	return *buf
+}
+
+// OpticFlowPyramid computes the optic flow between f1 and f2 coarse to fine.
+// On each level the Horn & Schunk solver computes a flow increment between f1
+// and f2 warped by the flow carried over from the coarser level, with
+// opts.Warps > 1 this is repeated with f2 warped by the refined flow.
+// Like OpticFlowHornSchunk the images need to have dummy borders applied
+func OpticFlowPyramid(f1, f2 *floatimage.FloatImg, opts *PyramidOptions) *floatimage.FloatImg {
+	pyr1 := []*floatimage.FloatImg{f1}
+	pyr2 := []*floatimage.FloatImg{f2}
+	for len(pyr1) < opts.Levels {
+		last := pyr1[len(pyr1)-1].Bounds()
+		if (last.Dx()-2)/2 < minPyramidSize || (last.Dy()-2)/2 < minPyramidSize {
+			break
+		}
+		pyr1 = append(pyr1, downsample(pyr1[len(pyr1)-1]))
+		pyr2 = append(pyr2, downsample(pyr2[len(pyr2)-1]))
+	}
+
+	bufs := &pyramidBuffers{reuse: opts.ReuseBuffers}
+	if bufs.reuse {
+		// allocate at the finest level so all coarser levels fit
+		bounds := f1.Bounds()
+		bufs.derivs = floatimage.NewFloatImg(bounds, 3)
+		bufs.uv = floatimage.NewFloatImg(bounds, 2)
+		bufs.uvOld = floatimage.NewFloatImg(bounds, 2)
+		bufs.warped = floatimage.NewFloatImg(bounds, f2.Chancnt)
+		bufs.total = floatimage.NewFloatImg(bounds, 2)
+		bufs.prev = floatimage.NewFloatImg(bounds, 2)
+	}
+
+	warps := opts.Warps
+	if warps < 1 {
+		warps = 1
+	}
+
+	var total *floatimage.FloatImg
+	for level := len(pyr1) - 1; level >= 0; level-- {
+		l1, l2 := pyr1[level], pyr2[level]
+		bounds := l1.Bounds()
+
+		// carry the flow over from the coarser level, total and prev swap
+		// roles so the coarse flow isn't overwritten while upsampling
+		bufs.total, bufs.prev = bufs.prev, bufs.total
+		coarse := total
+		total = bufs.get(&bufs.total, bounds, 2)
+		if coarse != nil {
+			upsampleFlow(coarse, total)
+			if opts.SmoothProlong {
+				total.Copy(total.ConvolveSeparable(prolongKernel, prolongKernel))
+			}
+		}
+
+		for w := 0; w < warps; w++ {
+			// nothing to warp by on the first solve of the coarsest level
+			warped := l2
+			if coarse != nil || w > 0 {
+				warped = warpBackwardInto(bufs.get(&bufs.warped, bounds, l2.Chancnt), l2, total)
+			}
+
+			derivs := deriveMixed(l1, warped, &opts.HornSchunkOptions, bufs.get(&bufs.derivs, bounds, 3))
+			uv := bufs.get(&bufs.uv, bounds, 2)
+			uvOld := bufs.get(&bufs.uvOld, bounds, 2)
+			iterate(derivs, uvOld, uv, &opts.HornSchunkOptions)
+
+			for i := range total.Pix {
+				total.Pix[i] += uv.Pix[i]
+			}
+		}
+	}
+	return total
+}
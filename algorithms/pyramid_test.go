@@ -0,0 +1,120 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"testing"
+)
+
+func TestOpticFlowPyramidWarps(t *testing.T) {
+	// a single level only linearizes around zero, the motion is too large
+	// for that and has to be recovered by warping
+	f1, f2 := shiftedPair(64, 64, 3, -2)
+	tests := []struct {
+		warps  int
+		maxEPE float64
+	}{
+		{1, 1},
+		{3, 0.02},
+	}
+	for _, tc := range tests {
+		opts := &PyramidOptions{
+			HornSchunkOptions: HornSchunkOptions{Alpha: 100, Iterations: 1000},
+			Levels:            1,
+			Warps:             tc.warps,
+		}
+		epe := meanEPE(OpticFlowPyramid(f1, f2, opts), 3, -2, 16)
+		if epe > tc.maxEPE {
+			t.Errorf("%d warps: EPE %f, want <= %f", tc.warps, epe, tc.maxEPE)
+		}
+		if tc.warps == 1 && epe < 0.1 {
+			t.Errorf("1 warp: EPE %f, the test needs a motion that requires warping", epe)
+		}
+	}
+}
+
+func TestOpticFlowPyramidReuseBuffers(t *testing.T) {
+	f1, f2 := shiftedPair(50, 40, 1.5, 1)
+	for _, smooth := range []bool{false, true} {
+		opts := &PyramidOptions{
+			HornSchunkOptions: HornSchunkOptions{Alpha: 100, Iterations: 20},
+			Levels:            3,
+			Warps:             2,
+			SmoothProlong:     smooth,
+		}
+		naive := OpticFlowPyramid(f1, f2, opts)
+		opts.ReuseBuffers = true
+		reused := OpticFlowPyramid(f1, f2, opts)
+		for i := range naive.Pix {
+			if naive.Pix[i] != reused.Pix[i] {
+				t.Fatalf("smooth %v: reused buffers differ at %d: %f != %f", smooth, i, reused.Pix[i], naive.Pix[i])
+			}
+		}
+	}
+}
+
+// flowRoughness is the mean squared difference of neighboring flow vectors
+// in the interior of flow, lower is smoother
+func flowRoughness(flow *floatimage.FloatImg) float64 {
+	bounds := flow.Bounds()
+	var sum float64
+	var n int
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-2; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-2; x++ {
+			vec, right, down := flow.AtF(x, y), flow.AtF(x+1, y), flow.AtF(x, y+1)
+			for c := 0; c < 2; c++ {
+				dx, dy := float64(right[c]-vec[c]), float64(down[c]-vec[c])
+				sum += dx*dx + dy*dy
+			}
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+func TestOpticFlowPyramidSmoothProlong(t *testing.T) {
+	// with few iterations per level the blocky upsampled flow of the
+	// coarser levels is still visible in the refined flow
+	f1, f2 := shiftedPair(64, 64, 4, 2)
+	for _, iterations := range []int{1, 2, 5} {
+		var rough, epe [2]float64
+		for i, smooth := range []bool{false, true} {
+			opts := &PyramidOptions{
+				HornSchunkOptions: HornSchunkOptions{Alpha: 100, Iterations: iterations},
+				Levels:            4,
+				SmoothProlong:     smooth,
+			}
+			flow := OpticFlowPyramid(f1, f2, opts)
+			rough[i], epe[i] = flowRoughness(flow), meanEPE(flow, 4, 2, 8)
+		}
+		if rough[1] > 0.75*rough[0] {
+			t.Errorf("%d iterations: roughness %f with smooth prolongation, %f without", iterations, rough[1], rough[0])
+		}
+		if epe[1] > epe[0] {
+			t.Errorf("%d iterations: EPE %f with smooth prolongation, %f without", iterations, epe[1], epe[0])
+		}
+	}
+}
+
+func BenchmarkOpticFlowPyramid(b *testing.B) {
+	f1, f2 := shiftedPair(256, 256, 2, 1)
+	for _, bc := range []struct {
+		name  string
+		reuse bool
+	}{
+		{"naive", false},
+		{"reuse", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			opts := &PyramidOptions{
+				HornSchunkOptions: HornSchunkOptions{Alpha: 100, Iterations: 10},
+				Levels:            4,
+				Warps:             2,
+				ReuseBuffers:      bc.reuse,
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				OpticFlowPyramid(f1, f2, opts)
+			}
+		})
+	}
+}
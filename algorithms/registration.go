@@ -0,0 +1,243 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+// EstimateTranslation finds the integer shift dx, dy with |dx|, |dy| <= maxShift
+// so that f2(x+dx, y+dy) best matches f1(x, y), i.e. it uses the same
+// convention as the optic flow. The match is measured as the mean squared
+// difference of channel 0 over the overlapping region of both images
+func EstimateTranslation(f1, f2 *floatimage.FloatImg, maxShift int) (dx, dy int) {
+	bounds := f1.Bounds().Intersect(f2.Bounds())
+	best := math.MaxFloat64
+	for sy := -maxShift; sy <= maxShift; sy++ {
+		for sx := -maxShift; sx <= maxShift; sx++ {
+			overlap := bounds.Intersect(bounds.Add(image.Point{-sx, -sy}))
+			if overlap.Empty() {
+				continue
+			}
+			var ssd float64
+			for y := overlap.Min.Y; y < overlap.Max.Y; y++ {
+				for x := overlap.Min.X; x < overlap.Max.X; x++ {
+					diff := float64(f2.AtF(x+sx, y+sy)[0] - f1.AtF(x, y)[0])
+					ssd += diff * diff
+				}
+			}
+			ssd /= float64(overlap.Dx() * overlap.Dy())
+			if ssd < best {
+				best = ssd
+				dx, dy = sx, sy
+			}
+		}
+	}
+	return
+}
+
+// windowedSpectrum returns the 2D spectrum of channel 0 of img with its mean
+// removed and a Hann window applied, zero padded to the size w x h
+func windowedSpectrum(img *floatimage.FloatImg, w, h int) []complex128 {
+	bounds := img.Bounds()
+	var mean float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mean += float64(img.AtF(x, y)[0])
+		}
+	}
+	mean /= float64(bounds.Dx() * bounds.Dy())
+
+	hann := func(i, n int) float64 {
+		if n < 2 {
+			return 1.0
+		}
+		return 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	}
+
+	data := make([]complex128, w*h)
+	for y := 0; y < bounds.Dy(); y++ {
+		wy := hann(y, bounds.Dy())
+		for x := 0; x < bounds.Dx(); x++ {
+			v := float64(img.AtF(bounds.Min.X+x, bounds.Min.Y+y)[0]) - mean
+			data[y*w+x] = complex(v*wy*hann(x, bounds.Dx()), 0)
+		}
+	}
+	fft2D(data, w, h, false)
+	return data
+}
+
+// parabolaPeak returns the offset -0.5 <= d <= 0.5 of the vertex of the
+// parabola through (-1, l), (0, c), (1, r) from the center sample
+func parabolaPeak(l, c, r float32) float32 {
+	denom := l - 2*c + r
+	if denom == 0 {
+		return 0
+	}
+	d := 0.5 * (l - r) / denom
+	if d < -0.5 || d > 0.5 {
+		return 0
+	}
+	return d
+}
+
+// sincPeak returns the offset -1 < d < 1 of the peak of a sinc shaped
+// correlation from the center sample c and its neighbors l and r. Unlike a
+// parabola this models the peak of a phase correlation surface, whose shape
+// for a sub pixel shift d is close to sinc(x - d), so the ratio of the larger
+// neighbor to the center gives d directly
+func sincPeak(l, c, r float32) float32 {
+	if r > l {
+		if r+c <= 0 {
+			return 0
+		}
+		return r / (r + c)
+	}
+	if l+c <= 0 {
+		return 0
+	}
+	return -l / (l + c)
+}
+
+// PeakModel selects the shape SubpixelPeak fits to a peak and its neighbors
+type PeakModel int
+
+const (
+	// PeakParabola fits a parabola, which suits smooth peaks and minima of
+	// matching costs
+	PeakParabola PeakModel = iota
+	// PeakSinc fits the sinc shaped peak of a phase correlation surface (see
+	// PhaseCorrelate), it only supports maxima
+	PeakSinc
+)
+
+// offset returns the offset of the peak from the center sample c given its
+// neighbors l and r
+func (m PeakModel) offset(l, c, r float32) float32 {
+	if m == PeakSinc {
+		return sincPeak(l, c, r)
+	}
+	return parabolaPeak(l, c, r)
+}
+
+// SubpixelPeak refines the position of the peak (or for PeakParabola also
+// minimum) at px, py of channel 0 of surface by fitting the model through the
+// peak and its two neighbors in x and in y. If a neighbor is outside of the
+// surface the position isn't refined in that direction. PhaseCorrelate
+// refines its peak with it
+func SubpixelPeak(surface *floatimage.FloatImg, px, py int, model PeakModel) (float32, float32) {
+	bounds := surface.Bounds()
+	x, y := float32(px), float32(py)
+	c := surface.AtF(px, py)[0]
+	if px > bounds.Min.X && px < bounds.Max.X-1 {
+		x += model.offset(surface.AtF(px-1, py)[0], c, surface.AtF(px+1, py)[0])
+	}
+	if py > bounds.Min.Y && py < bounds.Max.Y-1 {
+		y += model.offset(surface.AtF(px, py-1)[0], c, surface.AtF(px, py+1)[0])
+	}
+	return x, y
+}
+
+// MatchConfidence measures how well defined the minimum at px, py of the
+// matching cost in channel 0 of surface is. It computes the Hessian from
+// finite differences and returns its smaller eigenvalue, the curvature in the
+// flattest direction, so sharp minima give large values while flat minima or
+// minima along an edge (aperture problem) give values near 0. Negative
+// curvatures are clamped to 0, neighbors outside of the surface are replicated
+func MatchConfidence(surface *floatimage.FloatImg, px, py int) float32 {
+	bounds := surface.Bounds()
+	at := func(dx, dy int) float64 {
+		x, _ := floatimage.BoundaryReplicate.Resolve(px+dx, bounds.Min.X, bounds.Max.X)
+		y, _ := floatimage.BoundaryReplicate.Resolve(py+dy, bounds.Min.Y, bounds.Max.Y)
+		return float64(surface.AtF(x, y)[0])
+	}
+	c := at(0, 0)
+	dxx := at(-1, 0) - 2*c + at(1, 0)
+	dyy := at(0, -1) - 2*c + at(0, 1)
+	dxy := (at(1, 1) - at(1, -1) - at(-1, 1) + at(-1, -1)) / 4
+	// smaller eigenvalue of [dxx dxy; dxy dyy]
+	min := (dxx+dyy)/2 - math.Sqrt((dxx-dyy)*(dxx-dyy)/4+dxy*dxy)
+	if min < 0 {
+		return 0
+	}
+	return float32(min)
+}
+
+// PhaseCorrelate estimates the global translation dx, dy between f1 and f2
+// with sub pixel accuracy using the same convention as EstimateTranslation,
+// i.e. f2(x+dx, y+dy) matches f1(x, y). It locates the peak of the inverse
+// transform of the normalized cross-power spectrum and refines it with
+// SubpixelPeak fitting the sinc shape of the peak (PeakSinc). The images need
+// to have the same size
+func PhaseCorrelate(f1, f2 *floatimage.FloatImg) (dx, dy float32) {
+	bounds := f1.Bounds()
+	w, h := nextPow2(bounds.Dx()), nextPow2(bounds.Dy())
+	s1 := windowedSpectrum(f1, w, h)
+	s2 := windowedSpectrum(f2, w, h)
+
+	for i := range s1 {
+		cross := s2[i] * cmplx.Conj(s1[i])
+		if mag := cmplx.Abs(cross); mag > 1e-12 {
+			s1[i] = cross / complex(mag, 0)
+		} else {
+			s1[i] = 0
+		}
+	}
+	fft2D(s1, w, h, true)
+
+	// the correlation is cyclic, shift it so zero displacement is at the
+	// center (w/2, h/2) and the peak has neighbors on all sides
+	surface := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	px, py := 0, 0
+	peak := float32(-math.MaxFloat32)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := (x+w/2)%w, (y+h/2)%h
+			v := float32(real(s1[y*w+x]))
+			surface.Set(sx, sy, 0, v)
+			if v > peak {
+				peak = v
+				px, py = sx, sy
+			}
+		}
+	}
+
+	dx, dy = SubpixelPeak(surface, px, py, PeakSinc)
+	return dx - float32(w/2), dy - float32(h/2)
+}
+
+// IsStatic reports whether f1 and f2 are nearly identical, i.e. the mean
+// absolute difference of channel 0 over the interior (excluding the dummy
+// borders) is below threshold. As the images hold gray values the threshold
+// is in gray levels, e.g. 1.0 for a mean change of one level out of 255
+func IsStatic(f1, f2 *floatimage.FloatImg, threshold float32) bool {
+	bounds := f1.Bounds()
+	var sum float64
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			sum += math.Abs(float64(f2.AtF(x, y)[0] - f1.AtF(x, y)[0]))
+		}
+	}
+	n := (bounds.Dx() - 2) * (bounds.Dy() - 2)
+	if n <= 0 {
+		return true
+	}
+	return sum/float64(n) < float64(threshold)
+}
+
+// TemporalGradient returns the single channel image |f2 - f1| of channel 0
+// over the interior, a quick indicator of where the scene changes. The dummy
+// border of the result is filled from the interior, the images need to have
+// dummy borders
+func TemporalGradient(f1, f2 *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := f1.Bounds()
+	diff := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			diff.Set(x, y, 0, float32(math.Abs(float64(f2.AtF(x, y)[0]-f1.AtF(x, y)[0]))))
+		}
+	}
+	diff.Dummies()
+	return diff
+}
@@ -0,0 +1,268 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimateTranslation(t *testing.T) {
+	tests := []struct {
+		dx, dy int
+	}{
+		{4, 0},
+		{0, -4},
+		{4, 4},
+		{-4, 3},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		f1, f2 := shiftedPair(48, 40, float64(tt.dx), float64(tt.dy))
+		dx, dy := EstimateTranslation(f1, f2, 6)
+		if dx != tt.dx || dy != tt.dy {
+			t.Errorf("shift (%d, %d): got (%d, %d)", tt.dx, tt.dy, dx, dy)
+		}
+	}
+}
+
+// boxShiftedPair returns w x h noise images with dummy borders, sampled by
+// averaging scale x scale blocks of a finer random image, where the second
+// one is moved by (dx, dy) fine pixels, i.e. the true flow is (dx, dy)/scale.
+// Unlike shiftedPair the images have a broad spectrum like natural images
+func boxShiftedPair(w, h, scale, dx, dy int) (f1, f2 *floatimage.FloatImg) {
+	rng := rand.New(rand.NewSource(1))
+	margin := 4 * scale
+	fw := w*scale + 2*margin
+	fine := make([]float32, fw*(h*scale+2*margin))
+	for i := range fine {
+		fine[i] = 255 * rng.Float32()
+	}
+	sample := func(dx, dy int) *floatimage.FloatImg {
+		img := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var sum float32
+				for j := 0; j < scale; j++ {
+					row := (margin+y*scale+j-dy)*fw + margin + x*scale - dx
+					for i := 0; i < scale; i++ {
+						sum += fine[row+i]
+					}
+				}
+				img.Set(x, y, 0, sum/float32(scale*scale))
+			}
+		}
+		return img.AddDummies()
+	}
+	return sample(0, 0), sample(dx, dy)
+}
+
+func TestPhaseCorrelate(t *testing.T) {
+	// shifts in quarter pixels
+	tests := []struct {
+		dx, dy int
+	}{
+		{16, 0},
+		{2, 0},
+		{0, -2},
+		{1, 3},
+		{9, 6},
+		{-13, 1},
+		{-1, -2},
+	}
+	for _, tt := range tests {
+		f1, f2 := boxShiftedPair(64, 64, 4, tt.dx, tt.dy)
+		dx, dy := PhaseCorrelate(f1, f2)
+		wantX, wantY := float64(tt.dx)/4, float64(tt.dy)/4
+		if !near(float64(dx), wantX, 0.1) || !near(float64(dy), wantY, 0.1) {
+			t.Errorf("shift (%.2f, %.2f): got (%.3f, %.3f)", wantX, wantY, dx, dy)
+		}
+	}
+}
+
+func TestSubpixelPeak(t *testing.T) {
+	sinc := func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		return math.Sin(math.Pi*t) / (math.Pi * t)
+	}
+	tests := []struct {
+		name   string
+		model  PeakModel
+		cx, cy float64
+		f      func(dx, dy float64) float64
+		eps    float64
+	}{
+		// a parabola is fitted exactly
+		{"parabola", PeakParabola, 5.3, 4.8, func(dx, dy float64) float64 { return 100 - 3*dx*dx - 5*dy*dy }, 1e-4},
+		{"parabola halfway", PeakParabola, 5.5, 4, func(dx, dy float64) float64 { return 100 - dx*dx - dy*dy }, 1e-4},
+		// a Gaussian peak is approximated
+		{"gaussian", PeakParabola, 4.75, 5.4, func(dx, dy float64) float64 { return 10 * math.Exp(-(dx*dx+dy*dy)/4) }, 0.05},
+		{"minimum", PeakParabola, 5.2, 4.7, func(dx, dy float64) float64 { return dx*dx + 2*dy*dy }, 1e-4},
+		// the peak of a phase correlation is fitted exactly by a sinc
+		{"sinc", PeakSinc, 5.3, 4.6, func(dx, dy float64) float64 { return sinc(dx) * sinc(dy) }, 1e-4},
+		{"sinc halfway", PeakSinc, 4.5, 5.25, func(dx, dy float64) float64 { return sinc(dx) * sinc(dy) }, 1e-4},
+		{"sinc centered", PeakSinc, 5, 5, func(dx, dy float64) float64 { return sinc(dx) * sinc(dy) }, 1e-4},
+	}
+	for _, tt := range tests {
+		surface := floatimage.NewFloatImg(image.Rect(0, 0, 11, 10), 1)
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 11; x++ {
+				surface.Set(x, y, 0, float32(tt.f(float64(x)-tt.cx, float64(y)-tt.cy)))
+			}
+		}
+		px, py := int(math.Floor(tt.cx+0.5)), int(math.Floor(tt.cy+0.5))
+		x, y := SubpixelPeak(surface, px, py, tt.model)
+		if !near(float64(x), tt.cx, tt.eps) || !near(float64(y), tt.cy, tt.eps) {
+			t.Errorf("%s: peak at (%f, %f), want (%f, %f)", tt.name, x, y, tt.cx, tt.cy)
+		}
+	}
+}
+
+func TestSubpixelPeakBorder(t *testing.T) {
+	// on the border the position isn't refined in that direction
+	surface := floatimage.NewFloatImg(image.Rect(2, 3, 6, 7), 1)
+	for y := 3; y < 7; y++ {
+		for x := 2; x < 6; x++ {
+			dx, dy := float32(x)-2.3, float32(y)-4.2
+			surface.Set(x, y, 0, 100-dx*dx-dy*dy)
+		}
+	}
+	x, y := SubpixelPeak(surface, 2, 4, PeakParabola)
+	if x != 2 || !near(float64(y), 4.2, 1e-4) {
+		t.Errorf("peak at (%f, %f), want (2, 4.2)", x, y)
+	}
+	if x, _ := SubpixelPeak(surface, 5, 4, PeakSinc); x != 5 {
+		t.Errorf("sinc peak on the right border at x = %f, want 5", x)
+	}
+}
+
+func TestIsStatic(t *testing.T) {
+	still, _ := shiftedPair(32, 24, 0, 0)
+	tests := []struct {
+		name      string
+		dx, dy    float64
+		threshold float32
+		static    bool
+	}{
+		{"identical", 0, 0, 0.5, true},
+		{"identical zero threshold", 0, 0, 0, false},
+		{"moving", 2, 0, 1, false},
+		{"moving subpixel", 0.3, 0.2, 1, false},
+		{"moving with large threshold", 2, 0, 100, true},
+	}
+	for _, tt := range tests {
+		_, moved := shiftedPair(32, 24, tt.dx, tt.dy)
+		if got := IsStatic(still, moved, tt.threshold); got != tt.static {
+			t.Errorf("%s: IsStatic = %v, want %v", tt.name, got, tt.static)
+		}
+	}
+
+	// the threshold is in gray levels
+	brighter := still.Clone()
+	for i := range brighter.Pix {
+		brighter.Pix[i] += 2
+	}
+	if !IsStatic(still, brighter, 2.5) || IsStatic(still, brighter, 1.5) {
+		t.Error("a brightness change of 2 gray levels isn't compared against the threshold")
+	}
+}
+
+func TestMatchConfidence(t *testing.T) {
+	// quadratic cost surfaces a*dx² + b*dy² + k*dx*dy around the minimum
+	// at px, py with the Hessian [2a k; k 2b], whose finite differences are
+	// exact
+	r := image.Rect(-2, 3, 9, 12)
+	tests := []struct {
+		name    string
+		a, b, k float32
+		px, py  int
+		want    float32
+	}{
+		{"sharp", 5, 5, 0, 3, 7, 10},
+		{"flat", 0.1, 0.1, 0, 3, 7, 0.2},
+		{"elongated", 5, 0.5, 0, 3, 7, 1},
+		{"edge", 5, 0, 0, 3, 7, 0},
+		{"rotated", 2, 2, 2, 3, 7, 2},
+		{"saddle", 1, -1, 0, 3, 7, 0},
+		// the replicated neighbors halve the curvature at the border
+		{"corner", 4, 4, 0, -2, 3, 4},
+	}
+	for _, tt := range tests {
+		surface := floatimage.NewFloatImg(r, 1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				dx, dy := float32(x-tt.px), float32(y-tt.py)
+				surface.Set(x, y, 0, 50+tt.a*dx*dx+tt.b*dy*dy+tt.k*dx*dy)
+			}
+		}
+		if got := MatchConfidence(surface, tt.px, tt.py); math.Abs(float64(got-tt.want)) > 1e-4 {
+			t.Errorf("%s: confidence %f, want %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+// boxFrame returns a w x h single channel image with dummy borders showing a
+// 4x4 box of 100 at x, y on a background of 10
+func boxFrame(w, h, x, y int) *floatimage.FloatImg {
+	img := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	box := image.Rect(x, y, x+4, y+4)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			v := float32(10)
+			if (image.Point{i, j}).In(box) {
+				v = 100
+			}
+			img.Set(i, j, 0, v)
+		}
+	}
+	return img.AddDummies()
+}
+
+func TestTemporalGradient(t *testing.T) {
+	tests := []struct {
+		name           string
+		x1, y1, x2, y2 int
+	}{
+		{"static", 5, 5, 5, 5},
+		{"right", 5, 5, 9, 5},
+		{"up left", 8, 8, 6, 3},
+		{"to the border", 2, 2, 0, 0},
+	}
+	for _, tt := range tests {
+		f1, f2 := boxFrame(16, 12, tt.x1, tt.y1), boxFrame(16, 12, tt.x2, tt.y2)
+		diff := TemporalGradient(f1, f2)
+		if diff.Chancnt != 1 || diff.Bounds() != f1.Bounds() {
+			t.Fatalf("%s: result has %d channels and bounds %v", tt.name, diff.Chancnt, diff.Bounds())
+		}
+		// the difference is large exactly where the box left or arrived
+		inner := diff.Dedummify()
+		box1, box2 := image.Rect(tt.x1, tt.y1, tt.x1+4, tt.y1+4), image.Rect(tt.x2, tt.y2, tt.x2+4, tt.y2+4)
+		for y := 0; y < 12; y++ {
+			for x := 0; x < 16; x++ {
+				p := image.Point{x, y}
+				want := float32(0)
+				if p.In(box1) != p.In(box2) {
+					want = 90
+				}
+				if got := inner.AtF(x, y)[0]; got != want {
+					t.Errorf("%s: difference at %v = %f, want %f", tt.name, p, got, want)
+				}
+			}
+		}
+		// swapping the frames gives the same magnitude
+		swapped := TemporalGradient(f2, f1)
+		for i, v := range swapped.Pix {
+			if v != diff.Pix[i] {
+				t.Errorf("%s: swapped frames differ at index %d: %f != %f", tt.name, i, v, diff.Pix[i])
+				break
+			}
+		}
+		// the dummy border replicates the interior
+		if got, want := diff.AtF(-1, -1)[0], diff.AtF(0, 0)[0]; got != want {
+			t.Errorf("%s: dummy corner %f, want %f", tt.name, got, want)
+		}
+	}
+}
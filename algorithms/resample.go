@@ -0,0 +1,56 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+)
+
+// DownsampleFlow reduces the 2 channel flow field by factor in both directions
+// by averaging factor x factor blocks (partial blocks on the right and bottom
+// average the available pixels). As the pixel grid gets coarser the vectors
+// are divided by factor as well. The result starts at the same Rect.Min
+func DownsampleFlow(flow *floatimage.FloatImg, factor int) *floatimage.FloatImg {
+	if factor < 1 {
+		factor = 1
+	}
+	bounds := flow.Bounds()
+	w := (bounds.Dx() + factor - 1) / factor
+	h := (bounds.Dy() + factor - 1) / factor
+	small := floatimage.NewFloatImg(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+w, bounds.Min.Y+h), 2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			block := image.Rect(x*factor, y*factor, (x+1)*factor, (y+1)*factor).Add(bounds.Min).Intersect(bounds)
+			var u, v float32
+			for by := block.Min.Y; by < block.Max.Y; by++ {
+				for bx := block.Min.X; bx < block.Max.X; bx++ {
+					vec := flow.AtF(bx, by)
+					u += vec[0]
+					v += vec[1]
+				}
+			}
+			n := float32(block.Dx()*block.Dy()) * float32(factor)
+			out := small.AtF(bounds.Min.X+x, bounds.Min.Y+y)
+			out[0], out[1] = u/n, v/n
+		}
+	}
+	return small
+}
+
+// SampleLine returns samples bilinearly interpolated channel vectors of flow
+// evenly spaced along the segment from x0, y0 to x1, y1 including both end
+// points, a single sample is taken at x0, y0
+func SampleLine(flow *floatimage.FloatImg, x0, y0, x1, y1 float32, samples int) [][]float32 {
+	if samples < 1 {
+		return nil
+	}
+	values := make([][]float32, samples)
+	for i := range values {
+		var t float32
+		if samples > 1 {
+			t = float32(i) / float32(samples-1)
+		}
+		values[i] = make([]float32, flow.Chancnt)
+		flow.AtBilinear(x0+t*(x1-x0), y0+t*(y1-y0), values[i])
+	}
+	return values
+}
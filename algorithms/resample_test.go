@@ -0,0 +1,79 @@
+package algorithms
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestDownsampleFlow(t *testing.T) {
+	tests := []struct {
+		r            image.Rectangle
+		factor       int
+		wantW, wantH int
+		u, v         float32
+	}{
+		{image.Rect(0, 0, 8, 6), 2, 4, 3, 2, -1},
+		{image.Rect(0, 0, 9, 7), 2, 5, 4, 1, 0.5},
+		{image.Rect(3, -2, 15, 10), 3, 4, 4, -3, 6},
+		{image.Rect(0, 0, 5, 5), 1, 5, 5, 2, 1},
+		{image.Rect(0, 0, 5, 5), 0, 5, 5, 2, 1},
+	}
+	for _, tt := range tests {
+		small := DownsampleFlow(constantFlow(tt.r, tt.u, tt.v), tt.factor)
+		want := image.Rect(0, 0, tt.wantW, tt.wantH).Add(tt.r.Min)
+		if small.Bounds() != want || small.Chancnt != 2 {
+			t.Errorf("%v by %d: bounds %v with %d channels, want %v", tt.r, tt.factor, small.Bounds(), small.Chancnt, want)
+			continue
+		}
+		scale := float32(tt.factor)
+		if scale < 1 {
+			scale = 1
+		}
+		for i := 0; i < len(small.Pix); i += 2 {
+			if small.Pix[i] != tt.u/scale || small.Pix[i+1] != tt.v/scale {
+				t.Errorf("%v by %d: vector (%f, %f), want (%f, %f)", tt.r, tt.factor,
+					small.Pix[i], small.Pix[i+1], tt.u/scale, tt.v/scale)
+				break
+			}
+		}
+	}
+
+	// blocks are averaged
+	flow := constantFlow(image.Rect(0, 0, 2, 2), 0, 0)
+	copy(flow.Pix, []float32{1, 0, 3, 0, 5, 2, 7, 6})
+	if vec := DownsampleFlow(flow, 2).AtF(0, 0); vec[0] != 2 || vec[1] != 1 {
+		t.Errorf("block average (%f, %f), want (2, 1)", vec[0], vec[1])
+	}
+}
+
+func TestSampleLine(t *testing.T) {
+	// bilinear interpolation reproduces the linear field u = 0.5x - y,
+	// v = 2y exactly inside the image
+	flow := linearField(image.Rect(-2, 0, 20, 12), 0.5, -1, 0, 2)
+	tests := []struct {
+		name           string
+		x0, y0, x1, y1 float32
+		samples        int
+		xs, ys         []float32
+	}{
+		{"horizontal", 1.5, 3.25, 9.5, 3.25, 5, []float32{1.5, 3.5, 5.5, 7.5, 9.5}, []float32{3.25, 3.25, 3.25, 3.25, 3.25}},
+		{"backwards", 4, 1, -1, 1, 3, []float32{4, 1.5, -1}, []float32{1, 1, 1}},
+		{"diagonal", 0, 0, 6, 9, 4, []float32{0, 2, 4, 6}, []float32{0, 3, 6, 9}},
+		{"single sample", 3.5, 7.75, 10, 10, 1, []float32{3.5}, []float32{7.75}},
+		{"no samples", 0, 0, 5, 5, 0, nil, nil},
+	}
+	for _, tt := range tests {
+		values := SampleLine(flow, tt.x0, tt.y0, tt.x1, tt.y1, tt.samples)
+		if len(values) != len(tt.xs) {
+			t.Errorf("%s: got %d samples, want %d", tt.name, len(values), len(tt.xs))
+			continue
+		}
+		for i, vec := range values {
+			wantU, wantV := 0.5*tt.xs[i]-tt.ys[i], 2*tt.ys[i]
+			if len(vec) != 2 || math.Abs(float64(vec[0]-wantU)) > 1e-4 || math.Abs(float64(vec[1]-wantV)) > 1e-4 {
+				t.Errorf("%s: sample %d is %v, want (%f, %f)", tt.name, i, vec, wantU, wantV)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+)
+
+// foregroundCleanupRadius is the radius of the Erode/Dilate pair that cleans
+// up the ForegroundMask
+const foregroundCleanupRadius = 1
+
+// ForegroundMask returns a single channel 0/1 mask that is 1 where the
+// magnitude of the 2 channel flow field exceeds magThreshold, i.e. the moving
+// foreground for a static camera. The thresholded mask is eroded and then
+// dilated by foregroundCleanupRadius which removes isolated noisy pixels and
+// keeps the extent of larger regions
+func ForegroundMask(flow *floatimage.FloatImg, magThreshold float32) *floatimage.FloatImg {
+	bounds := flow.Bounds()
+	mask := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			if vec[0]*vec[0]+vec[1]*vec[1] > magThreshold*magThreshold {
+				mask.Set(x, y, 0, 1)
+			}
+		}
+	}
+	return mask.Erode(foregroundCleanupRadius).Dilate(foregroundCleanupRadius)
+}
+
+// ConnectedComponents labels the connected regions of pixels where channel 0
+// of mask is > 0. With connectivity 8 diagonal neighbors are connected too,
+// any other value uses the 4 direct neighbors. It returns a single channel
+// image holding the labels 1..count in scan order of the first pixel of each
+// region, 0 for the background, and the number of regions
+func ConnectedComponents(mask *floatimage.FloatImg, connectivity int) (labels *floatimage.FloatImg, count int) {
+	bounds := mask.Bounds()
+	labels = floatimage.NewFloatImg(bounds, 1)
+	offsets := [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	if connectivity == 8 {
+		offsets = append(offsets, [2]int{-1, -1}, [2]int{1, -1}, [2]int{-1, 1}, [2]int{1, 1})
+	}
+	var stack []image.Point
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if mask.AtF(x, y)[0] <= 0 || labels.AtF(x, y)[0] != 0 {
+				continue
+			}
+			count++
+			label := float32(count)
+			labels.Set(x, y, 0, label)
+			stack = append(stack[:0], image.Point{x, y})
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				for _, o := range offsets {
+					n := image.Point{p.X + o[0], p.Y + o[1]}
+					if !n.In(bounds) || mask.AtF(n.X, n.Y)[0] <= 0 || labels.AtF(n.X, n.Y)[0] != 0 {
+						continue
+					}
+					labels.Set(n.X, n.Y, 0, label)
+					stack = append(stack, n)
+				}
+			}
+		}
+	}
+	return
+}
+
+// ComponentBounds returns the tight bounding rectangle of each of the labels
+// 1..count of a label image from ConnectedComponents, index i holds label
+// i+1. Labels without pixels get an empty rectangle
+func ComponentBounds(labels *floatimage.FloatImg, count int) []image.Rectangle {
+	rects := make([]image.Rectangle, count)
+	bounds := labels.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			label := int(labels.AtF(x, y)[0])
+			if label < 1 || label > count {
+				continue
+			}
+			rects[label-1] = rects[label-1].Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return rects
+}
+
+// saliencyRadius is the window radius of the local contrast in MotionSaliency
+const saliencyRadius = 2
+
+// MotionSaliency returns a single channel map that is high where the motion
+// is large and the image is textured, the product
+//
+//	|flow| * sqrt(LocalVariance(img, 2))
+//
+// of the flow magnitude and the local standard deviation of channel 0 of img
+// in a 5x5 window. Flat moving regions, whose flow is unreliable, and static
+// texture both score low
+func MotionSaliency(flow, img *floatimage.FloatImg) *floatimage.FloatImg {
+	variance := img.LocalVariance(saliencyRadius)
+	bounds := flow.Bounds()
+	saliency := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			mag := math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1]))
+			saliency.Set(x, y, 0, float32(mag*math.Sqrt(float64(variance.AtF(x, y)[0]))))
+		}
+	}
+	return saliency
+}
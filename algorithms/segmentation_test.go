@@ -0,0 +1,204 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestForegroundMask(t *testing.T) {
+	bounds := image.Rect(0, 0, 30, 30)
+	flow := constantFlow(bounds, 0, 0)
+	blob := image.Rect(10, 12, 18, 19)
+	for y := blob.Min.Y; y < blob.Max.Y; y++ {
+		for x := blob.Min.X; x < blob.Max.X; x++ {
+			copy(flow.AtF(x, y), []float32{2, -1})
+		}
+	}
+	// single noisy pixels and slow motion below the threshold
+	specks := []image.Point{{2, 3}, {25, 5}, {4, 26}}
+	for _, p := range specks {
+		copy(flow.AtF(p.X, p.Y), []float32{0, 3})
+	}
+	slow := image.Rect(20, 20, 27, 27)
+	for y := slow.Min.Y; y < slow.Max.Y; y++ {
+		for x := slow.Min.X; x < slow.Max.X; x++ {
+			copy(flow.AtF(x, y), []float32{0.5, 0.5})
+		}
+	}
+
+	mask := ForegroundMask(flow, 1)
+	if mask.Chancnt != 1 || !mask.Bounds().Eq(bounds) {
+		t.Fatalf("mask has %d channels and bounds %v", mask.Chancnt, mask.Bounds())
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := image.Point{x, y}
+			want := float32(0)
+			if p.In(blob) {
+				want = 1
+			}
+			if got := mask.AtF(x, y)[0]; got != want {
+				t.Errorf("mask at %v = %f, want %f", p, got, want)
+			}
+		}
+	}
+}
+
+// blobMask returns a 0/1 mask of bounds r that is 1 inside the blobs
+func blobMask(r image.Rectangle, blobs ...image.Rectangle) *floatimage.FloatImg {
+	mask := floatimage.NewFloatImg(r, 1)
+	for _, b := range blobs {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				mask.Set(x, y, 0, 1)
+			}
+		}
+	}
+	return mask
+}
+
+func TestConnectedComponents(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+	first := image.Rect(2, 2, 6, 5)
+	second := image.Rect(10, 8, 15, 16)
+	// touches first only at its corner
+	diagonal := image.Rect(6, 5, 8, 7)
+
+	tests := []struct {
+		name         string
+		blobs        []image.Rectangle
+		connectivity int
+		count        int
+		labels       map[image.Point]float32
+	}{
+		{"empty", nil, 4, 0, map[image.Point]float32{{0, 0}: 0}},
+		{"two blobs", []image.Rectangle{first, second}, 4, 2,
+			map[image.Point]float32{{2, 2}: 1, {5, 4}: 1, {10, 8}: 2, {14, 15}: 2, {8, 8}: 0}},
+		{"diagonal 4", []image.Rectangle{first, second, diagonal}, 4, 3,
+			map[image.Point]float32{{5, 4}: 1, {6, 5}: 2, {7, 6}: 2, {12, 12}: 3}},
+		{"diagonal 8", []image.Rectangle{first, second, diagonal}, 8, 2,
+			map[image.Point]float32{{5, 4}: 1, {6, 5}: 1, {7, 6}: 1, {12, 12}: 2}},
+	}
+	for _, tc := range tests {
+		labels, count := ConnectedComponents(blobMask(bounds, tc.blobs...), tc.connectivity)
+		if count != tc.count {
+			t.Errorf("%s: count = %d, want %d", tc.name, count, tc.count)
+		}
+		if labels.Chancnt != 1 || !labels.Bounds().Eq(bounds) {
+			t.Fatalf("%s: labels have %d channels and bounds %v", tc.name, labels.Chancnt, labels.Bounds())
+		}
+		for p, want := range tc.labels {
+			if got := labels.AtF(p.X, p.Y)[0]; got != want {
+				t.Errorf("%s: label at %v = %f, want %f", tc.name, p, got, want)
+			}
+		}
+		// every blob pixel carries a single label
+		for _, b := range tc.blobs {
+			want := labels.AtF(b.Min.X, b.Min.Y)[0]
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got := labels.AtF(x, y)[0]; got != want {
+						t.Errorf("%s: label at (%d, %d) = %f, want %f", tc.name, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestComponentBounds(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+	tests := []struct {
+		name   string
+		blobs  []image.Rectangle
+		count  int
+		expect []image.Rectangle
+	}{
+		{"none", nil, 0, []image.Rectangle{}},
+		{"rects", []image.Rectangle{image.Rect(2, 3, 6, 5), image.Rect(10, 8, 15, 16)}, 2,
+			[]image.Rectangle{image.Rect(2, 3, 6, 5), image.Rect(10, 8, 15, 16)}},
+		// an L shape whose bounding box is larger than each of its parts,
+		// labelled after the bar in row 0 by scan order
+		{"L shape", []image.Rectangle{image.Rect(1, 1, 3, 10), image.Rect(1, 8, 9, 10), image.Rect(15, 0, 20, 1)}, 2,
+			[]image.Rectangle{image.Rect(15, 0, 20, 1), image.Rect(1, 1, 9, 10)}},
+	}
+	for _, tc := range tests {
+		labels, count := ConnectedComponents(blobMask(bounds, tc.blobs...), 4)
+		if count != tc.count {
+			t.Fatalf("%s: count = %d, want %d", tc.name, count, tc.count)
+		}
+		rects := ComponentBounds(labels, count)
+		if len(rects) != len(tc.expect) {
+			t.Fatalf("%s: got %d rectangles, want %d", tc.name, len(rects), len(tc.expect))
+		}
+		for i, want := range tc.expect {
+			if rects[i] != want {
+				t.Errorf("%s: label %d bounds %v, want %v", tc.name, i+1, rects[i], want)
+			}
+		}
+	}
+
+	// labels without pixels give empty rectangles
+	labels := blobMask(bounds, image.Rect(4, 4, 7, 6))
+	rects := ComponentBounds(labels, 3)
+	if rects[0] != image.Rect(4, 4, 7, 6) || !rects[1].Empty() || !rects[2].Empty() {
+		t.Errorf("sparse labels: bounds %v", rects)
+	}
+}
+
+func TestMotionSaliency(t *testing.T) {
+	// a 36x12 frame with checkerboard texture in columns 0-11 and 24-35 and
+	// a flat middle, the left and middle parts move
+	bounds := image.Rect(0, 0, 36, 12)
+	texture := floatimage.Checkerboard(36, 12, 2)
+	img := floatimage.NewFloatImg(bounds, 1)
+	flow := constantFlow(bounds, 0, 0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := float32(128)
+			if x < 12 || x >= 24 {
+				v = texture.AtF(x, y)[0]
+			}
+			img.Set(x, y, 0, v)
+			if x < 24 {
+				copy(flow.AtF(x, y), []float32{3, -4})
+			}
+		}
+	}
+	saliency := MotionSaliency(flow, img)
+	if saliency.Chancnt != 1 || saliency.Bounds() != bounds {
+		t.Fatalf("saliency has %d channels and bounds %v", saliency.Chancnt, saliency.Bounds())
+	}
+
+	// mean saliency over the parts away from their borders
+	mean := func(r image.Rectangle) float64 {
+		var sum float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				sum += float64(saliency.AtF(x, y)[0])
+			}
+		}
+		return sum / float64(r.Dx()*r.Dy())
+	}
+	movingTextured := mean(image.Rect(2, 2, 9, 10))
+	movingFlat := mean(image.Rect(15, 2, 21, 10))
+	staticTextured := mean(image.Rect(27, 2, 34, 10))
+	if movingFlat != 0 || staticTextured != 0 {
+		t.Errorf("moving flat region scores %f, static texture %f, want 0", movingFlat, staticTextured)
+	}
+	// the standard deviation of the checkerboard is about 127.5 and |flow| 5
+	if movingTextured < 400 {
+		t.Errorf("moving texture scores %f, want at least 400", movingTextured)
+	}
+
+	// the product of the flow magnitude and the local standard deviation
+	variance := img.LocalVariance(2)
+	for _, p := range []image.Point{{0, 0}, {5, 5}, {11, 3}, {12, 6}, {23, 11}} {
+		want := 5 * math.Sqrt(float64(variance.AtF(p.X, p.Y)[0]))
+		if got := float64(saliency.AtF(p.X, p.Y)[0]); !near(got, want, 1e-3*want+1e-6) {
+			t.Errorf("saliency at %v is %f, want %f", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// DrawStreamlines renders the 2 channel flow field as streamlines in black on
+// white. The lines are seeded on a grid with spacing density and traced for
+// length unit sized steps along the bilinearly sampled flow direction. A line
+// stops early when it leaves the image or reaches zero flow
+func DrawStreamlines(flow *floatimage.FloatImg, density int, length int) *image.RGBA {
+	bounds := flow.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	if density < 1 {
+		density = 1
+	}
+	black := color.RGBA{0, 0, 0, 255}
+	vec := make([]float32, flow.Chancnt)
+	for sy := bounds.Min.Y + density/2; sy < bounds.Max.Y; sy += density {
+		for sx := bounds.Min.X + density/2; sx < bounds.Max.X; sx += density {
+			x, y := float32(sx), float32(sy)
+			img.SetRGBA(sx, sy, black)
+			for step := 0; step < length; step++ {
+				flow.AtBilinear(x, y, vec)
+				mag := float32(math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1])))
+				if mag == 0 {
+					break
+				}
+				x += vec[0] / mag
+				y += vec[1] / mag
+				px := int(math.Floor(float64(x) + 0.5))
+				py := int(math.Floor(float64(y) + 0.5))
+				if !(image.Point{px, py}).In(bounds) {
+					break
+				}
+				img.SetRGBA(px, py, black)
+			}
+		}
+	}
+	return img
+}
+
+// drawLine sets the pixels of dst along the line from x0, y0 to x1, y1 to c,
+// pixels outside of dst are skipped
+func drawLine(dst draw.Image, x0, y0, x1, y1 float64, c color.Color) {
+	steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	bounds := dst.Bounds()
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		px := int(math.Floor(x0 + t*(x1-x0) + 0.5))
+		py := int(math.Floor(y0 + t*(y1-y0) + 0.5))
+		if (image.Point{px, py}).In(bounds) {
+			dst.Set(px, py, c)
+		}
+	}
+}
+
+// DrawFlowQuiver overlays the 2 channel flow field onto dst as arrows on a
+// grid with spacing step, each vector scaled by scale. With an empty palette
+// all arrows are drawn in the fixed color, otherwise the color is picked from
+// the palette by the magnitude relative to the largest one so the last entry
+// marks the fastest motion. Zero vectors are skipped
+func DrawFlowQuiver(dst draw.Image, flow *floatimage.FloatImg, step int, scale float32, fixed color.Color, palette color.Palette) {
+	if step < 1 {
+		step = 1
+	}
+	maxMag := MaxMagnitude(flow)
+	bounds := flow.Bounds()
+	for y := bounds.Min.Y + step/2; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X + step/2; x < bounds.Max.X; x += step {
+			vec := flow.AtF(x, y)
+			mag := math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1]))
+			if mag == 0 {
+				continue
+			}
+			c := fixed
+			if len(palette) > 0 {
+				c = palette[int(mag/float64(maxMag)*float64(len(palette)-1)+0.5)]
+			}
+			x0, y0 := float64(x), float64(y)
+			dx, dy := float64(scale*vec[0]), float64(scale*vec[1])
+			drawLine(dst, x0, y0, x0+dx, y0+dy, c)
+			// arrow head with two strokes at ±150° of a third of the length
+			length := math.Sqrt(dx*dx + dy*dy)
+			head := math.Max(length/3, 2)
+			angle := math.Atan2(dy, dx)
+			for _, side := range []float64{-1, 1} {
+				a := angle + side*5*math.Pi/6
+				drawLine(dst, x0+dx, y0+dy, x0+dx+head*math.Cos(a), y0+dy+head*math.Sin(a), c)
+			}
+		}
+	}
+}
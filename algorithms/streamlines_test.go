@@ -0,0 +1,146 @@
+package algorithms
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDrawStreamlines(t *testing.T) {
+	tests := []struct {
+		name            string
+		r               image.Rectangle
+		u, v            float32
+		density, length int
+	}{
+		{"right", image.Rect(0, 0, 20, 16), 2, 0, 4, 5},
+		{"left", image.Rect(0, 0, 20, 16), -0.5, 0, 4, 3},
+		{"right leaving the image", image.Rect(0, 0, 20, 16), 1, 0, 6, 30},
+		{"right with offset origin", image.Rect(3, -2, 23, 14), 3, 0, 5, 4},
+		{"down", image.Rect(0, 0, 12, 12), 0, 1, 4, 2},
+		{"no steps", image.Rect(0, 0, 12, 12), 1, 0, 4, 0},
+		{"zero flow", image.Rect(0, 0, 12, 12), 0, 0, 3, 5},
+	}
+	for _, tt := range tests {
+		img := DrawStreamlines(constantFlow(tt.r, tt.u, tt.v), tt.density, tt.length)
+		if img.Bounds() != tt.r {
+			t.Errorf("%s: bounds %v, want %v", tt.name, img.Bounds(), tt.r)
+			continue
+		}
+
+		// each seed traces a straight line of unit steps in the flow
+		// direction which ends at the image border
+		black := make(map[image.Point]bool)
+		du, dv := 0, 0
+		switch {
+		case tt.u > 0:
+			du = 1
+		case tt.u < 0:
+			du = -1
+		case tt.v > 0:
+			dv = 1
+		}
+		steps := tt.length
+		if du == 0 && dv == 0 {
+			steps = 0
+		}
+		for sy := tt.r.Min.Y + tt.density/2; sy < tt.r.Max.Y; sy += tt.density {
+			for sx := tt.r.Min.X + tt.density/2; sx < tt.r.Max.X; sx += tt.density {
+				for k := 0; k <= steps; k++ {
+					p := image.Point{sx + k*du, sy + k*dv}
+					if !p.In(tt.r) {
+						break
+					}
+					black[p] = true
+				}
+			}
+		}
+
+		for y := tt.r.Min.Y; y < tt.r.Max.Y; y++ {
+			for x := tt.r.Min.X; x < tt.r.Max.X; x++ {
+				want := color.RGBA{255, 255, 255, 255}
+				if black[image.Point{x, y}] {
+					want = color.RGBA{0, 0, 0, 255}
+				}
+				if got := img.RGBAAt(x, y); got != want {
+					t.Errorf("%s: pixel (%d, %d) is %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	// for horizontal flow only the seed rows are drawn, all as solid lines
+	img := DrawStreamlines(constantFlow(image.Rect(0, 0, 20, 16), 1, 0), 4, 4)
+	for y := 0; y < 16; y++ {
+		onLine := y%4 == 2
+		for x := 2; x < 20; x++ {
+			if isBlack := img.RGBAAt(x, y).R == 0; isBlack != onLine {
+				t.Errorf("horizontal flow: pixel (%d, %d) black %v, want %v", x, y, isBlack, onLine)
+			}
+		}
+	}
+}
+
+func TestDrawFlowQuiver(t *testing.T) {
+	// flow 1 to the right in columns 0-7, zero in 8-15 and 4 to the right
+	// from 16 on, sampled at x = 4, 12, 20 and 28 with step 8
+	r := image.Rect(0, 0, 32, 16)
+	flow := constantFlow(r, 0, 0)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			switch {
+			case x < 8:
+				flow.Set(x, y, 0, 1)
+			case x >= 16:
+				flow.Set(x, y, 0, 4)
+			}
+		}
+	}
+	background := color.RGBA{128, 128, 128, 255}
+	green := color.RGBA{0, 200, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		name       string
+		palette    color.Palette
+		slow, fast color.RGBA
+	}{
+		{"fixed", nil, green, green},
+		{"palette", color.Palette{blue, red}, blue, red},
+		{"single entry palette", color.Palette{red}, red, red},
+	}
+	for _, tt := range tests {
+		dst := image.NewRGBA(r)
+		for i := 0; i < len(dst.Pix); i += 4 {
+			copy(dst.Pix[i:], []uint8{background.R, background.G, background.B, background.A})
+		}
+		DrawFlowQuiver(dst, flow, 8, 1, green, tt.palette)
+
+		// shafts start at the grid points and point right
+		for _, y := range []int{4, 12} {
+			for _, s := range []struct {
+				x0, length int
+				want       color.RGBA
+			}{{4, 1, tt.slow}, {20, 4, tt.fast}, {28, 3, tt.fast}} {
+				for x := s.x0; x <= s.x0+s.length; x++ {
+					if got := dst.RGBAAt(x, y); got != s.want {
+						t.Errorf("%s: shaft pixel (%d, %d) is %v, want %v", tt.name, x, y, got, s.want)
+					}
+				}
+			}
+		}
+		// the zero vectors in the middle are skipped and only the arrow
+		// colors are used
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				got := dst.RGBAAt(x, y)
+				if x >= 8 && x < 16 && got != background {
+					t.Errorf("%s: pixel (%d, %d) of a zero vector is %v", tt.name, x, y, got)
+				}
+				if got != background && got != tt.slow && got != tt.fast {
+					t.Errorf("%s: pixel (%d, %d) has unexpected color %v", tt.name, x, y, got)
+				}
+			}
+		}
+	}
+}
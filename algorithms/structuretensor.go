@@ -0,0 +1,81 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+)
+
+// Structure tensor entries Ix², IxIy, Iy² as 3 channel FloatImg
+const (
+	Jxx = iota
+	Jxy = iota
+	Jyy = iota
+)
+
+// StructureTensor computes the structure tensor of channel 0 of img from its
+// central difference gradient, with each entry smoothed by a Gaussian of
+// standard deviation sigma (no smoothing for sigma <= 0). It returns a 3
+// channel image holding Ix², IxIy and Iy² (see Jxx, Jxy, Jyy).
+// Orientation, Coherence and CoherenceEnhancingDiffusion build on it, so they
+// are functions here instead of FloatImg methods, floatimage can't import
+// algorithms
+func StructureTensor(img *floatimage.FloatImg, sigma float32) *floatimage.FloatImg {
+	bounds := img.Bounds()
+	grad := img.Gradient()
+	tensor := floatimage.NewFloatImg(bounds, 3)
+	tensor.Boundary = img.Boundary
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g := grad.AtF(x, y)
+			j := tensor.AtF(x, y)
+			j[Jxx], j[Jxy], j[Jyy] = g[0]*g[0], g[0]*g[1], g[1]*g[1]
+		}
+	}
+	return tensor.GaussianBlur(sigma)
+}
+
+// Orientation returns a single channel image holding the dominant gradient
+// orientation in radians in (-π/2, π/2] at each pixel, the direction of the
+// eigenvector of the largest eigenvalue of the StructureTensor smoothed with
+// sigma. Angles follow atan2(y, x) with y pointing down, so stripes varying
+// along x give 0. Where the tensor is zero the orientation is 0
+func Orientation(img *floatimage.FloatImg, sigma float32) *floatimage.FloatImg {
+	tensor := StructureTensor(img, sigma)
+	bounds := tensor.Bounds()
+	orientation := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			j := tensor.AtF(x, y)
+			theta := 0.5 * math.Atan2(2*float64(j[Jxy]), float64(j[Jxx]-j[Jyy]))
+			// atan2 gives -π for Jxy = -0, e.g. 0 * Iy with Iy < 0
+			if theta <= -math.Pi/2 {
+				theta += math.Pi
+			}
+			orientation.Set(x, y, 0, float32(theta))
+		}
+	}
+	return orientation
+}
+
+// Coherence returns a single channel image holding the coherence
+// (λ1-λ2)/(λ1+λ2) in [0, 1] of the eigenvalues λ1 >= λ2 of the
+// StructureTensor smoothed with sigma. It is close to 1 along straight edges
+// and lines and close to 0 in isotropic texture, flat regions give 0
+func Coherence(img *floatimage.FloatImg, sigma float32) *floatimage.FloatImg {
+	tensor := StructureTensor(img, sigma)
+	bounds := tensor.Bounds()
+	coherence := floatimage.NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			j := tensor.AtF(x, y)
+			trace := float64(j[Jxx] + j[Jyy])
+			if trace <= 0 {
+				continue
+			}
+			d := float64(j[Jxx] - j[Jyy])
+			diff := math.Sqrt(d*d + 4*float64(j[Jxy])*float64(j[Jxy]))
+			coherence.Set(x, y, 0, float32(math.Min(diff/trace, 1)))
+		}
+	}
+	return coherence
+}
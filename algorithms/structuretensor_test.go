@@ -0,0 +1,205 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestStructureTensor(t *testing.T) {
+	// on a linear image a*x + b*y the gradient is (a, b) everywhere, so the
+	// tensor is (a², ab, b²) with or without smoothing
+	tests := []struct {
+		a, b  float32
+		sigma float32
+	}{
+		{2, 0, 0},
+		{0, -3, 1},
+		{1, 2, 1.5},
+		{-2, 0.5, 2},
+	}
+	r := image.Rect(0, 0, 16, 12)
+	for _, tt := range tests {
+		img := floatimage.NewFloatImg(r, 1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.Set(x, y, 0, 100+tt.a*float32(x)+tt.b*float32(y))
+			}
+		}
+		tensor := StructureTensor(img, tt.sigma)
+		if tensor.Chancnt != 3 {
+			t.Fatalf("tensor has %d channels", tensor.Chancnt)
+		}
+		want := [3]float64{float64(tt.a * tt.a), float64(tt.a * tt.b), float64(tt.b * tt.b)}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				j := tensor.AtF(x, y)
+				for c := range want {
+					if !near(float64(j[c]), want[c], 1e-4) {
+						t.Errorf("gradient (%.1f, %.1f) sigma %.1f: tensor at %d, %d = %v, want %v",
+							tt.a, tt.b, tt.sigma, x, y, j, want)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestStructureTensorSymmetry(t *testing.T) {
+	// transposing the image swaps Jxx and Jyy and keeps Jxy, and the
+	// smoothed tensor stays positive semidefinite
+	r := image.Rect(0, 0, 20, 14)
+	img := floatimage.NewFloatImg(r, 1)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, 0, pattern(float64(x), float64(y))+float32(x*y%5))
+		}
+	}
+	for _, sigma := range []float32{0, 1, 2} {
+		tensor := StructureTensor(img, sigma)
+		transposed := StructureTensor(img.Transpose(), sigma)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				j, jt := tensor.AtF(x, y), transposed.AtF(y, x)
+				eps := 1e-5 * (1 + float64(j[Jxx]+j[Jyy]))
+				if !near(float64(j[Jxx]), float64(jt[Jyy]), eps) ||
+					!near(float64(j[Jxy]), float64(jt[Jxy]), eps) ||
+					!near(float64(j[Jyy]), float64(jt[Jxx]), eps) {
+					t.Errorf("sigma %.0f: tensor at %d, %d = %v, transposed %v", sigma, x, y, j, jt)
+				}
+				trace := float64(j[Jxx] + j[Jyy])
+				if det := float64(j[Jxx])*float64(j[Jyy]) - float64(j[Jxy])*float64(j[Jxy]); det < -1e-5*trace*trace {
+					t.Errorf("sigma %.0f: tensor at %d, %d = %v has determinant %f", sigma, x, y, j, det)
+				}
+			}
+		}
+	}
+}
+
+// stripes returns a single channel image covering r of parallel stripes
+// whose gray value varies along the direction theta with wave number k
+func stripes(r image.Rectangle, theta, k float64) *floatimage.FloatImg {
+	img := floatimage.NewFloatImg(r, 1)
+	sin, cos := math.Sincos(theta)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, 0, float32(127.5+100*math.Sin(k*(float64(x)*cos+float64(y)*sin))))
+		}
+	}
+	return img
+}
+
+func TestOrientation(t *testing.T) {
+	r := image.Rect(0, 0, 40, 40)
+	interior := r.Inset(6)
+	tests := []struct {
+		name  string
+		theta float64
+	}{
+		{"vertical stripes", 0},
+		{"horizontal stripes", math.Pi / 2},
+		{"diagonal stripes", math.Pi / 4},
+		{"steep stripes", -math.Pi / 3},
+		{"flat stripes", 1.2},
+	}
+	for _, tt := range tests {
+		orientation := Orientation(stripes(r, tt.theta, 0.4), 2)
+		if orientation.Bounds() != r || orientation.Chancnt != 1 {
+			t.Fatalf("%s: orientation bounds %v with %d channels", tt.name, orientation.Bounds(), orientation.Chancnt)
+		}
+		for y := interior.Min.Y; y < interior.Max.Y; y++ {
+			for x := interior.Min.X; x < interior.Max.X; x++ {
+				got := float64(orientation.AtF(x, y)[0])
+				if got <= -float64(float32(math.Pi/2)) || got > float64(float32(math.Pi/2)) {
+					t.Fatalf("%s: orientation %f at %d, %d out of range", tt.name, got, x, y)
+				}
+				// the orientation is only defined up to π
+				if d := math.Remainder(got-tt.theta, math.Pi); math.Abs(d) > 0.02 {
+					t.Fatalf("%s: orientation %f at %d, %d, want %f", tt.name, got, x, y, tt.theta)
+				}
+			}
+		}
+	}
+
+	// a vertical gradient gives Jxy = 0 * Iy, negative zero for falling
+	// values, which must still give π/2 and not -π/2
+	for _, slope := range []float32{3, -3} {
+		ramp := floatimage.NewFloatImg(r, 1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				ramp.Set(x, y, 0, 100+slope*float32(y))
+			}
+		}
+		for i, v := range Orientation(ramp, 0).Pix {
+			if v != float32(math.Pi/2) {
+				t.Fatalf("slope %.0f: orientation %f at %d, want π/2", slope, v, i)
+			}
+		}
+	}
+
+	flat := floatimage.NewFloatImg(r, 1)
+	for i := range flat.Pix {
+		flat.Pix[i] = 42
+	}
+	for i, v := range Orientation(flat, 1).Pix {
+		if v != 0 {
+			t.Fatalf("flat image: orientation %f at %d, want 0", v, i)
+		}
+	}
+}
+
+func TestCoherence(t *testing.T) {
+	r := image.Rect(0, 0, 40, 40)
+	edge := floatimage.NewFloatImg(r, 1)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := 20; x < r.Max.X; x++ {
+			edge.Set(x, y, 0, 200)
+		}
+	}
+	rnd := rand.New(rand.NewSource(1))
+	noise := floatimage.NewFloatImg(r, 1)
+	for i := range noise.Pix {
+		noise.Pix[i] = 255 * rnd.Float32()
+	}
+	tests := []struct {
+		name    string
+		img     *floatimage.FloatImg
+		region  image.Rectangle
+		minMean float64
+		// isotropic texture has no preferred direction on average
+		maxMean, max float64
+	}{
+		{"along the edge", edge, image.Rect(18, 6, 22, 34), 0.99, 1, 1},
+		{"flat next to the edge", edge, image.Rect(0, 0, 8, 40), 0, 0, 0},
+		{"stripes", stripes(r, math.Pi/4, 0.4), r.Inset(6), 0.99, 1, 1},
+		{"isotropic noise", noise, r.Inset(6), 0, 0.2, 0.5},
+	}
+	for _, tt := range tests {
+		coherence := Coherence(tt.img, 3)
+		if coherence.Bounds() != r || coherence.Chancnt != 1 {
+			t.Fatalf("%s: coherence bounds %v with %d channels", tt.name, coherence.Bounds(), coherence.Chancnt)
+		}
+		for _, v := range coherence.Pix {
+			if v < 0 || v > 1 {
+				t.Fatalf("%s: coherence %f out of [0, 1]", tt.name, v)
+			}
+		}
+		var sum float64
+		for y := tt.region.Min.Y; y < tt.region.Max.Y; y++ {
+			for x := tt.region.Min.X; x < tt.region.Max.X; x++ {
+				v := float64(coherence.AtF(x, y)[0])
+				if v > tt.max {
+					t.Errorf("%s: coherence %f at %d, %d, want <= %f", tt.name, v, x, y, tt.max)
+				}
+				sum += v
+			}
+		}
+		mean := sum / float64(tt.region.Dx()*tt.region.Dy())
+		if mean < tt.minMean || mean > tt.maxMean {
+			t.Errorf("%s: mean coherence %f, want %f to %f", tt.name, mean, tt.minMean, tt.maxMean)
+		}
+	}
+}
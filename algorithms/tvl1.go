@@ -0,0 +1,122 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+)
+
+// OpticFlowTVL1 computes the optic flow between f1 and f2 minimizing the TV-L1
+// energy of Zach, Pock & Bischof with the primal-dual thresholding scheme.
+// lambda weights the L1 data term, theta couples the data and the TV step.
+// outerIters is the number of warps, each linearizing the data term around
+// the current flow and running innerIters thresholding and dual steps.
+// It returns the optic flow field as a 2 channel floatimage.FloatImg
+func OpticFlowTVL1(f1, f2 *floatimage.FloatImg, lambda, theta float32, outerIters, innerIters int) (uv *floatimage.FloatImg) {
+	const tau = 0.25
+	const eps = 1e-6
+	bounds := f1.Bounds()
+	lt := lambda * theta
+	step := tau / theta
+
+	uv = floatimage.NewFloatImg(bounds, 2)
+	// dual variables p1 = (channel 0, 1) for u and p2 = (channel 2, 3) for v
+	dual := floatimage.NewFloatImg(bounds, 4)
+	// divergence of p1 and p2
+	div := floatimage.NewFloatImg(bounds, 2)
+	// constant part of the linearized residual
+	rhoC := floatimage.NewFloatImg(bounds, 1)
+	grad2 := f2.Gradient()
+
+	for w := 0; w < outerIters; w++ {
+		warped := WarpBackward(f2, uv)
+		gradW := WarpBackward(grad2, uv)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				g := gradW.AtF(x, y)
+				u := uv.AtF(x, y)
+				rhoC.Set(x, y, 0, warped.AtF(x, y)[0]-f1.AtF(x, y)[0]-g[0]*u[0]-g[1]*u[1])
+			}
+		}
+
+		for k := 0; k < innerIters; k++ {
+			dualDivergence(dual, div)
+			// thresholding step followed by the primal update
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					g := gradW.AtF(x, y)
+					u := uv.AtF(x, y)
+					gg := g[0]*g[0] + g[1]*g[1]
+					rho := rhoC.AtF(x, y)[0] + g[0]*u[0] + g[1]*u[1]
+					var d0, d1 float32
+					switch {
+					case rho < -lt*gg:
+						d0, d1 = lt*g[0], lt*g[1]
+					case rho > lt*gg:
+						d0, d1 = -lt*g[0], -lt*g[1]
+					case gg > eps:
+						d0, d1 = -rho*g[0]/gg, -rho*g[1]/gg
+					}
+					dv := div.AtF(x, y)
+					u[0] += d0 + theta*dv[0]
+					u[1] += d1 + theta*dv[1]
+				}
+			}
+			dualStep(uv, dual, step)
+		}
+	}
+	return
+}
+
+// dualDivergence computes the divergence of the dual fields p1 and p2 with
+// backward differences, it is the negative adjoint of the forward gradient
+func dualDivergence(dual, div *floatimage.FloatImg) {
+	bounds := dual.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := dual.AtF(x, y)
+			d := div.AtF(x, y)
+			for c := 0; c < 2; c++ {
+				px, py := p[2*c], p[2*c+1]
+				switch x {
+				case bounds.Max.X - 1:
+					px = -dual.AtF(x-1, y)[2*c]
+				case bounds.Min.X:
+				default:
+					px -= dual.AtF(x-1, y)[2*c]
+				}
+				switch y {
+				case bounds.Max.Y - 1:
+					py = -dual.AtF(x, y-1)[2*c+1]
+				case bounds.Min.Y:
+				default:
+					py -= dual.AtF(x, y-1)[2*c+1]
+				}
+				d[c] = px + py
+			}
+		}
+	}
+}
+
+// dualStep updates the dual fields with a projected gradient ascent step
+// using the forward differences of the flow uv
+func dualStep(uv, dual *floatimage.FloatImg, step float32) {
+	bounds := uv.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			u := uv.AtF(x, y)
+			p := dual.AtF(x, y)
+			for c := 0; c < 2; c++ {
+				var ux, uy float32
+				if x < bounds.Max.X-1 {
+					ux = uv.AtF(x+1, y)[c] - u[c]
+				}
+				if y < bounds.Max.Y-1 {
+					uy = uv.AtF(x, y+1)[c] - u[c]
+				}
+				norm := float32(1.0 + float64(step)*math.Sqrt(float64(ux*ux+uy*uy)))
+				p[2*c] = (p[2*c] + step*ux) / norm
+				p[2*c+1] = (p[2*c+1] + step*uy) / norm
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+// boundaryPair returns w x h images with dummy borders where the left half
+// holds a foreground texture moving by (u, 0) over the static pattern of the
+// right half, truth is the true flow with a sharp motion boundary at x = w/2
+func boundaryPair(w, h int, u float64) (f1, f2, truth *floatimage.FloatImg) {
+	fg := func(x, y float64) float32 {
+		return float32(127.5 + 60*math.Sin(0.7*x+0.3*y) + 40*math.Cos(0.5*y-0.4*x))
+	}
+	edge := float64(w / 2)
+	f1 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	f2 = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 1)
+	truth = floatimage.NewFloatImg(image.Rect(0, 0, w, h), 2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x), float64(y)
+			if fx < edge {
+				f1.Set(x, y, 0, fg(fx, fy))
+				truth.Set(x, y, 0, float32(u))
+			} else {
+				f1.Set(x, y, 0, pattern(fx, fy))
+			}
+			if fx-u < edge {
+				f2.Set(x, y, 0, fg(fx-u, fy))
+			} else {
+				f2.Set(x, y, 0, pattern(fx, fy))
+			}
+		}
+	}
+	return f1.AddDummies(), f2.AddDummies(), truth.AddDummies()
+}
+
+// fieldEPE is the mean endpoint error of flow against truth over r
+func fieldEPE(flow, truth *floatimage.FloatImg, r image.Rectangle) float64 {
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a, b := flow.AtF(x, y), truth.AtF(x, y)
+			sum += math.Hypot(float64(a[0]-b[0]), float64(a[1]-b[1]))
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+func TestOpticFlowTVL1(t *testing.T) {
+	const w, h = 48, 32
+	tests := []struct {
+		u float64
+	}{
+		{1},
+		{1.5},
+		{2},
+	}
+	interior := image.Rect(0, 0, w, h).Inset(3)
+	// the band of 4 pixels on each side of the motion boundary
+	band := image.Rect(w/2-4, 3, w/2+4, h-3)
+	for _, tt := range tests {
+		f1, f2, truth := boundaryPair(w, h, tt.u)
+		hs := OpticFlowHornSchunk(f1, f2, 20, 2000)
+		tv := OpticFlowTVL1(f1, f2, 0.05, 0.3, 10, 50)
+
+		hsBand, tvBand := fieldEPE(hs, truth, band), fieldEPE(tv, truth, band)
+		if tvBand > hsBand/2 {
+			t.Errorf("u %.1f: EPE at the boundary %.3f, Horn & Schunk %.3f", tt.u, tvBand, hsBand)
+		}
+		hsEPE, tvEPE := fieldEPE(hs, truth, interior), fieldEPE(tv, truth, interior)
+		if tvEPE > hsEPE/2 {
+			t.Errorf("u %.1f: EPE %.3f, Horn & Schunk %.3f", tt.u, tvEPE, hsEPE)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"math"
+	"sync"
+)
+
+// MaxMagnitude returns the largest vector length of the 2 channel flow field,
+// the rows are scanned in parallel chunks
+func MaxMagnitude(flow *floatimage.FloatImg) float32 {
+	bounds := flow.Bounds()
+	var max float32
+	var mu sync.Mutex
+	floatimage.ParallelRows(bounds, 0, func(minY, maxY int) {
+		var chunkMax float32
+		for y := minY; y < maxY; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				vec := flow.AtF(x, y)
+				if m := vec[0]*vec[0] + vec[1]*vec[1]; m > chunkMax {
+					chunkMax = m
+				}
+			}
+		}
+		mu.Lock()
+		if chunkMax > max {
+			max = chunkMax
+		}
+		mu.Unlock()
+	})
+	return float32(math.Sqrt(float64(max)))
+}
+
+// hsvToRGB converts hue (degrees), saturation and value (0 <= s, v <= 1) to
+// RGB values in the range 0 <= c <= 255
+func hsvToRGB(h, s, v float64) (r, g, b float32) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+	return float32(255 * (rf + m)), float32(255 * (gf + m)), float32(255 * (bf + m))
+}
+
+// FlowToColor visualizes the 2 channel flow field as 3 channel RGB image, the
+// hue encodes the direction and the saturation the magnitude relative to
+// maxMag so zero motion is white. Magnitudes above maxMag are saturated, a
+// maxMag <= 0 uses the largest magnitude of the field
+func FlowToColor(flow *floatimage.FloatImg, maxMag float32) *floatimage.FloatImg {
+	if maxMag <= 0 {
+		maxMag = MaxMagnitude(flow)
+	}
+	bounds := flow.Bounds()
+	colorImg := floatimage.NewFloatImg(bounds, 3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			mag := math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1]))
+			sat := 0.0
+			if maxMag > 0 {
+				sat = math.Min(mag/float64(maxMag), 1)
+			}
+			hue := math.Atan2(float64(vec[1]), float64(vec[0])) * 180 / math.Pi
+			rgb := colorImg.AtF(x, y)
+			rgb[0], rgb[1], rgb[2] = hsvToRGB(hue, sat, 1)
+		}
+	}
+	return colorImg
+}
+
+// DirectionHistogram accumulates the magnitude of each vector of the 2 channel
+// flow field into one of bins equally sized angular bins, bin 0 starts at the
+// direction -π (left) and the bins proceed like atan2(v, u). The histogram is
+// normalized to sum up to 1 unless the flow is zero everywhere
+func DirectionHistogram(flow *floatimage.FloatImg, bins int) []float32 {
+	hist := make([]float32, bins)
+	if bins < 1 {
+		return hist
+	}
+	bounds := flow.Bounds()
+	var total float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			mag := math.Sqrt(float64(vec[0]*vec[0] + vec[1]*vec[1]))
+			if mag == 0 {
+				continue
+			}
+			angle := math.Atan2(float64(vec[1]), float64(vec[0]))
+			bin := int((angle + math.Pi) / (2 * math.Pi) * float64(bins))
+			if bin >= bins {
+				bin = bins - 1
+			}
+			hist[bin] += float32(mag)
+			total += mag
+		}
+	}
+	if total > 0 {
+		for i := range hist {
+			hist[i] = float32(float64(hist[i]) / total)
+		}
+	}
+	return hist
+}
+
+// middleburyWheel is the color wheel of the Middlebury flow color code by
+// Baker et al., 55 colors running through red, yellow, green, cyan, blue and
+// magenta with the segment lengths 15, 6, 4, 11, 13 and 6
+var middleburyWheel = func() [][3]float32 {
+	const ry, yg, gc, cb, bm, mr = 15, 6, 4, 11, 13, 6
+	wheel := make([][3]float32, 0, ry+yg+gc+cb+bm+mr)
+	ramp := func(i, n int) float32 { return float32(math.Floor(255 * float64(i) / float64(n))) }
+	for i := 0; i < ry; i++ {
+		wheel = append(wheel, [3]float32{255, ramp(i, ry), 0})
+	}
+	for i := 0; i < yg; i++ {
+		wheel = append(wheel, [3]float32{255 - ramp(i, yg), 255, 0})
+	}
+	for i := 0; i < gc; i++ {
+		wheel = append(wheel, [3]float32{0, 255, ramp(i, gc)})
+	}
+	for i := 0; i < cb; i++ {
+		wheel = append(wheel, [3]float32{0, 255 - ramp(i, cb), 255})
+	}
+	for i := 0; i < bm; i++ {
+		wheel = append(wheel, [3]float32{ramp(i, bm), 0, 255})
+	}
+	for i := 0; i < mr; i++ {
+		wheel = append(wheel, [3]float32{255, 0, 255 - ramp(i, mr)})
+	}
+	return wheel
+}()
+
+// middleburyColor returns the color of the flow vector u, v normalized to the
+// unit disc, interpolating between the wheel colors around the direction.
+// Inside the unit disc the saturation rises with the length, longer vectors
+// are darkened
+func middleburyColor(u, v float32) (rgb [3]float32) {
+	n := len(middleburyWheel)
+	rad := math.Sqrt(float64(u*u + v*v))
+	a := math.Atan2(float64(-v), float64(-u)) / math.Pi
+	fk := (a + 1) / 2 * float64(n-1)
+	k0 := int(fk)
+	k1 := (k0 + 1) % n
+	f := fk - float64(k0)
+	for c := range rgb {
+		col := (1-f)*float64(middleburyWheel[k0][c])/255 + f*float64(middleburyWheel[k1][c])/255
+		if rad <= 1 {
+			col = 1 - rad*(1-col)
+		} else {
+			col *= 0.75
+		}
+		rgb[c] = float32(int(255 * col))
+	}
+	return
+}
+
+// StandardFlowColor visualizes the 2 channel flow field as 3 channel RGB image
+// with the Middlebury color code of Baker et al. which is widely used to
+// compare flow results. The vectors are normalized by the largest magnitude,
+// the hue encodes the direction and the saturation the magnitude so zero
+// motion is white
+func StandardFlowColor(flow *floatimage.FloatImg) *floatimage.FloatImg {
+	maxMag := MaxMagnitude(flow)
+	if maxMag == 0 {
+		maxMag = 1
+	}
+	bounds := flow.Bounds()
+	colorImg := floatimage.NewFloatImg(bounds, 3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			rgb := middleburyColor(vec[0]/maxMag, vec[1]/maxMag)
+			copy(colorImg.AtF(x, y), rgb[:])
+		}
+	}
+	return colorImg
+}
+
+// FlowDifferenceImage visualizes the endpoint error vectors a - b of two 2
+// channel flow fields with the same bounds like FlowToColor, the hue encodes
+// the direction of the error and the saturation its magnitude clamped to
+// maxErr. Where the fields agree the result is white
+func FlowDifferenceImage(a, b *floatimage.FloatImg, maxErr float32) *floatimage.FloatImg {
+	bounds := a.Bounds()
+	diff := floatimage.NewFloatImg(bounds, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			va, vb, d := a.AtF(x, y), b.AtF(x, y), diff.AtF(x, y)
+			d[0], d[1] = va[0]-vb[0], va[1]-vb[1]
+		}
+	}
+	return FlowToColor(diff, maxErr)
+}
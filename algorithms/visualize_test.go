@@ -0,0 +1,247 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomFlow returns a 2 channel field covering r with random vectors in
+// [-scale, scale)²
+func randomFlow(r image.Rectangle, scale float32, seed int64) *floatimage.FloatImg {
+	rng := rand.New(rand.NewSource(seed))
+	flow := floatimage.NewFloatImg(r, 2)
+	for i := range flow.Pix {
+		flow.Pix[i] = scale * (2*rng.Float32() - 1)
+	}
+	return flow
+}
+
+// serialMaxMagnitude is the plain scan MaxMagnitude is checked against
+func serialMaxMagnitude(flow *floatimage.FloatImg) float32 {
+	bounds := flow.Bounds()
+	var max float32
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			if m := vec[0]*vec[0] + vec[1]*vec[1]; m > max {
+				max = m
+			}
+		}
+	}
+	return float32(math.Sqrt(float64(max)))
+}
+
+func TestMaxMagnitudeMatchesSerial(t *testing.T) {
+	tests := []image.Rectangle{
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 7, 3),
+		image.Rect(-5, 10, 300, 17),
+		image.Rect(3, -4, 40, 2000),
+		image.Rect(0, 0, 517, 389),
+	}
+	for i, r := range tests {
+		flow := randomFlow(r, 10, int64(i))
+		// a single long vector in the last row
+		copy(flow.AtF(r.Max.X-1, r.Max.Y-1), []float32{-30, 40})
+		got, want := MaxMagnitude(flow), serialMaxMagnitude(flow)
+		if got != want || want != 50 {
+			t.Errorf("%v: MaxMagnitude %f, serial %f, want 50", r, got, want)
+		}
+	}
+	if got := MaxMagnitude(floatimage.NewFloatImg(image.Rect(0, 0, 20, 20), 2)); got != 0 {
+		t.Errorf("zero flow: MaxMagnitude %f, want 0", got)
+	}
+}
+
+func BenchmarkMaxMagnitude(b *testing.B) {
+	flow := randomFlow(image.Rect(0, 0, 2048, 2048), 10, 1)
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			serialMaxMagnitude(flow)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MaxMagnitude(flow)
+		}
+	})
+}
+
+func TestDirectionHistogram(t *testing.T) {
+	// left half moves right by 2, right half moves up by 1
+	twoWay := floatimage.NewFloatImg(image.Rect(0, 0, 16, 8), 2)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			vec := twoWay.AtF(x, y)
+			if x < 8 {
+				vec[0] = 2
+			} else {
+				vec[1] = -1
+			}
+		}
+	}
+	tests := []struct {
+		name string
+		flow *floatimage.FloatImg
+		bins int
+		want []float32
+	}{
+		{"two directions", twoWay, 8, []float32{0, 0, 1.0 / 3, 0, 2.0 / 3, 0, 0, 0}},
+		{"two directions 4 bins", twoWay, 4, []float32{0, 1.0 / 3, 2.0 / 3, 0}},
+		{"single bin", twoWay, 1, []float32{1}},
+		{"zero flow", floatimage.NewFloatImg(image.Rect(0, 0, 4, 4), 2), 4, []float32{0, 0, 0, 0}},
+		{"no bins", twoWay, 0, []float32{}},
+	}
+	for _, tt := range tests {
+		hist := DirectionHistogram(tt.flow, tt.bins)
+		if len(hist) != len(tt.want) {
+			t.Errorf("%s: %d bins, want %d", tt.name, len(hist), len(tt.want))
+			continue
+		}
+		for i := range hist {
+			if math.Abs(float64(hist[i]-tt.want[i])) > 1e-6 {
+				t.Errorf("%s: bin %d is %f, want %f", tt.name, i, hist[i], tt.want[i])
+			}
+		}
+	}
+
+	// jittered vectors spread over neighboring bins but still give exactly
+	// two peaks at the two dominant directions
+	rnd := rand.New(rand.NewSource(3))
+	jittered := twoWay.Clone()
+	for i := range jittered.Pix {
+		jittered.Pix[i] += float32(rnd.NormFloat64()) * 0.15
+	}
+	const bins = 16
+	hist := DirectionHistogram(jittered, bins)
+	var sum float32
+	var peaks []int
+	for i, h := range hist {
+		sum += h
+		if h > 0.1 && h > hist[(i+bins-1)%bins] && h > hist[(i+1)%bins] {
+			peaks = append(peaks, i)
+		}
+	}
+	if math.Abs(float64(sum-1)) > 1e-5 {
+		t.Errorf("histogram sums up to %f", sum)
+	}
+	// right is at angle 0, the bins 7 and 8 meet there, up at -π/2 is
+	// between 3 and 4
+	if len(peaks) != 2 || (peaks[0] != 3 && peaks[0] != 4) || (peaks[1] != 7 && peaks[1] != 8) {
+		t.Errorf("peaks at %v in %v, want one at bin 3 or 4 and one at 7 or 8", peaks, hist)
+	}
+}
+
+func TestStandardFlowColor(t *testing.T) {
+	if n := len(middleburyWheel); n != 55 {
+		t.Fatalf("color wheel with %d colors, want 55", n)
+	}
+	// the reference colors of the Middlebury computeColor code for vectors
+	// relative to the largest magnitude 2 in the field
+	tests := []struct {
+		name string
+		u, v float32
+		want [3]float32
+	}{
+		{"zero", 0, 0, [3]float32{255, 255, 255}},
+		{"right", 2, 0, [3]float32{255, 0, 0}},
+		{"left", -2, 0, [3]float32{0, 209, 255}},
+		{"down", 0, 2, [3]float32{255, 229, 0}},
+		{"up", 0, -2, [3]float32{88, 0, 255}},
+		{"half right", 1, 0, [3]float32{255, 127, 127}},
+		{"half left", -1, 0, [3]float32{127, 232, 255}},
+	}
+	flow := floatimage.NewFloatImg(image.Rect(3, -1, 3+len(tests), 0), 2)
+	for i, tt := range tests {
+		vec := flow.AtF(3+i, -1)
+		vec[0], vec[1] = tt.u, tt.v
+	}
+	colors := StandardFlowColor(flow)
+	if colors.Bounds() != flow.Bounds() || colors.Chancnt != 3 {
+		t.Fatalf("color image bounds %v with %d channels", colors.Bounds(), colors.Chancnt)
+	}
+	for i, tt := range tests {
+		got := colors.AtF(3+i, -1)
+		if got[0] != tt.want[0] || got[1] != tt.want[1] || got[2] != tt.want[2] {
+			t.Errorf("%s: color %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// outside of the unit disc the colors are darkened
+	if got, want := middleburyColor(2, 0), [3]float32{191, 0, 0}; got != want {
+		t.Errorf("vector of length 2: color %v, want %v", got, want)
+	}
+	// a zero field is white instead of dividing by 0
+	for i, v := range StandardFlowColor(constantFlow(image.Rect(0, 0, 3, 3), 0, 0)).Pix {
+		if v != 255 {
+			t.Fatalf("zero field: value %d is %f, want 255", i, v)
+		}
+	}
+}
+
+func TestFlowDifferenceImage(t *testing.T) {
+	bounds := image.Rect(-2, 1, 14, 11)
+	a := randomFlow(bounds, 3, 7)
+
+	// error vectors a - b in three regions, zero elsewhere
+	regions := []struct {
+		name    string
+		r       image.Rectangle
+		du, dv  float32
+		wantRGB [3]float32
+	}{
+		{"right", image.Rect(-2, 1, 2, 4), 2, 0, [3]float32{255, 0, 0}},
+		{"half left", image.Rect(5, 5, 9, 8), -1, 0, [3]float32{127.5, 255, 255}},
+		// clamped to maxErr
+		{"far down", image.Rect(10, 8, 14, 11), 0, 8, [3]float32{127.5, 255, 0}},
+	}
+	b := a.Clone()
+	for _, reg := range regions {
+		for y := reg.r.Min.Y; y < reg.r.Max.Y; y++ {
+			for x := reg.r.Min.X; x < reg.r.Max.X; x++ {
+				vec := b.AtF(x, y)
+				vec[0] -= reg.du
+				vec[1] -= reg.dv
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		b      *floatimage.FloatImg
+		maxErr float32
+	}{
+		{"identical", a.Clone(), 2},
+		{"identical without maxErr", a.Clone(), 0},
+		{"regions", b, 2},
+	}
+	for _, tt := range tests {
+		img := FlowDifferenceImage(a, tt.b, tt.maxErr)
+		if img.Bounds() != bounds || img.Chancnt != 3 {
+			t.Fatalf("%s: bounds %v with %d channels", tt.name, img.Bounds(), img.Chancnt)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := [3]float32{255, 255, 255}
+				if tt.b == b {
+					for _, reg := range regions {
+						if (image.Point{x, y}).In(reg.r) {
+							want = reg.wantRGB
+						}
+					}
+				}
+				got := img.AtF(x, y)
+				for c := range want {
+					// the subtraction of the random vectors rounds
+					if math.Abs(float64(got[c]-want[c])) > 0.5 {
+						t.Errorf("%s: color at (%d, %d) is %v, want %v", tt.name, x, y, got, want)
+						break
+					}
+				}
+			}
+		}
+	}
+}
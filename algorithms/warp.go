@@ -0,0 +1,97 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+)
+
+// WarpBackward warps img by the optic flow field uv so that the result at x,y
+// holds the bilinearly interpolated value of img at (x+u, y+v).
+// For a flow computed between f1 and f2, warping f2 backward should reproduce
+// f1, regions where the warped image doesn't match f1 indicate flow errors
+// (or occlusions)
+func WarpBackward(img, uv *floatimage.FloatImg) *floatimage.FloatImg {
+	return warpBackwardInto(floatimage.NewFloatImg(img.Bounds(), img.Chancnt), img, uv)
+}
+
+// warpBackwardInto is WarpBackward storing the result in warped which needs
+// to have the same bounds and channel count as img
+func warpBackwardInto(warped, img, uv *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := img.Bounds()
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			vec := uv.AtF(i, j)
+			img.AtBilinear(float32(i)+vec[0], float32(j)+vec[1], warped.AtF(i, j))
+		}
+	}
+	return warped
+}
+
+// WarpResidual returns the single channel image f1 - WarpBackward(f2, flow)
+// of channel 0, the brightness constancy error the data term of the solver
+// minimizes. It is near zero where the flow is correct
+func WarpResidual(f1, f2, flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := f1.Bounds()
+	residual := floatimage.NewFloatImg(bounds, 1)
+	sample := make([]float32, f2.Chancnt)
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			vec := flow.AtF(i, j)
+			f2.AtBilinear(float32(i)+vec[0], float32(j)+vec[1], sample)
+			residual.Set(i, j, 0, f1.AtF(i, j)[0]-sample[0])
+		}
+	}
+	return residual
+}
+
+// ComposeFlow concatenates the flow first (frame 0 to 1) and second (frame 1
+// to 2) into the flow from frame 0 to 2,
+//
+//	first(x) + second(x + first(x))
+//
+// sampling second bilinearly at the displaced positions
+func ComposeFlow(first, second *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := first.Bounds()
+	composed := floatimage.NewFloatImg(bounds, 2)
+	sample := make([]float32, second.Chancnt)
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			vec := first.AtF(i, j)
+			second.AtBilinear(float32(i)+vec[0], float32(j)+vec[1], sample)
+			out := composed.AtF(i, j)
+			out[0], out[1] = vec[0]+sample[0], vec[1]+sample[1]
+		}
+	}
+	return composed
+}
+
+// AccumulateFlows composes the consecutive flows of a sequence (flows[k]
+// from frame k to k+1) with ComposeFlow into the flow from frame 0 to frame
+// len(flows). It returns nil for an empty sequence
+func AccumulateFlows(flows []*floatimage.FloatImg) *floatimage.FloatImg {
+	if len(flows) == 0 {
+		return nil
+	}
+	total := flows[0].Clone()
+	for _, next := range flows[1:] {
+		total = ComposeFlow(total, next)
+	}
+	return total
+}
+
+// WarpColor warps the 3 channel color image srcColor backward by the 2
+// channel flow like WarpBackward, sampling all channels bilinearly at the
+// same positions. This applies a flow computed on the luminance to the color
+// frame. The flow may have dummy borders around the bounds of srcColor (see
+// floatimage.RGBFloatFromImage and floatimage.GrayFloatWithDummiesFromImage),
+// the result covers the bounds of srcColor
+func WarpColor(srcColor, flow *floatimage.FloatImg) *floatimage.FloatImg {
+	bounds := srcColor.Bounds()
+	warped := floatimage.NewFloatImg(bounds, srcColor.Chancnt)
+	for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+		for i := bounds.Min.X; i < bounds.Max.X; i++ {
+			vec := flow.AtF(i, j)
+			srcColor.AtBilinear(float32(i)+vec[0], float32(j)+vec[1], warped.AtF(i, j))
+		}
+	}
+	return warped
+}
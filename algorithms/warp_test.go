@@ -0,0 +1,213 @@
+package algorithms
+
+import (
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestWarpBackwardBoundary(t *testing.T) {
+	// a single row 10 20 30 40 warped by u, so the edge pixels sample at
+	// x = -0.5 and x = 3.5 for u = ∓0.5 and at x = -1.25 for u = -1.25
+	tests := []struct {
+		mode                floatimage.BoundaryMode
+		left, right, farOut float32
+	}{
+		// outside values 10 10 | 10 20 30 40 | 40 40
+		{floatimage.BoundaryReplicate, 10, 40, 10},
+		// outside values 30 20 | 10 20 30 40 | 30 20
+		{floatimage.BoundaryMirror, 15, 35, 22.5},
+		// outside values 0 0 | 10 20 30 40 | 0 0
+		{floatimage.BoundaryZero, 5, 20, 0},
+		// outside values 30 40 | 10 20 30 40 | 10 20
+		{floatimage.BoundaryWrap, 25, 25, 37.5},
+	}
+	r := image.Rect(0, 0, 4, 1)
+	for _, tt := range tests {
+		img := floatimage.NewFloatImg(r, 1)
+		copy(img.Pix, []float32{10, 20, 30, 40})
+		img.Boundary = tt.mode
+
+		if got := WarpBackward(img, constantFlow(r, -0.5, 0)).AtF(0, 0)[0]; got != tt.left {
+			t.Errorf("mode %d: left edge %f, want %f", tt.mode, got, tt.left)
+		}
+		if got := WarpBackward(img, constantFlow(r, 0.5, 0)).AtF(3, 0)[0]; got != tt.right {
+			t.Errorf("mode %d: right edge %f, want %f", tt.mode, got, tt.right)
+		}
+		if got := WarpBackward(img, constantFlow(r, -1.25, 0)).AtF(0, 0)[0]; got != tt.farOut {
+			t.Errorf("mode %d: beyond the edge %f, want %f", tt.mode, got, tt.farOut)
+		}
+	}
+}
+
+func TestWarpBackwardMatchesDummies(t *testing.T) {
+	// sampling outside of the interior agrees with the dummy border filled
+	// with the same boundary mode
+	for _, mode := range []floatimage.BoundaryMode{
+		floatimage.BoundaryReplicate,
+		floatimage.BoundaryMirror,
+		floatimage.BoundaryZero,
+		floatimage.BoundaryWrap,
+	} {
+		img := floatimage.NewFloatImg(image.Rect(0, 0, 5, 4), 1)
+		for i := range img.Pix {
+			img.Pix[i] = float32(i * i % 17)
+		}
+		img.Boundary = mode
+		dummied := img.AddDummies()
+		flow := constantFlow(img.Bounds(), -1, -1)
+		warped := WarpBackward(img, flow)
+		if got, want := warped.AtF(0, 0)[0], dummied.AtF(-1, -1)[0]; got != want {
+			t.Errorf("mode %d: sampled %f, dummy border %f", mode, got, want)
+		}
+	}
+}
+
+func TestWarpResidual(t *testing.T) {
+	// the flow is correct in the left half and zero in the right half
+	f1, f2 := shiftedPair(40, 32, 2, 1)
+	bounds := f1.Bounds()
+	flow := constantFlow(bounds, 2, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := 20; x < bounds.Max.X; x++ {
+			vec := flow.AtF(x, y)
+			vec[0], vec[1] = 0, 0
+		}
+	}
+	residual := WarpResidual(f1, f2, flow)
+	if residual.Bounds() != bounds || residual.Chancnt != 1 {
+		t.Fatalf("residual bounds %v with %d channels", residual.Bounds(), residual.Chancnt)
+	}
+	// away from the border where the warp samples outside of f2
+	var wrong float64
+	for y := 3; y < 28; y++ {
+		for x := 3; x < 37; x++ {
+			r := math.Abs(float64(residual.AtF(x, y)[0]))
+			if x < 20 && r > 1e-3 {
+				t.Errorf("residual %f at %d, %d with the correct flow", r, x, y)
+			}
+			if x >= 20 {
+				wrong += r
+			}
+		}
+	}
+	if mean := wrong / (25 * 17); mean < 10 {
+		t.Errorf("mean residual %f with zero flow, want >= 10", mean)
+	}
+}
+
+func TestAccumulateFlows(t *testing.T) {
+	bounds := image.Rect(-3, 2, 13, 12)
+	tests := []struct {
+		name  string
+		flows [][2]float32
+	}{
+		{"single", [][2]float32{{1, -2}}},
+		{"two", [][2]float32{{1, 0.5}, {-0.25, 2}}},
+		{"three", [][2]float32{{1, 0.5}, {-0.25, 2}, {3, -1}}},
+		{"back and forth", [][2]float32{{2, 0}, {-2, 0}, {0, 1.5}}},
+	}
+	for _, tt := range tests {
+		var flows []*floatimage.FloatImg
+		var sumU, sumV float32
+		for _, f := range tt.flows {
+			flows = append(flows, constantFlow(bounds, f[0], f[1]))
+			sumU += f[0]
+			sumV += f[1]
+		}
+		total := AccumulateFlows(flows)
+		if total.Bounds() != bounds || total.Chancnt != 2 {
+			t.Fatalf("%s: bounds %v with %d channels", tt.name, total.Bounds(), total.Chancnt)
+		}
+		// constant fields extend by replication so the sum holds everywhere
+		for i := 0; i < len(total.Pix); i += 2 {
+			if !near(float64(total.Pix[i]), float64(sumU), 1e-5) || !near(float64(total.Pix[i+1]), float64(sumV), 1e-5) {
+				t.Errorf("%s: vector (%f, %f), want (%f, %f)", tt.name, total.Pix[i], total.Pix[i+1], sumU, sumV)
+				break
+			}
+		}
+		// the input flows are left alone
+		total.Pix[0] = 100
+		if flows[0].Pix[0] != tt.flows[0][0] {
+			t.Errorf("%s: first flow changed to %f", tt.name, flows[0].Pix[0])
+		}
+	}
+
+	if total := AccumulateFlows(nil); total != nil {
+		t.Errorf("empty sequence gives %v, want nil", total)
+	}
+
+	// the second flow is sampled at the positions the first one moved to,
+	// u = 0.5x gives 1 + 0.5(x + 1) after a step of 1 to the right
+	first := constantFlow(bounds, 1, 0)
+	second := linearField(bounds, 0.5, 0, 0, 0)
+	total := AccumulateFlows([]*floatimage.FloatImg{first, second})
+	for x := bounds.Min.X; x < bounds.Max.X-1; x++ {
+		want := 1 + 0.5*float64(x+1)
+		if got := total.AtF(x, 5); !near(float64(got[0]), want, 1e-5) || got[1] != 0 {
+			t.Errorf("linear second flow: vector at x = %d is %v, want (%f, 0)", x, got, want)
+		}
+	}
+}
+
+func TestWarpColor(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 12)
+	channels := []func(x, y int) float32{
+		func(x, y int) float32 { return pattern(float64(x), float64(y)) },
+		func(x, y int) float32 { return float32(10*x + 3*y) },
+		func(x, y int) float32 { return float32((x*7 + y*13) % 50) },
+	}
+	src := floatimage.NewFloatImg(bounds, 3)
+	gray := make([]*floatimage.FloatImg, len(channels))
+	for c, f := range channels {
+		gray[c] = floatimage.NewFloatImg(bounds, 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				src.Set(x, y, c, f(x, y))
+				gray[c].Set(x, y, 0, f(x, y))
+			}
+		}
+	}
+	tests := []struct {
+		name string
+		u, v float32
+		// the flow has a dummy border around the image
+		dummies bool
+	}{
+		{"zero", 0, 0, false},
+		{"integer", 2, -1, false},
+		{"fraction", 0.5, 0.25, false},
+		{"dummy borders", -1.75, 1.5, true},
+	}
+	for _, tt := range tests {
+		flowBounds := bounds
+		if tt.dummies {
+			flowBounds = bounds.Inset(-1)
+		}
+		flow := constantFlow(flowBounds, tt.u, tt.v)
+		warped := WarpColor(src, flow)
+		if warped.Bounds() != bounds || warped.Chancnt != 3 {
+			t.Fatalf("%s: bounds %v with %d channels", tt.name, warped.Bounds(), warped.Chancnt)
+		}
+		// every channel moves like the gray image warped on its own
+		for c := range channels {
+			want := WarpBackward(gray[c], constantFlow(bounds, tt.u, tt.v))
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					if got := warped.AtF(x, y)[c]; got != want.AtF(x, y)[0] {
+						t.Errorf("%s: channel %d at (%d, %d) is %f, want %f", tt.name, c, x, y, got, want.AtF(x, y)[0])
+					}
+				}
+			}
+		}
+	}
+
+	// integer shifts copy the source pixels
+	warped := WarpColor(src, constantFlow(bounds, 2, -1))
+	for c, f := range channels {
+		if got, want := warped.AtF(5, 4)[c], f(7, 3); got != want {
+			t.Errorf("integer shift: channel %d at (5, 4) is %f, want %f", c, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package floatimage
+
+import (
+	"fmt"
+)
+
+// SubtractBackground returns the difference between the image and the
+// background bg which needs to have the same bounds and channel count
+func (p *FloatImg) SubtractBackground(bg *FloatImg) (*FloatImg, error) {
+	bounds := p.Bounds()
+	if !bg.Bounds().Eq(bounds) || bg.Chancnt != p.Chancnt {
+		return nil, fmt.Errorf("background %v with %d channels doesn't match image %v with %d channels",
+			bg.Bounds(), bg.Chancnt, bounds, p.Chancnt)
+	}
+	diff := NewFloatImg(bounds, p.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a, b, d := p.AtF(x, y), bg.AtF(x, y), diff.AtF(x, y)
+			for c := range d {
+				d[c] = a[c] - b[c]
+			}
+		}
+	}
+	return diff, nil
+}
+
+// BackgroundModel estimates the static background of a frame sequence as
+// running average, moving objects fade out while the static content stays
+type BackgroundModel struct {
+	learnRate float32
+	bg        *FloatImg
+}
+
+// NewBackgroundModel creates a background model where each new frame
+// contributes with the weight 0 < learnRate <= 1
+func NewBackgroundModel(learnRate float32) *BackgroundModel {
+	return &BackgroundModel{learnRate: learnRate}
+}
+
+// Update blends frame into the background, the first frame initializes it.
+// All frames need the same bounds and channel count
+func (m *BackgroundModel) Update(frame *FloatImg) {
+	if m.bg == nil {
+		m.bg = frame.Clone()
+		return
+	}
+	bounds := m.bg.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			b, f := m.bg.AtF(x, y), frame.AtF(x, y)
+			for c := range b {
+				b[c] += m.learnRate * (f[c] - b[c])
+			}
+		}
+	}
+}
+
+// Background returns the current background estimate or nil before the
+// first Update, the image is owned by the model and changes with Update
+func (m *BackgroundModel) Background() *FloatImg {
+	return m.bg
+}
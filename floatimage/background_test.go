@@ -0,0 +1,94 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// sceneFrame returns a frame of the static scene (a horizontal ramp) with a
+// bright 4x4 object at x, y
+func sceneFrame(x, y int) *FloatImg {
+	frame := NewFloatImg(image.Rect(0, 0, 24, 12), 1)
+	for j := 0; j < 12; j++ {
+		for i := 0; i < 24; i++ {
+			v := float32(10 * i)
+			if i >= x && i < x+4 && j >= y && j < y+4 {
+				v = 250
+			}
+			frame.Set(i, j, 0, v)
+		}
+	}
+	return frame
+}
+
+func TestBackgroundModel(t *testing.T) {
+	static := sceneFrame(-10, -10)
+	tests := []struct {
+		learnRate    float32
+		staticFrames int
+	}{
+		{0.5, 10},
+		{0.2, 30},
+		{0.05, 60},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		m := NewBackgroundModel(tt.learnRate)
+		if m.Background() != nil {
+			t.Fatal("background before the first frame")
+		}
+		// the object crosses the scene and leaves, the first frame holds
+		// it so it has to fade out
+		for x := 0; x < 24; x += 2 {
+			m.Update(sceneFrame(x, 4))
+		}
+		for k := 0; k < tt.staticFrames; k++ {
+			m.Update(static)
+		}
+		// each static frame reduces the difference by 1 - learnRate
+		bound := 250*math.Pow(1-float64(tt.learnRate), float64(tt.staticFrames)) + 1e-3
+		var maxErr float64
+		bg := m.Background()
+		for i := range bg.Pix {
+			maxErr = math.Max(maxErr, math.Abs(float64(bg.Pix[i]-static.Pix[i])))
+		}
+		if maxErr > bound {
+			t.Errorf("learn rate %.2f after %d static frames: background off by %f, want <= %f",
+				tt.learnRate, tt.staticFrames, maxErr, bound)
+		}
+	}
+}
+
+func TestSubtractBackground(t *testing.T) {
+	frame := sceneFrame(8, 4)
+	diff, err := frame.SubtractBackground(sceneFrame(-10, -10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 24; x++ {
+			want := float32(0)
+			if x >= 8 && x < 12 && y >= 4 && y < 8 {
+				want = 250 - float32(10*x)
+			}
+			if got := diff.AtF(x, y)[0]; got != want {
+				t.Errorf("difference at %d, %d = %f, want %f", x, y, got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		bg   *FloatImg
+	}{
+		{"smaller", NewFloatImg(image.Rect(0, 0, 23, 12), 1)},
+		{"moved", NewFloatImg(image.Rect(1, 0, 25, 12), 1)},
+		{"channels", NewFloatImg(image.Rect(0, 0, 24, 12), 3)},
+	}
+	for _, tt := range tests {
+		if _, err := frame.SubtractBackground(tt.bg); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
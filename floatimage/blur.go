@@ -0,0 +1,139 @@
+package floatimage
+
+import (
+	"fmt"
+	"math"
+)
+
+// gaussKernel returns the normalized 1D Gaussian kernel for sigma truncated
+// at 3 sigma, its center is at index len/2
+func gaussKernel(sigma float32) []float32 {
+	radius := int(math.Ceil(3 * float64(sigma)))
+	if radius < 1 {
+		radius = 1
+	}
+	kernel := make([]float32, 2*radius+1)
+	var sum float32
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = float32(math.Exp(-d * d / (2 * float64(sigma) * float64(sigma))))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// ConvolveSeparable convolves every channel with kernelX along the rows and
+// then with kernelY along the columns, both centered at len/2. Values outside
+// of the image are taken according to the Boundary mode
+func (p *FloatImg) ConvolveSeparable(kernelX, kernelY []float32) *FloatImg {
+	bounds := p.Bounds()
+	tmp := NewFloatImg(bounds, p.Chancnt)
+	tmp.Boundary = p.Boundary
+	rx := len(kernelX) / 2
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out := tmp.AtF(x, y)
+			for k, w := range kernelX {
+				sx, ok := p.Boundary.Resolve(x+k-rx, bounds.Min.X, bounds.Max.X)
+				if !ok {
+					continue
+				}
+				in := p.AtF(sx, y)
+				for c := range out {
+					out[c] += w * in[c]
+				}
+			}
+		}
+	}
+
+	result := NewFloatImg(bounds, p.Chancnt)
+	result.Boundary = p.Boundary
+	ry := len(kernelY) / 2
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out := result.AtF(x, y)
+			for k, w := range kernelY {
+				sy, ok := p.Boundary.Resolve(y+k-ry, bounds.Min.Y, bounds.Max.Y)
+				if !ok {
+					continue
+				}
+				in := tmp.AtF(x, sy)
+				for c := range out {
+					out[c] += w * in[c]
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Convolve2D convolves every channel with the 2D kernel indexed as
+// kernel[y][x] and centered at len/2 in both directions, like
+// ConvolveSeparable the kernel is not mirrored. Values outside of the image
+// are taken according to the Boundary mode. It returns an error if the rows
+// of the kernel differ in length
+func (p *FloatImg) Convolve2D(kernel [][]float32) (*FloatImg, error) {
+	for i, row := range kernel {
+		if len(row) != len(kernel[0]) {
+			return nil, fmt.Errorf("kernel row %d has %d entries, expected %d", i, len(row), len(kernel[0]))
+		}
+	}
+	bounds := p.Bounds()
+	result := NewFloatImg(bounds, p.Chancnt)
+	result.Boundary = p.Boundary
+	if len(kernel) == 0 {
+		return result, nil
+	}
+	rx, ry := len(kernel[0])/2, len(kernel)/2
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out := result.AtF(x, y)
+			for ky, row := range kernel {
+				sy, ok := p.Boundary.Resolve(y+ky-ry, bounds.Min.Y, bounds.Max.Y)
+				if !ok {
+					continue
+				}
+				for kx, w := range row {
+					sx, ok := p.Boundary.Resolve(x+kx-rx, bounds.Min.X, bounds.Max.X)
+					if !ok {
+						continue
+					}
+					in := p.AtF(sx, sy)
+					for c := range out {
+						out[c] += w * in[c]
+					}
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// GaussianBlur smoothes every channel with a Gaussian of standard deviation
+// sigma, a sigma <= 0 returns an unchanged copy
+func (p *FloatImg) GaussianBlur(sigma float32) *FloatImg {
+	if sigma <= 0 {
+		return p.Clone()
+	}
+	kernel := gaussKernel(sigma)
+	return p.ConvolveSeparable(kernel, kernel)
+}
+
+// UnsharpMask sharpens every channel by adding amount times the difference
+// to its GaussianBlur with sigma, img + amount*(img - blurred)
+func (p *FloatImg) UnsharpMask(sigma, amount float32) *FloatImg {
+	sharp := p.GaussianBlur(sigma)
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			in, out := p.AtF(x, y), sharp.AtF(x, y)
+			for c := range out {
+				out[c] = in[c] + amount*(in[c]-out[c])
+			}
+		}
+	}
+	return sharp
+}
@@ -0,0 +1,117 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestConvolve2D(t *testing.T) {
+	// the 3 x 3 image 1 2 3 / 4 5 6 / 7 8 10 at an offset origin, channel 1
+	// holds twice channel 0
+	values := []float32{1, 2, 3, 4, 5, 6, 7, 8, 10}
+	laplace := [][]float32{{0, 1, 0}, {1, -4, 1}, {0, 1, 0}}
+	sobelX := [][]float32{{-1, 0, 1}, {-2, 0, 2}, {-1, 0, 1}}
+	tests := []struct {
+		name     string
+		kernel   [][]float32
+		boundary BoundaryMode
+		want     []float32
+	}{
+		{"laplace replicate", laplace, BoundaryReplicate, []float32{4, 3, 2, 1, 0, 0, -2, -2, -6}},
+		{"laplace zero", laplace, BoundaryZero, []float32{2, 1, -4, -3, 0, -6, -16, -10, -26}},
+		// not mirrored, the right neighbor gets the positive weight
+		{"sobel replicate", sobelX, BoundaryReplicate, []float32{4, 8, 4, 4, 9, 5, 4, 11, 7}},
+		{"single entry", [][]float32{{2}}, BoundaryZero, []float32{2, 4, 6, 8, 10, 12, 14, 16, 20}},
+		// the center of the even sized kernel is entry 1, i.e. it takes the
+		// left neighbor
+		{"even width", [][]float32{{1, 0}}, BoundaryZero, []float32{0, 1, 2, 0, 4, 5, 0, 7, 8}},
+		{"empty", [][]float32{}, BoundaryZero, make([]float32, 9)},
+	}
+	for _, tt := range tests {
+		img := NewFloatImg(image.Rect(-1, 2, 2, 5), 2)
+		img.Boundary = tt.boundary
+		for i, v := range values {
+			img.Pix[2*i], img.Pix[2*i+1] = v, 2*v
+		}
+		result, err := img.Convolve2D(tt.kernel)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Bounds() != img.Bounds() || result.Chancnt != 2 || result.Boundary != tt.boundary {
+			t.Fatalf("%s: result bounds %v with %d channels and boundary %v", tt.name, result.Bounds(), result.Chancnt, result.Boundary)
+		}
+		for i, want := range tt.want {
+			x, y := -1+i%3, 2+i/3
+			if got := result.AtF(x, y); !nearEq(float64(got[0]), float64(want), 1e-6) || !nearEq(float64(got[1]), float64(2*want), 1e-6) {
+				t.Errorf("%s: pixel (%d, %d) is %v, want [%g %g]", tt.name, x, y, got, want, 2*want)
+			}
+		}
+	}
+}
+
+func TestConvolve2DRagged(t *testing.T) {
+	result, err := NewFloatImg(image.Rect(0, 0, 3, 3), 1).Convolve2D([][]float32{{1, 2, 1}, {1, 2}})
+	if err == nil || result != nil {
+		t.Errorf("ragged kernel returned %v, %v, want an error", result, err)
+	}
+}
+
+func TestUnsharpMask(t *testing.T) {
+	// a soft vertical edge from 0 to 100 around x = 16 in channel 0 and the
+	// constant 50 in channel 1
+	bounds := image.Rect(0, 0, 32, 12)
+	img := NewFloatImg(bounds, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			edge := 50 + 50*math.Tanh(0.5*(float64(x)-15.5))
+			img.Set(x, y, 0, float32(edge))
+			img.Set(x, y, 1, 50)
+		}
+	}
+	tests := []struct {
+		name          string
+		sigma, amount float32
+		sharper       bool
+	}{
+		{"zero amount", 2, 0, false},
+		{"zero sigma", 0, 1.5, false},
+		{"sharpen", 2, 1, true},
+		{"strong", 3, 4, true},
+	}
+	origGrad := img.Gradient().AtF(16, 6)[0]
+	for _, tc := range tests {
+		sharp := img.UnsharpMask(tc.sigma, tc.amount)
+		if !sharp.Bounds().Eq(bounds) || sharp.Chancnt != 2 {
+			t.Fatalf("%s: result has bounds %v and %d channels", tc.name, sharp.Bounds(), sharp.Chancnt)
+		}
+		for i, v := range sharp.Pix {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				t.Fatalf("%s: value %f at index %d", tc.name, v, i)
+			}
+		}
+		grad := sharp.Gradient().AtF(16, 6)[0]
+		if tc.sharper && grad <= origGrad*1.1 {
+			t.Errorf("%s: edge gradient %f, want above %f", tc.name, grad, origGrad)
+		}
+		if !tc.sharper {
+			for i, v := range sharp.Pix {
+				if v != img.Pix[i] {
+					t.Fatalf("%s: value %f at index %d, want unchanged %f", tc.name, v, i, img.Pix[i])
+				}
+			}
+		}
+		// the constant channel stays constant
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if v := sharp.AtF(x, y)[1]; math.Abs(float64(v)-50) > 1e-3 {
+					t.Fatalf("%s: constant channel at (%d, %d) = %f", tc.name, x, y, v)
+				}
+			}
+		}
+	}
+	// the input is not modified
+	if img.AtF(16, 6)[0] != float32(50+50*math.Tanh(0.25)) {
+		t.Errorf("input changed to %f", img.AtF(16, 6)[0])
+	}
+}
@@ -0,0 +1,63 @@
+package floatimage
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// maxCensusRadius keeps the (2r+1)²-1 census bits within the 24 bit mantissa
+// of a float32
+const maxCensusRadius = 2
+
+// CensusTransform returns a single channel image holding the census code of
+// channel 0 at each pixel, bit k is set if the k-th neighbor in the
+// (2*radius+1)² window (row by row, skipping the center) is darker than the
+// center. The code only depends on the order of the values so it is invariant
+// to brightness offsets and gains. Neighbors outside of the image are taken
+// according to the Boundary mode, missing ones count as not darker. The codes
+// are stored exactly as integers in the float values which limits radius to
+// 1 <= radius <= 2, other values give an error
+func (p *FloatImg) CensusTransform(radius int) (*FloatImg, error) {
+	if radius < 1 || radius > maxCensusRadius {
+		return nil, fmt.Errorf("census radius %d out of range 1..%d", radius, maxCensusRadius)
+	}
+	bounds := p.Bounds()
+	census := NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			center := p.AtF(x, y)[0]
+			var code uint32
+			bit := uint(0)
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					if dx == 0 && dy == 0 {
+						continue
+					}
+					sx, okx := p.Boundary.Resolve(x+dx, bounds.Min.X, bounds.Max.X)
+					sy, oky := p.Boundary.Resolve(y+dy, bounds.Min.Y, bounds.Max.Y)
+					if okx && oky && p.AtF(sx, sy)[0] < center {
+						code |= 1 << bit
+					}
+					bit++
+				}
+			}
+			census.Set(x, y, 0, float32(code))
+		}
+	}
+	return census, nil
+}
+
+// HammingDistance returns a single channel image holding the number of
+// differing bits between the census codes of a and b at each pixel, the
+// images need the same bounds
+func HammingDistance(a, b *FloatImg) *FloatImg {
+	bounds := a.Bounds()
+	dist := NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			diff := uint32(a.AtF(x, y)[0]) ^ uint32(b.AtF(x, y)[0])
+			dist.Set(x, y, 0, float32(bits.OnesCount32(diff)))
+		}
+	}
+	return dist
+}
@@ -0,0 +1,73 @@
+package floatimage
+
+import (
+	"testing"
+)
+
+func TestCensusTransformBrightnessInvariant(t *testing.T) {
+	img := Sinusoid(20, 15, 0.13, 0.7)
+	for i, v := range Checkerboard(20, 15, 3).Pix {
+		img.Pix[i] += v / 4
+	}
+	brighter := img.Clone()
+	for i := range brighter.Pix {
+		brighter.Pix[i] = 1.5*brighter.Pix[i] + 40
+	}
+	for radius := 1; radius <= 2; radius++ {
+		a, err := img.CensusTransform(radius)
+		if err != nil {
+			t.Fatalf("radius %d: %v", radius, err)
+		}
+		b, err := brighter.CensusTransform(radius)
+		if err != nil {
+			t.Fatalf("radius %d: %v", radius, err)
+		}
+		var nonzero bool
+		for i := range a.Pix {
+			if a.Pix[i] != b.Pix[i] {
+				t.Fatalf("radius %d: code %d differs, %f != %f", radius, i, a.Pix[i], b.Pix[i])
+			}
+			nonzero = nonzero || a.Pix[i] != 0
+		}
+		if !nonzero {
+			t.Errorf("radius %d: all codes are 0", radius)
+		}
+		for _, v := range HammingDistance(a, b).Pix {
+			if v != 0 {
+				t.Fatalf("radius %d: Hamming distance %f, want 0", radius, v)
+			}
+		}
+	}
+}
+
+func TestCensusTransformCode(t *testing.T) {
+	img := NewFloatImg(Checkerboard(3, 3, 1).Bounds(), 1)
+	copy(img.Pix, []float32{
+		1, 9, 2,
+		9, 5, 9,
+		3, 9, 4,
+	})
+	census, err := img.CensusTransform(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the corners are darker than the center: bits 0, 2, 5 and 7
+	if got, want := census.AtF(1, 1)[0], float32(1|1<<2|1<<5|1<<7); got != want {
+		t.Errorf("center code %b, want %b", uint32(got), uint32(want))
+	}
+	other := img.Clone()
+	other.Set(0, 0, 0, 8)
+	census2, _ := other.CensusTransform(1)
+	if got := HammingDistance(census, census2).AtF(1, 1)[0]; got != 1 {
+		t.Errorf("Hamming distance %f, want 1", got)
+	}
+}
+
+func TestCensusTransformRadius(t *testing.T) {
+	img := Checkerboard(8, 8, 2)
+	for _, radius := range []int{-1, 0, 3, 10} {
+		if _, err := img.CensusTransform(radius); err == nil {
+			t.Errorf("radius %d: no error", radius)
+		}
+	}
+}
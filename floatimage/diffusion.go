@@ -0,0 +1,44 @@
+package floatimage
+
+import (
+	"math"
+)
+
+// AnisotropicDiffusion denoises each channel with the explicit Perona-Malik
+// scheme using the conduction function g(d) = exp(-(d/kappa)²) on the
+// differences d to the 4 neighbors. Large differences (edges) conduct less
+// and are thus kept sharp while flat regions get smoothed. For stability
+// lambda should be <= 0.25. Pixels on the border only exchange with the
+// neighbors inside the image
+func (p *FloatImg) AnisotropicDiffusion(iterations int, kappa, lambda float32) *FloatImg {
+	bounds := p.Bounds()
+	cur := p.Clone()
+	next := cur.Clone()
+	conduct := func(d float32) float32 {
+		r := float64(d / kappa)
+		return float32(math.Exp(-r * r))
+	}
+	offsets := [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	for k := 0; k < iterations; k++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				center := cur.AtF(x, y)
+				out := next.AtF(x, y)
+				for c := 0; c < p.Chancnt; c++ {
+					var flux float32
+					for _, o := range offsets {
+						nx, ny := x+o[0], y+o[1]
+						if nx < bounds.Min.X || nx >= bounds.Max.X || ny < bounds.Min.Y || ny >= bounds.Max.Y {
+							continue
+						}
+						d := cur.AtF(nx, ny)[c] - center[c]
+						flux += conduct(d) * d
+					}
+					out[c] = center[c] + lambda*flux
+				}
+			}
+		}
+		cur, next = next, cur
+	}
+	return cur
+}
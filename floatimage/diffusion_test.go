@@ -0,0 +1,103 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noisyStep returns a w x h image with chancnt channels holding a vertical
+// step from 50 to 150 at x = w/2 with uniform noise of amplitude ±noise
+func noisyStep(w, h, chancnt int, noise float32) *FloatImg {
+	rng := rand.New(rand.NewSource(1))
+	img := NewFloatImg(image.Rect(0, 0, w, h), chancnt)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			base := float32(50)
+			if x >= w/2 {
+				base = 150
+			}
+			for c := 0; c < chancnt; c++ {
+				img.Set(x, y, c, base+noise*(2*rng.Float32()-1))
+			}
+		}
+	}
+	return img
+}
+
+// flatStdDev is the standard deviation of channel c over the left half of
+// img excluding a margin of 4 pixels to the step
+func flatStdDev(img *FloatImg, c int) float64 {
+	bounds := img.Bounds()
+	var sum, sq float64
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Dx()/2-4; x++ {
+			v := float64(img.AtF(x, y)[c])
+			sum += v
+			sq += v * v
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return math.Sqrt(sq/float64(n) - mean*mean)
+}
+
+// edgeGradient is the mean difference of channel c across the step
+func edgeGradient(img *FloatImg, c int) float64 {
+	bounds := img.Bounds()
+	x := bounds.Dx() / 2
+	var sum float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		sum += float64(img.AtF(x, y)[c] - img.AtF(x-1, y)[c])
+	}
+	return sum / float64(bounds.Dy())
+}
+
+func TestAnisotropicDiffusion(t *testing.T) {
+	tests := []struct {
+		chancnt       int
+		iterations    int
+		kappa, lambda float32
+	}{
+		{1, 10, 15, 0.2},
+		{1, 30, 20, 0.25},
+		{3, 20, 15, 0.2},
+	}
+	for _, tt := range tests {
+		img := noisyStep(32, 24, tt.chancnt, 8)
+		out := img.AnisotropicDiffusion(tt.iterations, tt.kappa, tt.lambda)
+		blurred := img.GaussianBlur(1.5)
+		for c := 0; c < tt.chancnt; c++ {
+			stdBefore, stdAfter := flatStdDev(img, c), flatStdDev(out, c)
+			if stdAfter > stdBefore/2 {
+				t.Errorf("%+v channel %d: flat std dev %.2f -> %.2f, want at least halved",
+					tt, c, stdBefore, stdAfter)
+			}
+			before, after := edgeGradient(img, c), edgeGradient(out, c)
+			if after < 0.9*before {
+				t.Errorf("%+v channel %d: edge gradient %.1f -> %.1f, want kept",
+					tt, c, before, after)
+			}
+			if blur := edgeGradient(blurred, c); blur > 0.5*before {
+				t.Errorf("%+v channel %d: Gaussian blur keeps edge gradient %.1f of %.1f",
+					tt, c, blur, before)
+			}
+		}
+	}
+}
+
+func TestAnisotropicDiffusionZeroIterations(t *testing.T) {
+	img := noisyStep(8, 8, 1, 8)
+	out := img.AnisotropicDiffusion(0, 15, 0.2)
+	for i := range img.Pix {
+		if out.Pix[i] != img.Pix[i] {
+			t.Fatalf("pixel %d changed from %f to %f", i, img.Pix[i], out.Pix[i])
+		}
+	}
+	out.Pix[0] = -1
+	if img.Pix[0] == -1 {
+		t.Error("result aliases the input")
+	}
+}
@@ -0,0 +1,59 @@
+package floatimage
+
+// featherWeight is the linear ramp weight of the pixel at x, y of a tile
+// covering [minX, maxX) x [minY, maxY), it rises from 1/(overlap+1) at the
+// tile edge to 1 at a distance of overlap pixels
+func featherWeight(x, y, minX, minY, maxX, maxY, overlap int) float32 {
+	d := x - minX
+	if e := maxX - 1 - x; e < d {
+		d = e
+	}
+	if e := y - minY; e < d {
+		d = e
+	}
+	if e := maxY - 1 - y; e < d {
+		d = e
+	}
+	if d >= overlap {
+		return 1
+	}
+	return float32(d+1) / float32(overlap+1)
+}
+
+// FeatherMerge adds tile weighted by a linear ramp over its outer overlap
+// pixels to dst and the weights to the single channel weights image so
+// overlapping tiles blend without seams. Only the part of the tile inside dst
+// is merged, dst needs the channel count of the tile. After all tiles are
+// merged NormalizeFeather turns the weighted sums into the blended result
+func FeatherMerge(dst, weights, tile *FloatImg, overlap int) {
+	tb := tile.Bounds()
+	r := tb.Intersect(dst.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			w := featherWeight(x, y, tb.Min.X, tb.Min.Y, tb.Max.X, tb.Max.Y, overlap)
+			in, out := tile.AtF(x, y), dst.AtF(x, y)
+			for c := range out {
+				out[c] += w * in[c]
+			}
+			weights.AtF(x, y)[0] += w
+		}
+	}
+}
+
+// NormalizeFeather divides the sums accumulated in dst by FeatherMerge by
+// their weights, pixels no tile covered stay 0
+func NormalizeFeather(dst, weights *FloatImg) {
+	bounds := dst.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			w := weights.AtF(x, y)[0]
+			if w == 0 {
+				continue
+			}
+			out := dst.AtF(x, y)
+			for c := range out {
+				out[c] /= w
+			}
+		}
+	}
+}
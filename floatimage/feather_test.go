@@ -0,0 +1,51 @@
+package floatimage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFeatherMerge(t *testing.T) {
+	// two constant tiles overlapping in the columns 3 to 5, the tiles reach
+	// far enough above and below dst that only the horizontal ramps count
+	dst := NewFloatImg(image.Rect(0, 0, 14, 4), 2)
+	weights := NewFloatImg(dst.Bounds(), 1)
+	left := filledImg(image.Pt(-3, -3), 9, 10, 2, 10)
+	right := filledImg(image.Pt(3, -3), 9, 10, 2, 40)
+	for _, tile := range []*FloatImg{left, right} {
+		FeatherMerge(dst, weights, tile, 3)
+	}
+
+	tests := []struct {
+		x      int
+		weight float32
+		want   float32
+	}{
+		{0, 1, 10},
+		{2, 1, 10},
+		// left weights 3/4, 2/4, 1/4 and right weights 1/4, 2/4, 3/4
+		{3, 1, 0.75*10 + 0.25*40},
+		{4, 1, 0.5*10 + 0.5*40},
+		{5, 1, 0.25*10 + 0.75*40},
+		{6, 1, 40},
+		// the right edge of the right tile ramps down but it is alone there
+		{9, 0.75, 40},
+		{11, 0.25, 40},
+		// not covered by any tile
+		{12, 0, 0},
+		{13, 0, 0},
+	}
+	NormalizeFeather(dst, weights)
+	for _, tt := range tests {
+		for y := 0; y < 4; y++ {
+			if w := weights.AtF(tt.x, y)[0]; !nearEq(float64(w), float64(tt.weight), 1e-6) {
+				t.Errorf("weight at %d, %d is %f, want %f", tt.x, y, w, tt.weight)
+			}
+			for c, v := range dst.AtF(tt.x, y) {
+				if !nearEq(float64(v), float64(tt.want), 1e-6) {
+					t.Errorf("channel %d at %d, %d is %f, want %f", c, tt.x, y, v, tt.want)
+				}
+			}
+		}
+	}
+}
@@ -8,12 +8,19 @@
 // as used for example during optic flow analysis.
 // At the moment there is only an interface to the Go image world for
 // single channel FloatImgs that store gray values which are mapped to/from color.Gray
+//
+// Flow fields are 2 channel FloatImgs where channel 0 holds the horizontal
+// displacement u (positive to the right, increasing x) and channel 1 the
+// vertical displacement v (positive downwards, increasing y) of the pixel at
+// x, y. Fields using other conventions can be adapted with
+// SwapFlowComponents and NegateFlow
 package floatimage
 
 import (
 	"image"
 	"image/color"
 	"math"
+	"sort"
 )
 
 // ToColorFunc is applied on a float32 array representing
@@ -23,6 +30,61 @@ type ToColorFunc func(x, y int, data []float32) color.Color
 // ColorModelFunc returns the color.Model used
 type ColorModelFunc func() color.Model
 
+// BoundaryMode determines the values outside of an image, it is used both
+// for filling the dummy borders with Dummies (extending the interior) and
+// by samplers like AtBilinear (extending Rect). For BoundaryReplicate these
+// agree exactly, e.g. sampling anywhere left of the interior yields the first
+// interior column
+type BoundaryMode int
+
+const (
+	// BoundaryReplicate repeats the outermost pixel
+	BoundaryReplicate BoundaryMode = iota
+	// BoundaryMirror reflects about the outermost pixel so min-1 maps to min+1
+	BoundaryMirror
+	// BoundaryZero treats all values outside as 0
+	BoundaryZero
+	// BoundaryWrap continues the image periodically so min-1 maps to max-1,
+	// for panoramas or seamlessly tiling images
+	BoundaryWrap
+)
+
+// Resolve maps the coordinate i to min <= i < max according to the boundary
+// mode, ok is false if the value at i is 0 (BoundaryZero)
+func (m BoundaryMode) Resolve(i, min, max int) (r int, ok bool) {
+	if i >= min && i < max {
+		return i, true
+	}
+	switch m {
+	case BoundaryZero:
+		return 0, false
+	case BoundaryWrap:
+		k := (i - min) % (max - min)
+		if k < 0 {
+			k += max - min
+		}
+		return min + k, true
+	case BoundaryMirror:
+		n := max - min
+		if n == 1 {
+			return min, true
+		}
+		period := 2 * (n - 1)
+		k := (i - min) % period
+		if k < 0 {
+			k += period
+		}
+		if k >= n {
+			k = period - k
+		}
+		return min + k, true
+	}
+	if i < min {
+		return min, true
+	}
+	return max - 1, true
+}
+
 // FloatImg holds float32 image like data with possibly multiple channels
 type FloatImg struct {
 	Pix            []float32
@@ -31,6 +93,7 @@ type FloatImg struct {
 	Chancnt        int
 	ColorFunc      ToColorFunc
 	ColorModelFunc ColorModelFunc
+	Boundary       BoundaryMode
 }
 
 // NewFloatImg creates a new FloatImage with covering the given rectangle and having
@@ -55,7 +118,27 @@ func NewFloatImg(r image.Rectangle, channelCount int) *FloatImg {
 	}
 	return &FloatImg{pix, channelCount * w, r,
 		channelCount, StandardColorFunc,
-		colorModelFunc}
+		colorModelFunc, BoundaryReplicate}
+}
+
+// Recycle returns a zeroed image covering r with channelCount channels that is
+// backed by the Pix of p if it is large enough, otherwise a new image is
+// allocated. This allows reusing buffers for images of shrinking size e.g.
+// across pyramid levels, p must not be used afterwards
+func (p *FloatImg) Recycle(r image.Rectangle, channelCount int) *FloatImg {
+	n := channelCount * r.Dx() * r.Dy()
+	if p == nil || cap(p.Pix) < n {
+		return NewFloatImg(r, channelCount)
+	}
+	pix := p.Pix[:n]
+	for i := range pix {
+		pix[i] = 0
+	}
+	img := NewFloatImg(image.Rectangle{}, channelCount)
+	img.Pix = pix
+	img.Stride = channelCount * r.Dx()
+	img.Rect = r
+	return img
 }
 
 // Implements the ColorModel function of the image interface
@@ -75,6 +158,15 @@ func (p *FloatImg) AtF(x, y int) []float32 {
 	return p.Pix[i : i+p.Chancnt]
 }
 
+// GetF copies the channels at position x,y into out which needs to hold at
+// least Chancnt values. Unlike AtF the result doesn't alias Pix so use AtF
+// to manipulate the image in place and GetF for reads that should stay
+// independent of later changes to the image
+func (p *FloatImg) GetF(x, y int, out []float32) {
+	i := p.PixOffset(x, y)
+	copy(out, p.Pix[i:i+p.Chancnt])
+}
+
 // At implements image.Image by applying ColorFunc on the
 // given image point
 func (p *FloatImg) At(x, y int) color.Color {
@@ -85,6 +177,35 @@ func (p *FloatImg) At(x, y int) color.Color {
 	return p.ColorFunc(x, y, p.Pix[i:i+p.Chancnt])
 }
 
+// AtBilinear writes the bilinearly interpolated channel values at the
+// sub pixel position x,y into out, samples outside of the image are
+// determined by the Boundary mode
+func (p *FloatImg) AtBilinear(x, y float32, out []float32) {
+	bounds := p.Bounds()
+	fx, fy := math.Floor(float64(x)), math.Floor(float64(y))
+	x0, y0 := int(fx), int(fy)
+	ax, ay := x-float32(fx), y-float32(fy)
+
+	for c := 0; c < p.Chancnt; c++ {
+		out[c] = 0
+	}
+	weights := [4]float32{(1 - ax) * (1 - ay), ax * (1 - ay), (1 - ax) * ay, ax * ay}
+	for k, w := range weights {
+		if w == 0 {
+			continue
+		}
+		sx, okx := p.Boundary.Resolve(x0+k%2, bounds.Min.X, bounds.Max.X)
+		sy, oky := p.Boundary.Resolve(y0+k/2, bounds.Min.Y, bounds.Max.Y)
+		if !okx || !oky {
+			continue
+		}
+		chans := p.AtF(sx, sy)
+		for c := 0; c < p.Chancnt; c++ {
+			out[c] += w * chans[c]
+		}
+	}
+}
+
 // Set sets the float32 value val at position x,y for channel c
 func (p *FloatImg) Set(x, y, c int, val float32) {
 	i := p.PixOffset(x, y)
@@ -92,43 +213,116 @@ func (p *FloatImg) Set(x, y, c int, val float32) {
 }
 
 // Copy copies the content of the original image into this image
-// adjusting size as necessary
+// adjusting size as necessary, Pix needs to be large enough to hold the
+// original image. The copy is stored compactly, so orig may be a sub image
 func (p *FloatImg) Copy(orig *FloatImg) {
 	p.Rect = orig.Rect
-	p.Stride = orig.Stride
 	p.Chancnt = orig.Chancnt
-	copy(p.Pix, orig.Pix)
+	p.Stride = orig.Chancnt * orig.Rect.Dx()
+	if p.Stride == orig.Stride {
+		copy(p.Pix, orig.Pix[:p.Stride*orig.Rect.Dy()])
+		return
+	}
+	for y := orig.Rect.Min.Y; y < orig.Rect.Max.Y; y++ {
+		copy(p.Pix[p.PixOffset(orig.Rect.Min.X, y):],
+			orig.Pix[orig.PixOffset(orig.Rect.Min.X, y):orig.PixOffset(orig.Rect.Max.X, y)])
+	}
+}
+
+// Clone returns a deep copy of the image with a compact Pix, it also works
+// for sub images
+func (p *FloatImg) Clone() *FloatImg {
+	bounds := p.Bounds()
+	c := NewFloatImg(bounds, p.Chancnt)
+	c.ColorFunc = p.ColorFunc
+	c.ColorModelFunc = p.ColorModelFunc
+	c.Boundary = p.Boundary
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		copy(c.Pix[c.PixOffset(bounds.Min.X, y):c.PixOffset(bounds.Max.X, y)],
+			p.Pix[p.PixOffset(bounds.Min.X, y):p.PixOffset(bounds.Max.X, y)])
+	}
+	return c
 }
 
-// Dummies sets the outer most row and column to mirroring boundary conditions
+// Dummies sets the outer most row and column according to the Boundary mode
+// applied to the interior, for the default BoundaryReplicate this mirrors
+// the first and last interior rows and columns
 func (f *FloatImg) Dummies() {
 	bounds := f.Bounds()
-	for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
-		chansUp := f.AtF(x, bounds.Min.Y+1)
-		chansLow := f.AtF(x, bounds.Max.Y-2)
-		chansOutUp := f.AtF(x, bounds.Min.Y)
-		chansOutLow := f.AtF(x, bounds.Max.Y-1)
-		for c := 0; c < f.Chancnt; c++ {
-			chansOutLow[c] = chansLow[c]
-			chansOutUp[c] = chansUp[c]
+	interior := bounds.Inset(1)
+	set := func(x, y int) {
+		out := f.AtF(x, y)
+		sx, okx := f.Boundary.Resolve(x, interior.Min.X, interior.Max.X)
+		sy, oky := f.Boundary.Resolve(y, interior.Min.Y, interior.Max.Y)
+		if !okx || !oky {
+			for c := range out {
+				out[c] = 0
+			}
+			return
 		}
+		copy(out, f.AtF(sx, sy))
+	}
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		set(x, bounds.Min.Y)
+		set(x, bounds.Max.Y-1)
+	}
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		set(bounds.Min.X, y)
+		set(bounds.Max.X-1, y)
 	}
+}
 
+// AddDummies returns a copy of the image with a 1 pixel dummy border around
+// its Rect, filled according to the Boundary mode (see Dummies)
+func (p *FloatImg) AddDummies() *FloatImg {
+	bounds := p.Bounds()
+	f := NewFloatImg(bounds.Inset(-1), p.Chancnt)
+	f.ColorFunc = p.ColorFunc
+	f.ColorModelFunc = p.ColorModelFunc
+	f.Boundary = p.Boundary
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		chansLeft := f.AtF(bounds.Min.X+1, y)
-		chansRight := f.AtF(bounds.Max.X-2, y)
-		chansOutLeft := f.AtF(bounds.Min.X, y)
-		chansOutRight := f.AtF(bounds.Max.X-1, y)
-		for c := 0; c < f.Chancnt; c++ {
-			chansOutLeft[c] = chansLeft[c]
-			chansOutRight[c] = chansRight[c]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			copy(f.AtF(x, y), p.AtF(x, y))
 		}
 	}
+	f.Dummies()
+	return f
 }
 
 // Bounds gets the Rect that the FloatImg covers
 func (p *FloatImg) Bounds() image.Rectangle { return p.Rect }
 
+// GrayFloatFromImage creates a single channel FloatImage covering the bounds
+// of the given Image, mapping all colors to Gray float32 values in the range
+// 0.0 <= val <= 255.0 (see GrayValue)
+func GrayFloatFromImage(img image.Image) (f *FloatImg) {
+	bounds := img.Bounds()
+	f = NewFloatImg(bounds, 1)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			f.Set(x, y, 0, GrayValue(img.At(x, y)))
+		}
+	}
+	return
+}
+
+// RGBFloatFromImage creates a 3 channel FloatImage covering the bounds of
+// the given Image holding the red, green and blue values in the range
+// 0.0 <= val <= 255.0, alpha is dropped
+func RGBFloatFromImage(img image.Image) (f *FloatImg) {
+	bounds := img.Bounds()
+	f = NewFloatImg(bounds, 3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			rgb := f.AtF(x, y)
+			rgb[0], rgb[1], rgb[2] = float32(r)/257, float32(g)/257, float32(b)/257
+		}
+	}
+	return
+}
+
 // GrayFloatWithDummiesFromImage Creates a FloatImage from the given Image, mapping
 // all colors to Gray float32 values in the range 0.0 <= val <= 255.0
 func GrayFloatWithDummiesFromImage(img image.Image) (f *FloatImg) {
@@ -140,19 +334,9 @@ func GrayFloatWithDummiesFromImage(img image.Image) (f *FloatImg) {
 
 	f = NewFloatImg(realBounds, 1)
 
-	var gray uint8
-
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			c := img.At(x, y)
-			switch t := c.(type) {
-			case color.Gray:
-				gray = t.Y
-			default:
-				r, g, b, _ := c.RGBA()
-				gray = uint8(((299*r + 587*g + 114*b + 500) / 1000) >> 8)
-			}
-			f.Set(x, y, 0, float32(gray))
+			f.Set(x, y, 0, GrayValue(img.At(x, y)))
 		}
 	}
 
@@ -161,6 +345,20 @@ func GrayFloatWithDummiesFromImage(img image.Image) (f *FloatImg) {
 	return
 }
 
+// GrayValue maps a color to its gray value in the range 0.0 <= val <= 255.0
+// using the ITU-R BT.601 luma weights, color.Gray values are taken as is
+func GrayValue(c color.Color) float32 {
+	var gray uint8
+	switch t := c.(type) {
+	case color.Gray:
+		gray = t.Y
+	default:
+		r, g, b, _ := c.RGBA()
+		gray = uint8(((299*r + 587*g + 114*b + 500) / 1000) >> 8)
+	}
+	return float32(gray)
+}
+
 // Converts to uint8 by truncating to 0 <= val <= 255.0
 func Tu8c(d float32) uint8 {
 	var c uint8
@@ -175,13 +373,40 @@ func Tu8c(d float32) uint8 {
 	return c
 }
 
+// Tu16c converts to uint16 by truncating to 0 <= val <= 65535.0
+func Tu16c(d float32) uint16 {
+	var c uint16
+	switch {
+	case d < 0.0:
+		c = 0
+	case d > 65535.0:
+		c = 65535
+	default:
+		c = uint16(d)
+	}
+	return c
+}
+
+// ToGray16 converts channel 0 to an image.Gray16 covering the same bounds,
+// values are truncated to 0 <= val <= 65535.0 (see Tu16c)
+func (p *FloatImg) ToGray16() *image.Gray16 {
+	bounds := p.Bounds()
+	g := image.NewGray16(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g.SetGray16(x, y, color.Gray16{Tu16c(p.AtF(x, y)[0])})
+		}
+	}
+	return g
+}
+
 // Standard function to convert float[] at image point to color.Color
 func StandardColorFunc(x, y int, data []float32) (c color.Color) {
 	switch len(data) {
 	case 4:
 		c = color.RGBA{Tu8c(data[0]), Tu8c(data[1]), Tu8c(data[2]), Tu8c(data[3])}
 	case 3:
-		c = color.RGBA{Tu8c(data[0]), Tu8c(data[1]), Tu8c(data[2]), 0}
+		c = color.RGBA{Tu8c(data[0]), Tu8c(data[1]), Tu8c(data[2]), 255}
 	case 2:
 		c = color.YCbCr{128, Tu8c(data[0]), Tu8c(data[1])}
 	case 1:
@@ -210,7 +435,23 @@ func (p *FloatImg) SubImage(r image.Rectangle) *FloatImg {
 		Rect:           r,
 		Chancnt:        p.Chancnt,
 		ColorFunc:      p.ColorFunc,
-		ColorModelFunc: p.ColorModelFunc}
+		ColorModelFunc: p.ColorModelFunc,
+		Boundary:       p.Boundary}
+}
+
+// Reorigin returns a view of the image whose Rect is translated so that it
+// starts at newMin, the view shares Pix with the original image. Because
+// PixOffset is relative to Rect.Min the same pixel is found at
+// (x, y) - Rect.Min + newMin in the view
+func (p *FloatImg) Reorigin(newMin image.Point) *FloatImg {
+	return &FloatImg{
+		Pix:            p.Pix,
+		Stride:         p.Stride,
+		Rect:           p.Rect.Add(newMin.Sub(p.Rect.Min)),
+		Chancnt:        p.Chancnt,
+		ColorFunc:      p.ColorFunc,
+		ColorModelFunc: p.ColorModelFunc,
+		Boundary:       p.Boundary}
 }
 
 // Returns the sub image that excludes the 1 pixel dummy borders
@@ -247,9 +488,171 @@ func (p *FloatImg) ScaleToUnsignedByte() {
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
 			for c := 0; c < p.Chancnt; c++ {
+				// an all zero channel (e.g. zero flow) stays zero
+				if max[c] <= 0 {
+					continue
+				}
 				help = 255 * p.AtF(x, y)[c] / max[c]
 				p.Set(x, y, c, help)
 			}
 		}
 	}
 }
+
+// ScaleToUnsignedByteCoupled scales all channels by the same factor so the
+// largest vector magnitude over the channels becomes 255, unlike
+// ScaleToUnsignedByte the direction of vectors (e.g. flow) is preserved.
+// Negative components stay negative, an all zero image stays zero
+func (p *FloatImg) ScaleToUnsignedByteCoupled() {
+	bounds := p.Bounds()
+	var max float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var sq float64
+			for _, v := range p.AtF(x, y) {
+				sq += float64(v) * float64(v)
+			}
+			if sq > max {
+				max = sq
+			}
+		}
+	}
+	if max == 0 {
+		return
+	}
+	factor := float32(255 / math.Sqrt(max))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			chans := p.AtF(x, y)
+			for c := range chans {
+				chans[c] *= factor
+			}
+		}
+	}
+}
+
+// ApplyLUT maps channel in place through the tone curve lut, values from
+// inMin to inMax are mapped linearly onto the LUT indices 0 to len(lut)-1 and
+// the result is interpolated linearly between neighboring entries. Values
+// outside of the range get the first or last entry
+func (p *FloatImg) ApplyLUT(channel int, lut []float32, inMin, inMax float32) {
+	if len(lut) == 0 {
+		return
+	}
+	last := float32(len(lut) - 1)
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			chans := p.AtF(x, y)
+			var pos float32
+			if inMax != inMin {
+				pos = (chans[channel] - inMin) / (inMax - inMin) * last
+			}
+			switch {
+			case pos <= 0:
+				chans[channel] = lut[0]
+			case pos >= last:
+				chans[channel] = lut[len(lut)-1]
+			default:
+				i := int(pos)
+				f := pos - float32(i)
+				chans[channel] = (1-f)*lut[i] + f*lut[i+1]
+			}
+		}
+	}
+}
+
+// PercentileRange computes the lowPct and highPct percentiles (0 <= pct <= 100)
+// of the given channel, values between ranks are linearly interpolated
+func (p *FloatImg) PercentileRange(channel int, lowPct, highPct float32) (low, high float32) {
+	bounds := p.Bounds()
+	if bounds.Empty() {
+		return 0, 0
+	}
+	values := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			values = append(values, float64(p.AtF(x, y)[channel]))
+		}
+	}
+	sort.Float64s(values)
+
+	percentile := func(pct float32) float32 {
+		switch {
+		case pct <= 0:
+			return float32(values[0])
+		case pct >= 100:
+			return float32(values[len(values)-1])
+		}
+		rank := float64(pct) / 100.0 * float64(len(values)-1)
+		i := int(rank)
+		if i+1 >= len(values) {
+			return float32(values[i])
+		}
+		frac := rank - float64(i)
+		return float32(values[i]*(1-frac) + values[i+1]*frac)
+	}
+	return percentile(lowPct), percentile(highPct)
+}
+
+// ScaleRangeToUnsignedByte linearly maps the range low <= val <= high of the given
+// channel to 0 <= val <= 255, values outside the range are clipped
+func (p *FloatImg) ScaleRangeToUnsignedByte(channel int, low, high float32) {
+	bounds := p.Bounds()
+	scale := float32(0.0)
+	if high > low {
+		scale = 255 / (high - low)
+	}
+
+	var help float32
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			help = (p.AtF(x, y)[channel] - low) * scale
+			switch {
+			case help < 0.0:
+				help = 0.0
+			case help > 255.0:
+				help = 255.0
+			}
+			p.Set(x, y, channel, help)
+		}
+	}
+}
+
+// Gradient returns the central difference gradient of channel 0 as 2 channel
+// image with the x derivative in channel 0 and the y derivative in channel 1,
+// on the border of the image the differences are one sided
+func (p *FloatImg) Gradient() *FloatImg {
+	return p.ChannelGradient(0)
+}
+
+// ChannelGradient is like Gradient but for the given channel
+func (p *FloatImg) ChannelGradient(channel int) *FloatImg {
+	bounds := p.Bounds()
+	grad := NewFloatImg(bounds, 2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			x0, x1, y0, y1 := x-1, x+1, y-1, y+1
+			if x0 < bounds.Min.X {
+				x0 = x
+			}
+			if x1 >= bounds.Max.X {
+				x1 = x
+			}
+			if y0 < bounds.Min.Y {
+				y0 = y
+			}
+			if y1 >= bounds.Max.Y {
+				y1 = y
+			}
+			g := grad.AtF(x, y)
+			if x1 > x0 {
+				g[0] = (p.AtF(x1, y)[channel] - p.AtF(x0, y)[channel]) / float32(x1-x0)
+			}
+			if y1 > y0 {
+				g[1] = (p.AtF(x, y1)[channel] - p.AtF(x, y0)[channel]) / float32(y1-y0)
+			}
+		}
+	}
+	return grad
+}
@@ -0,0 +1,415 @@
+package floatimage
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestGrayValue(t *testing.T) {
+	tests := []struct {
+		name string
+		c    color.Color
+		want float32
+	}{
+		{"gray black", color.Gray{0}, 0},
+		{"gray", color.Gray{77}, 77},
+		{"gray white", color.Gray{255}, 255},
+		{"rgba white", color.RGBA{255, 255, 255, 255}, 255},
+		{"rgba gray", color.RGBA{128, 128, 128, 255}, 128},
+		// BT.601 weights 0.299, 0.587, 0.114
+		{"rgba red", color.RGBA{255, 0, 0, 255}, 76},
+		{"rgba green", color.RGBA{0, 255, 0, 255}, 150},
+		{"rgba blue", color.RGBA{0, 0, 255, 255}, 29},
+		{"ycbcr neutral", color.YCbCr{100, 128, 128}, 100},
+		{"ycbcr black", color.YCbCr{0, 128, 128}, 0},
+		{"ycbcr white", color.YCbCr{255, 128, 128}, 255},
+	}
+	for _, tc := range tests {
+		if got := GrayValue(tc.c); got != tc.want {
+			t.Errorf("%s: GrayValue(%v) = %f, want %f", tc.name, tc.c, got, tc.want)
+		}
+	}
+
+	// colored YCbCr values go through RGB, the luma is kept up to rounding
+	for _, c := range []color.YCbCr{{76, 85, 255}, {150, 44, 21}, {29, 255, 107}, {128, 100, 150}} {
+		got := GrayValue(c)
+		if d := got - float32(c.Y); d < -1 || d > 1 {
+			t.Errorf("GrayValue(%v) = %f, want %d ± 1", c, got, c.Y)
+		}
+	}
+}
+
+func TestGrayFloatFromImageUsesGrayValue(t *testing.T) {
+	img := image.NewRGBA(image.Rect(2, 3, 6, 5))
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {10, 200, 30, 255}}
+	for i, c := range colors {
+		img.SetRGBA(2+i, 3, c)
+		img.SetRGBA(2+i, 4, c)
+	}
+	f := GrayFloatFromImage(img)
+	fd := GrayFloatWithDummiesFromImage(img)
+	for i, c := range colors {
+		want := GrayValue(c)
+		if got := f.AtF(2+i, 3)[0]; got != want {
+			t.Errorf("GrayFloatFromImage at %d: %f, want %f", i, got, want)
+		}
+		if got := fd.AtF(2+i, 4)[0]; got != want {
+			t.Errorf("GrayFloatWithDummiesFromImage at %d: %f, want %f", i, got, want)
+		}
+	}
+}
+
+func TestRGBFloatFromImage(t *testing.T) {
+	bounds := image.Rect(-2, 3, 3, 5)
+	img := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(40 * (x + 2)), uint8(100 * (y - 3)), 255, 255})
+		}
+	}
+	// alpha is dropped, the premultiplied channels are kept
+	img.SetNRGBA(0, 4, color.NRGBA{200, 100, 50, 0})
+	img.SetNRGBA(1, 4, color.NRGBA{200, 100, 50, 128})
+
+	f := RGBFloatFromImage(img)
+	if f.Chancnt != 3 || f.Bounds() != bounds {
+		t.Fatalf("%d channels and bounds %v", f.Chancnt, f.Bounds())
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			want := [3]float32{float32(r >> 8), float32(g >> 8), float32(b >> 8)}
+			got := f.AtF(x, y)
+			for c := range want {
+				if math.Abs(float64(got[c]-want[c])) > 1 {
+					t.Errorf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+					break
+				}
+			}
+		}
+	}
+	if got := f.AtF(-1, 3); got[0] != 40 || got[1] != 0 || got[2] != 255 {
+		t.Errorf("opaque pixel is %v, want [40 0 255]", got)
+	}
+}
+
+func TestPercentileRange(t *testing.T) {
+	// channel 1 holds 1..1000 with a single huge outlier instead of 1000
+	img := NewFloatImg(image.Rect(0, 0, 40, 25), 2)
+	for i := 0; i < 1000; i++ {
+		img.Pix[2*i] = -1e6
+		img.Pix[2*i+1] = float32(i + 1)
+	}
+	img.Set(39, 24, 1, 1e9)
+
+	tests := []struct {
+		low, high         float32
+		wantLow, wantHigh float32
+	}{
+		{0, 100, 1, 1e9},
+		{1, 99, 10.99, 990.01},
+		{50, 50, 500.5, 500.5},
+		{10, 90, 100.9, 900.1},
+	}
+	for _, tc := range tests {
+		low, high := img.PercentileRange(1, tc.low, tc.high)
+		if d := low - tc.wantLow; d < -1e-3 || d > 1e-3 {
+			t.Errorf("%v%%: low %f, want %f", tc.low, low, tc.wantLow)
+		}
+		if d := (high - tc.wantHigh) / tc.wantHigh; d < -1e-5 || d > 1e-5 {
+			t.Errorf("%v%%: high %f, want %f", tc.high, high, tc.wantHigh)
+		}
+	}
+	if _, high := img.PercentileRange(1, 1, 99); high > 1000 {
+		t.Errorf("the 99th percentile %f doesn't ignore the outlier", high)
+	}
+}
+
+func TestGetFDoesNotAlias(t *testing.T) {
+	img := NewFloatImg(image.Rect(1, 1, 4, 3), 3)
+	for i := range img.Pix {
+		img.Pix[i] = float32(i)
+	}
+	out := make([]float32, 3)
+	img.GetF(2, 2, out)
+	want := img.AtF(2, 2)
+	for c := range out {
+		if out[c] != want[c] {
+			t.Fatalf("GetF = %v, want %v", out, want)
+		}
+	}
+	for c := range out {
+		out[c] = -1
+	}
+	for c, v := range img.AtF(2, 2) {
+		if v == -1 {
+			t.Errorf("channel %d changed with out", c)
+		}
+	}
+	// AtF in contrast aliases Pix
+	img.AtF(2, 2)[1] = 42
+	if got := img.Pix[img.PixOffset(2, 2)+1]; got != 42 {
+		t.Errorf("AtF doesn't alias Pix, got %f", got)
+	}
+}
+
+func TestReorigin(t *testing.T) {
+	full := NewFloatImg(image.Rect(0, 0, 8, 6), 2)
+	for i := range full.Pix {
+		full.Pix[i] = float32(i)
+	}
+	sub := full.SubImage(image.Rect(3, 2, 7, 5))
+	tests := []struct {
+		name   string
+		newMin image.Point
+	}{
+		{"zero", image.Point{}},
+		{"positive", image.Point{10, 20}},
+		{"negative", image.Point{-4, -1}},
+		{"same", image.Point{3, 2}},
+	}
+	for _, tt := range tests {
+		view := sub.Reorigin(tt.newMin)
+		if view.Bounds().Min != tt.newMin || view.Bounds().Size() != sub.Bounds().Size() {
+			t.Errorf("%s: bounds %v, want size %v at %v", tt.name, view.Bounds(), sub.Bounds().Size(), tt.newMin)
+			continue
+		}
+		// combine with a field of the same size starting at newMin
+		other := NewFloatImg(image.Rect(0, 0, 4, 3).Add(tt.newMin), 2)
+		for i := 0; i < len(other.Pix); i += 2 {
+			other.Pix[i], other.Pix[i+1] = 1, 2
+		}
+		diff, err := view.SubtractBackground(other)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 4; x++ {
+				want := full.AtF(x+3, y+2)
+				got := diff.AtF(x+tt.newMin.X, y+tt.newMin.Y)
+				if got[0] != want[0]-1 || got[1] != want[1]-2 {
+					t.Errorf("%s: diff at %d, %d = %v, want %v - (1, 2)", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	// the view shares Pix with the original
+	view := sub.Reorigin(image.Point{})
+	view.Set(0, 0, 0, -1)
+	if full.AtF(3, 2)[0] != -1 {
+		t.Error("Reorigin copied the data")
+	}
+	// combining without reorigining is rejected
+	if _, err := sub.SubtractBackground(NewFloatImg(image.Rect(0, 0, 4, 3), 2)); err == nil {
+		t.Error("no error for mismatched origins")
+	}
+}
+
+func TestGradient(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(x, y int) float32
+	}{
+		{"constant", func(x, y int) float32 { return 7 }},
+		{"linear", func(x, y int) float32 { return float32(3*x - 2*y) }},
+		{"quadratic", func(x, y int) float32 { return float32(x*x + x*y) }},
+	}
+	r := image.Rect(-2, 1, 6, 6)
+	for _, tt := range tests {
+		// channel 1 holds f, channel 0 something else
+		img := NewFloatImg(r, 2)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.Set(x, y, 0, float32(x*y))
+				img.Set(x, y, 1, tt.f(x, y))
+			}
+		}
+		grad := img.ChannelGradient(1)
+		if grad.Chancnt != 2 || grad.Bounds() != r {
+			t.Fatalf("%s: gradient with %d channels and bounds %v", tt.name, grad.Chancnt, grad.Bounds())
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				// separate central (one sided on the border) differences
+				x0, x1, y0, y1 := x-1, x+1, y-1, y+1
+				if x0 < r.Min.X {
+					x0 = x
+				}
+				if x1 == r.Max.X {
+					x1 = x
+				}
+				if y0 < r.Min.Y {
+					y0 = y
+				}
+				if y1 == r.Max.Y {
+					y1 = y
+				}
+				fx := (tt.f(x1, y) - tt.f(x0, y)) / float32(x1-x0)
+				fy := (tt.f(x, y1) - tt.f(x, y0)) / float32(y1-y0)
+				if g := grad.AtF(x, y); g[0] != fx || g[1] != fy {
+					t.Errorf("%s: gradient at %d, %d = %v, want (%f, %f)", tt.name, x, y, g, fx, fy)
+				}
+			}
+		}
+	}
+
+	// Gradient uses channel 0
+	img := NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, 0, float32(3*x-2*y))
+			img.Set(x, y, 1, float32(x*x))
+		}
+	}
+	grad := img.Gradient()
+	for i := 0; i < len(grad.Pix); i += 2 {
+		if grad.Pix[i] != 3 || grad.Pix[i+1] != -2 {
+			t.Fatalf("Gradient = (%f, %f), want (3, -2)", grad.Pix[i], grad.Pix[i+1])
+		}
+	}
+}
+
+func TestTu16c(t *testing.T) {
+	tests := []struct {
+		in   float32
+		want uint16
+	}{
+		{-5, 0},
+		{0, 0},
+		{255, 255},
+		{256, 256},
+		{1000.7, 1000},
+		{65535, 65535},
+		{70000, 65535},
+	}
+	for _, tt := range tests {
+		if got := Tu16c(tt.in); got != tt.want {
+			t.Errorf("Tu16c(%f) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToGray16(t *testing.T) {
+	// values above 255 saturate in 8 bit but stay distinct in 16 bit
+	values := []float32{100, 255, 256, 300, 1000, 40000}
+	img := NewFloatImg(image.Rect(3, 2, 3+len(values), 3), 1)
+	copy(img.Pix, values)
+	g := img.ToGray16()
+	if g.Bounds() != img.Bounds() {
+		t.Fatalf("bounds %v, want %v", g.Bounds(), img.Bounds())
+	}
+	seen := make(map[uint16]bool)
+	for i, v := range values {
+		got := g.Gray16At(3+i, 2).Y
+		if got != uint16(v) {
+			t.Errorf("%f converted to %d", v, got)
+		}
+		if seen[got] {
+			t.Errorf("%f isn't distinguishable in 16 bit", v)
+		}
+		seen[got] = true
+		if v > 255 && Tu8c(v) != 255 {
+			t.Errorf("%f doesn't saturate in 8 bit", v)
+		}
+	}
+}
+
+func TestScaleToUnsignedByteCoupled(t *testing.T) {
+	vectors := [][2]float32{{3, 4}, {6, 2}, {1, 1}, {0, 0}, {-2, 1}}
+	field := func() *FloatImg {
+		img := NewFloatImg(image.Rect(-1, 2, len(vectors)-1, 3), 2)
+		for i, vec := range vectors {
+			img.Set(i-1, 2, 0, vec[0])
+			img.Set(i-1, 2, 1, vec[1])
+		}
+		return img
+	}
+	// the largest vector (6, 2) gets the length 255
+	factor := 255 / math.Sqrt(40)
+	coupled, independent := field(), field()
+	coupled.ScaleToUnsignedByteCoupled()
+	independent.ScaleToUnsignedByte()
+
+	var changed bool
+	for i, vec := range vectors {
+		got := coupled.AtF(i-1, 2)
+		for c := range vec {
+			if want := float64(vec[c]) * factor; !nearEq(float64(got[c]), want, 1e-5) {
+				t.Errorf("coupled: vector %v scaled to %v, component %d want %f", vec, got, c, want)
+			}
+		}
+		// the independent scaling stretches u by 255/6 but v by 255/4
+		ind := independent.AtF(i-1, 2)
+		if vec[0] > 0 && vec[1] > 0 && !nearEq(float64(ind[0]*vec[1]), float64(ind[1]*vec[0]), 1e-5) {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Error("independent scaling preserved all directions")
+	}
+	if got := coupled.AtF(0, 2); !nearEq(math.Hypot(float64(got[0]), float64(got[1])), 255, 1e-5) {
+		t.Errorf("largest vector has length %f, want 255", math.Hypot(float64(got[0]), float64(got[1])))
+	}
+
+	zero := NewFloatImg(image.Rect(0, 0, 3, 2), 2)
+	zero.ScaleToUnsignedByteCoupled()
+	for i, v := range zero.Pix {
+		if v != 0 {
+			t.Fatalf("zero image: value %d is %f", i, v)
+		}
+	}
+}
+
+func TestApplyLUT(t *testing.T) {
+	values := []float32{-10, 0, 25.5, 127.5, 200, 255, 300}
+	tests := []struct {
+		name         string
+		lut          []float32
+		inMin, inMax float32
+		want         []float32
+	}{
+		{"invert", []float32{255, 0}, 0, 255, []float32{255, 255, 229.5, 127.5, 55, 0, 0}},
+		{"identity", []float32{0, 255}, 0, 255, []float32{0, 0, 25.5, 127.5, 200, 255, 255}},
+		// a curve through 0, 200 and 255, the midpoint maps to 200
+		{"curve", []float32{0, 200, 255}, 0, 255, []float32{0, 0, 40, 200, 231.27451, 255, 255}},
+		{"shifted range", []float32{0, 1}, 100, 300, []float32{0, 0, 0, 0.1375, 0.5, 0.775, 1}},
+		{"single entry", []float32{7}, 0, 255, []float32{7, 7, 7, 7, 7, 7, 7}},
+		{"empty range", []float32{3, 9}, 50, 50, []float32{3, 3, 3, 3, 3, 3, 3}},
+		{"empty", nil, 0, 255, values},
+	}
+	for _, tt := range tests {
+		img := NewFloatImg(image.Rect(2, -1, 2+len(values), 0), 2)
+		for i, v := range values {
+			img.Set(2+i, -1, 0, v)
+			img.Set(2+i, -1, 1, v)
+		}
+		img.ApplyLUT(0, tt.lut, tt.inMin, tt.inMax)
+		for i, want := range tt.want {
+			got := img.AtF(2+i, -1)
+			if !nearEq(float64(got[0]), float64(want), 1e-5) {
+				t.Errorf("%s: %f maps to %f, want %f", tt.name, values[i], got[0], want)
+			}
+			// the other channel is untouched
+			if got[1] != values[i] {
+				t.Errorf("%s: channel 1 changed from %f to %f", tt.name, values[i], got[1])
+			}
+		}
+	}
+
+	// inverting twice restores the values inside the range
+	img := NewFloatImg(image.Rect(0, 0, 4, 4), 1)
+	for i := range img.Pix {
+		img.Pix[i] = float32(17 * i)
+	}
+	img.ApplyLUT(0, []float32{255, 0}, 0, 255)
+	img.ApplyLUT(0, []float32{255, 0}, 0, 255)
+	for i, v := range img.Pix {
+		if !nearEq(float64(v), float64(17*i), 1e-5) {
+			t.Errorf("double inversion: value %d is %f, want %d", i, v, 17*i)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package floatimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// floatImgMagic starts the raw FloatImg format of WriteFloatImg
+var floatImgMagic = [4]byte{'F', 'I', 'M', 'G'}
+
+// WriteFloatImg writes the image losslessly in a raw little endian format,
+// the magic "FIMG" followed by Rect (min x, min y, max x, max y) and Chancnt
+// as int32 and then all channel values row by row as float32
+func WriteFloatImg(w io.Writer, img *FloatImg) error {
+	bounds := img.Bounds()
+	header := []interface{}{floatImgMagic,
+		int32(bounds.Min.X), int32(bounds.Min.Y), int32(bounds.Max.X), int32(bounds.Max.Y),
+		int32(img.Chancnt)}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("writing FloatImg header: %v", err)
+		}
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+			return fmt.Errorf("writing FloatImg row %d: %v", y-bounds.Min.Y, err)
+		}
+	}
+	return nil
+}
+
+// ReadFloatImg reads an image written by WriteFloatImg
+func ReadFloatImg(r io.Reader) (*FloatImg, error) {
+	var magic [4]byte
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != floatImgMagic {
+		return nil, errors.New("not a FloatImg file")
+	}
+	var header [5]int32
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	rect := image.Rect(int(header[0]), int(header[1]), int(header[2]), int(header[3]))
+	chancnt := int(header[4])
+	if rect.Dx() != int(header[2]-header[0]) || rect.Dy() != int(header[3]-header[1]) || chancnt < 0 {
+		return nil, fmt.Errorf("invalid FloatImg header %v", header)
+	}
+	img := NewFloatImg(rect, chancnt)
+	if err := binary.Read(r, binary.LittleEndian, img.Pix); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,75 @@
+package floatimage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+)
+
+// errWriteFailed is returned by limitWriter once its limit is used up
+var errWriteFailed = errors.New("write failed")
+
+// limitWriter accepts n bytes and then fails with errWriteFailed, writing the
+// part of the last buffer that still fits
+type limitWriter struct {
+	n int
+}
+
+func (p *limitWriter) Write(b []byte) (int, error) {
+	if len(b) <= p.n {
+		p.n -= len(b)
+		return len(b), nil
+	}
+	written := p.n
+	p.n = 0
+	return written, errWriteFailed
+}
+
+func TestWriteFloatImg(t *testing.T) {
+	img := randomImg(5, 3, 2, 8).Reorigin(image.Point{-2, 7})
+	var buf bytes.Buffer
+	if err := WriteFloatImg(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	// 24 header bytes followed by 3 rows of 5 pixels with 2 channels
+	if size := buf.Len(); size != 24+3*5*2*4 {
+		t.Errorf("%d bytes written", size)
+	}
+	read, err := ReadFloatImg(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Bounds() != img.Bounds() || read.Chancnt != img.Chancnt {
+		t.Fatalf("read bounds %v with %d channels, want %v with %d", read.Bounds(), read.Chancnt, img.Bounds(), img.Chancnt)
+	}
+	for i, v := range img.Pix {
+		if read.Pix[i] != v {
+			t.Fatalf("value %d is %f, want %f", i, read.Pix[i], v)
+		}
+	}
+
+	tests := []struct {
+		limit int
+		stage string
+	}{
+		{0, "header"},
+		{23, "header"},
+		{24, "row 0"},
+		{24 + 40, "row 1"},
+		{24 + 119, "row 2"},
+		{24 + 120, ""},
+	}
+	for _, tt := range tests {
+		err := WriteFloatImg(&limitWriter{tt.limit}, img)
+		switch {
+		case tt.stage == "" && err != nil:
+			t.Errorf("limit %d: %v", tt.limit, err)
+		case tt.stage != "" && err == nil:
+			t.Errorf("limit %d: no error", tt.limit)
+		case err != nil && (!strings.Contains(err.Error(), tt.stage) || !strings.Contains(err.Error(), errWriteFailed.Error())):
+			t.Errorf("limit %d: error %q doesn't mention %q and the cause", tt.limit, err, tt.stage)
+		}
+	}
+}
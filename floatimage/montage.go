@@ -0,0 +1,51 @@
+package floatimage
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Montage arranges the images row by row in a grid with cols columns,
+// separated by gap pixels filled with gapValue. All images need the same
+// size and channel count. The result starts at (0, 0)
+func Montage(imgs []*FloatImg, cols int, gap int, gapValue float32) (*FloatImg, error) {
+	if len(imgs) == 0 {
+		return nil, errors.New("montage needs at least one image")
+	}
+	if cols < 1 {
+		return nil, fmt.Errorf("invalid column count %d", cols)
+	}
+	w, h := imgs[0].Bounds().Dx(), imgs[0].Bounds().Dy()
+	chancnt := imgs[0].Chancnt
+	for i, img := range imgs {
+		if img.Bounds().Dx() != w || img.Bounds().Dy() != h {
+			return nil, fmt.Errorf("image %d is %dx%d, expected %dx%d", i, img.Bounds().Dx(), img.Bounds().Dy(), w, h)
+		}
+		if img.Chancnt != chancnt {
+			return nil, fmt.Errorf("image %d has %d channels, expected %d", i, img.Chancnt, chancnt)
+		}
+	}
+
+	rows := (len(imgs) + cols - 1) / cols
+	if len(imgs) < cols {
+		cols = len(imgs)
+	}
+	m := NewFloatImg(image.Rect(0, 0, cols*w+(cols-1)*gap, rows*h+(rows-1)*gap), chancnt)
+	m.ColorFunc = imgs[0].ColorFunc
+	m.ColorModelFunc = imgs[0].ColorModelFunc
+	for i := range m.Pix {
+		m.Pix[i] = gapValue
+	}
+
+	for i, img := range imgs {
+		ox, oy := (i%cols)*(w+gap), (i/cols)*(h+gap)
+		bounds := img.Bounds()
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				copy(m.AtF(ox+x, oy+y), img.AtF(bounds.Min.X+x, bounds.Min.Y+y))
+			}
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,94 @@
+package floatimage
+
+import (
+	"image"
+	"testing"
+)
+
+// filledImg returns a w x h image starting at min with all channels set to v
+func filledImg(min image.Point, w, h, chancnt int, v float32) *FloatImg {
+	img := NewFloatImg(image.Rect(0, 0, w, h).Add(min), chancnt)
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func TestMontage(t *testing.T) {
+	// four 10x10 images filled with 1, 2, 3, 4 in a 2x2 grid with a gap of 2
+	imgs := []*FloatImg{
+		filledImg(image.Point{}, 10, 10, 1, 1),
+		filledImg(image.Point{5, 5}, 10, 10, 1, 2),
+		filledImg(image.Point{-3, 0}, 10, 10, 1, 3),
+		filledImg(image.Point{}, 10, 10, 1, 4),
+	}
+	m, err := Montage(imgs, 2, 2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 22, 22) {
+		t.Fatalf("montage bounds %v, want 22x22", m.Bounds())
+	}
+	tests := []struct {
+		x, y int
+		want float32
+	}{
+		{0, 0, 1}, {9, 9, 1},
+		{12, 0, 2}, {21, 9, 2},
+		{0, 12, 3}, {9, 21, 3},
+		{12, 12, 4}, {21, 21, 4},
+		// the gaps
+		{10, 0, -1}, {11, 15, -1}, {0, 10, -1}, {15, 11, -1}, {10, 10, -1},
+	}
+	for _, tt := range tests {
+		if got := m.AtF(tt.x, tt.y)[0]; got != tt.want {
+			t.Errorf("at %d, %d: %f, want %f", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestMontageLayout(t *testing.T) {
+	tests := []struct {
+		n, cols, gap int
+		w, h         int
+	}{
+		{3, 2, 1, 2*4 + 1, 2*3 + 1},
+		{3, 5, 0, 3 * 4, 3},
+		{1, 1, 3, 4, 3},
+		{6, 3, 2, 3*4 + 4, 2*3 + 2},
+	}
+	for _, tt := range tests {
+		imgs := make([]*FloatImg, tt.n)
+		for i := range imgs {
+			imgs[i] = filledImg(image.Point{}, 4, 3, 3, float32(i))
+		}
+		m, err := Montage(imgs, tt.cols, tt.gap, 0)
+		if err != nil {
+			t.Errorf("%d images in %d columns: %v", tt.n, tt.cols, err)
+			continue
+		}
+		if m.Bounds().Dx() != tt.w || m.Bounds().Dy() != tt.h || m.Chancnt != 3 {
+			t.Errorf("%d images in %d columns: %v with %d channels, want %dx%d",
+				tt.n, tt.cols, m.Bounds(), m.Chancnt, tt.w, tt.h)
+		}
+	}
+}
+
+func TestMontageInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		imgs []*FloatImg
+		cols int
+	}{
+		{"no images", nil, 2},
+		{"no columns", []*FloatImg{filledImg(image.Point{}, 4, 4, 1, 0)}, 0},
+		{"differing width", []*FloatImg{filledImg(image.Point{}, 4, 4, 1, 0), filledImg(image.Point{}, 5, 4, 1, 0)}, 2},
+		{"differing height", []*FloatImg{filledImg(image.Point{}, 4, 4, 1, 0), filledImg(image.Point{}, 4, 3, 1, 0)}, 2},
+		{"differing channels", []*FloatImg{filledImg(image.Point{}, 4, 4, 1, 0), filledImg(image.Point{}, 4, 4, 3, 0)}, 2},
+	}
+	for _, tt := range tests {
+		if _, err := Montage(tt.imgs, tt.cols, 1, 0); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package floatimage
+
+// rankFilter returns a new image holding for every channel the extreme value
+// according to better over the window [x-radius, x+radius] x
+// [y-radius, y+radius] clipped to the image. As the square window is
+// separable the rows are filtered first and then the columns
+func (p *FloatImg) rankFilter(radius int, better func(v, cur float32) bool) *FloatImg {
+	bounds := p.Bounds()
+	tmp := NewFloatImg(bounds, p.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			lo, hi := clampWindow(x-bounds.Min.X, radius, bounds.Dx())
+			out := tmp.AtF(x, y)
+			copy(out, p.AtF(x, y))
+			for sx := bounds.Min.X + lo; sx < bounds.Min.X+hi; sx++ {
+				for c, v := range p.AtF(sx, y) {
+					if better(v, out[c]) {
+						out[c] = v
+					}
+				}
+			}
+		}
+	}
+	result := NewFloatImg(bounds, p.Chancnt)
+	result.Boundary = p.Boundary
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		lo, hi := clampWindow(y-bounds.Min.Y, radius, bounds.Dy())
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out := result.AtF(x, y)
+			copy(out, tmp.AtF(x, y))
+			for sy := bounds.Min.Y + lo; sy < bounds.Min.Y+hi; sy++ {
+				for c, v := range tmp.AtF(x, sy) {
+					if better(v, out[c]) {
+						out[c] = v
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Erode returns a new image holding the minimum of each channel over the
+// (2*radius+1)² square around each pixel, clipped to the image. On 0/1 masks
+// it shrinks the regions of ones and removes specks smaller than the window
+func (p *FloatImg) Erode(radius int) *FloatImg {
+	return p.rankFilter(radius, func(v, cur float32) bool { return v < cur })
+}
+
+// Dilate returns a new image holding the maximum of each channel over the
+// (2*radius+1)² square around each pixel, clipped to the image. On 0/1 masks
+// it grows the regions of ones and fills holes smaller than the window
+func (p *FloatImg) Dilate(radius int) *FloatImg {
+	return p.rankFilter(radius, func(v, cur float32) bool { return v > cur })
+}
+
+// Open returns the morphological opening, Erode followed by Dilate with the
+// same radius. On 0/1 masks it removes specks smaller than the window while
+// keeping larger regions
+func (p *FloatImg) Open(radius int) *FloatImg {
+	return p.Erode(radius).Dilate(radius)
+}
+
+// Close returns the morphological closing, Dilate followed by Erode with the
+// same radius. On 0/1 masks it fills holes and gaps smaller than the window
+func (p *FloatImg) Close(radius int) *FloatImg {
+	return p.Dilate(radius).Erode(radius)
+}
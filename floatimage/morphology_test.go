@@ -0,0 +1,63 @@
+package floatimage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestOpenClose(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+	solid := image.Rect(4, 4, 16, 16)
+	speck := image.Rect(1, 1, 3, 3)
+	hole := image.Rect(9, 9, 11, 11)
+
+	tests := []struct {
+		name   string
+		ones   []image.Rectangle
+		zeros  []image.Rectangle
+		op     func(img *FloatImg) *FloatImg
+		wantOn func(p image.Point) bool
+	}{
+		{"open removes speck", []image.Rectangle{solid, speck}, nil,
+			func(img *FloatImg) *FloatImg { return img.Open(1) },
+			func(p image.Point) bool { return p.In(solid) }},
+		{"close fills hole", []image.Rectangle{solid}, []image.Rectangle{hole},
+			func(img *FloatImg) *FloatImg { return img.Close(1) },
+			func(p image.Point) bool { return p.In(solid) }},
+		{"open keeps hole", []image.Rectangle{solid}, []image.Rectangle{hole},
+			func(img *FloatImg) *FloatImg { return img.Open(1) },
+			func(p image.Point) bool { return p.In(solid) && !p.In(hole) }},
+	}
+	for _, tc := range tests {
+		mask := filledImg(bounds.Min, bounds.Dx(), bounds.Dy(), 1, 0)
+		for _, r := range tc.ones {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					mask.Set(x, y, 0, 1)
+				}
+			}
+		}
+		for _, r := range tc.zeros {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					mask.Set(x, y, 0, 0)
+				}
+			}
+		}
+		got := tc.op(mask)
+		if !got.Bounds().Eq(bounds) || got.Chancnt != 1 {
+			t.Fatalf("%s: result has bounds %v and %d channels", tc.name, got.Bounds(), got.Chancnt)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := float32(0)
+				if tc.wantOn(image.Point{x, y}) {
+					want = 1
+				}
+				if v := got.AtF(x, y)[0]; v != want {
+					t.Errorf("%s: pixel (%d, %d) = %f, want %f", tc.name, x, y, v, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package floatimage
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// chunksPerProc is the number of row chunks AutoRowChunk aims for per
+// processor, a few chunks per processor balance uneven row costs
+const chunksPerProc = 4
+
+// minChunkPixels is the least number of pixels a chunk should cover to be
+// worth the goroutine overhead
+const minChunkPixels = 4096
+
+// AutoRowChunk computes the number of rows processed per goroutine for an
+// image covering bounds. It aims for a small multiple of GOMAXPROCS chunks,
+// makes chunks of narrow images taller so they are worth a goroutine, but
+// never yields fewer chunks than processors when there are enough rows
+func AutoRowChunk(bounds image.Rectangle) int {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= 0 || h <= 0 {
+		return 1
+	}
+	procs := runtime.GOMAXPROCS(0)
+	rows := (h + chunksPerProc*procs - 1) / (chunksPerProc * procs)
+	if minRows := (minChunkPixels + w - 1) / w; rows < minRows {
+		rows = minRows
+	}
+	// rounding down keeps at least procs chunks
+	if maxRows := h / procs; rows > maxRows {
+		rows = maxRows
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return rows
+}
+
+// ParallelRows splits the rows of bounds into chunks of rowsPerGo rows and
+// calls fn for each chunk in its own goroutine, it returns when all calls
+// have finished. A rowsPerGo of 0 uses AutoRowChunk
+func ParallelRows(bounds image.Rectangle, rowsPerGo int, fn func(minY, maxY int)) {
+	if rowsPerGo <= 0 {
+		rowsPerGo = AutoRowChunk(bounds)
+	}
+	var wg sync.WaitGroup
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += rowsPerGo {
+		maxY := y + rowsPerGo
+		if maxY > bounds.Max.Y {
+			maxY = bounds.Max.Y
+		}
+		wg.Add(1)
+		go func(minY, maxY int) {
+			defer wg.Done()
+			fn(minY, maxY)
+		}(y, maxY)
+	}
+	wg.Wait()
+}
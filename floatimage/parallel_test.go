@@ -0,0 +1,77 @@
+package floatimage
+
+import (
+	"image"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestAutoRowChunk(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	// with 4 processors the aim is 16 chunks of at least 4096 pixels but
+	// never fewer than 4 chunks
+	tests := []struct {
+		w, h, rows int
+	}{
+		{1000, 1000, 63},
+		{1000, 2000, 125},
+		{2000, 2000, 125},
+		{100, 1000, 63},
+		{10, 1000, 250},
+		{1000, 8, 2},
+		{1000, 3, 1},
+		{1, 1, 1},
+		{0, 10, 1},
+		{10, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := AutoRowChunk(image.Rect(0, 0, tt.w, tt.h)); got != tt.rows {
+			t.Errorf("%dx%d: %d rows, want %d", tt.w, tt.h, got, tt.rows)
+		}
+	}
+
+	for _, procs := range []int{1, 2, 3, 8} {
+		runtime.GOMAXPROCS(procs)
+		for _, w := range []int{1, 7, 64, 640, 5000} {
+			for _, h := range []int{1, 2, 5, 17, 100, 480, 3000} {
+				rows := AutoRowChunk(image.Rect(0, 0, w, h))
+				chunks := (h + rows - 1) / rows
+				if rows < 1 || (h >= procs && chunks < procs) {
+					t.Errorf("%d procs %dx%d: %d rows in %d chunks", procs, w, h, rows, chunks)
+				}
+			}
+		}
+	}
+}
+
+func TestParallelRows(t *testing.T) {
+	tests := []struct {
+		bounds    image.Rectangle
+		rowsPerGo int
+	}{
+		{image.Rect(0, 0, 10, 10), 3},
+		{image.Rect(0, -5, 10, 7), 1},
+		{image.Rect(0, 0, 10, 10), 100},
+		{image.Rect(0, 0, 300, 50), 0},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		seen := make(map[int]int)
+		ParallelRows(tt.bounds, tt.rowsPerGo, func(minY, maxY int) {
+			mu.Lock()
+			defer mu.Unlock()
+			for y := minY; y < maxY; y++ {
+				seen[y]++
+			}
+		})
+		for y := tt.bounds.Min.Y; y < tt.bounds.Max.Y; y++ {
+			if seen[y] != 1 {
+				t.Errorf("%v by %d: row %d visited %d times", tt.bounds, tt.rowsPerGo, y, seen[y])
+			}
+		}
+		if len(seen) != tt.bounds.Dy() {
+			t.Errorf("%v by %d: visited %d rows", tt.bounds, tt.rowsPerGo, len(seen))
+		}
+	}
+}
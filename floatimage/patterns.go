@@ -0,0 +1,51 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+)
+
+// Checkerboard returns a w x h single channel image starting at (0, 0) with
+// alternating squares of squareSize pixels, 255 for the top left one and 0
+// for its neighbors
+func Checkerboard(w, h, squareSize int) *FloatImg {
+	if squareSize < 1 {
+		squareSize = 1
+	}
+	img := NewFloatImg(image.Rect(0, 0, w, h), 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x/squareSize+y/squareSize)%2 == 0 {
+				img.Set(x, y, 0, 255)
+			}
+		}
+	}
+	return img
+}
+
+// Gradient returns a w x h single channel image starting at (0, 0) with the
+// linear ramp dx*x + dy*y, i.e. the constant slopes dx and dy
+func Gradient(w, h int, dx, dy float32) *FloatImg {
+	img := NewFloatImg(image.Rect(0, 0, w, h), 1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, 0, dx*float32(x)+dy*float32(y))
+		}
+	}
+	return img
+}
+
+// Sinusoid returns a w x h single channel image starting at (0, 0) with a
+// plane wave 127.5 + 127.5*sin(2π*freq*(x*cos(angle) + y*sin(angle))) of freq
+// cycles per pixel travelling in direction angle (radians, y pointing down)
+func Sinusoid(w, h int, freq, angle float32) *FloatImg {
+	img := NewFloatImg(image.Rect(0, 0, w, h), 1)
+	sin, cos := math.Sincos(float64(angle))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			phase := 2 * math.Pi * float64(freq) * (float64(x)*cos + float64(y)*sin)
+			img.Set(x, y, 0, float32(127.5+127.5*math.Sin(phase)))
+		}
+	}
+	return img
+}
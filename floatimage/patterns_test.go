@@ -0,0 +1,123 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestCheckerboard(t *testing.T) {
+	tests := []struct {
+		w, h, size, wantSize int
+	}{
+		{8, 8, 2, 2},
+		{10, 7, 3, 3},
+		{5, 4, 1, 1},
+		{6, 6, 0, 1},
+		{4, 4, 8, 8},
+	}
+	for _, tt := range tests {
+		img := Checkerboard(tt.w, tt.h, tt.size)
+		if img.Chancnt != 1 || img.Bounds() != image.Rect(0, 0, tt.w, tt.h) {
+			t.Fatalf("%dx%d by %d: %d channels and bounds %v", tt.w, tt.h, tt.size, img.Chancnt, img.Bounds())
+		}
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < tt.w; x++ {
+				want := float32(0)
+				if (x/tt.wantSize+y/tt.wantSize)%2 == 0 {
+					want = 255
+				}
+				if got := img.AtF(x, y)[0]; got != want {
+					t.Errorf("%dx%d by %d: pixel (%d, %d) = %f, want %f", tt.w, tt.h, tt.size, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestGradientPattern(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		dx, dy float32
+	}{
+		{10, 6, 1, 0},
+		{7, 9, 0, -2.5},
+		{12, 12, 0.25, 3},
+		{3, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		img := Gradient(tt.w, tt.h, tt.dx, tt.dy)
+		if img.Chancnt != 1 || img.Bounds() != image.Rect(0, 0, tt.w, tt.h) {
+			t.Fatalf("slope (%f, %f): %d channels and bounds %v", tt.dx, tt.dy, img.Chancnt, img.Bounds())
+		}
+		if v := img.AtF(0, 0)[0]; v != 0 {
+			t.Errorf("slope (%f, %f): origin %f, want 0", tt.dx, tt.dy, v)
+		}
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < tt.w; x++ {
+				v := img.AtF(x, y)[0]
+				if x+1 < tt.w {
+					if d := img.AtF(x+1, y)[0] - v; math.Abs(float64(d-tt.dx)) > 1e-4 {
+						t.Errorf("slope (%f, %f): x step at (%d, %d) is %f", tt.dx, tt.dy, x, y, d)
+					}
+				}
+				if y+1 < tt.h {
+					if d := img.AtF(x, y+1)[0] - v; math.Abs(float64(d-tt.dy)) > 1e-4 {
+						t.Errorf("slope (%f, %f): y step at (%d, %d) is %f", tt.dx, tt.dy, x, y, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSinusoid(t *testing.T) {
+	tests := []struct {
+		name        string
+		freq, angle float32
+		// a step along which the pattern repeats and one across the wave
+		period, along image.Point
+	}{
+		{"horizontal", 0.125, 0, image.Point{8, 0}, image.Point{0, 1}},
+		{"vertical", 0.25, math.Pi / 2, image.Point{0, 4}, image.Point{1, 0}},
+		{"diagonal", 0.125 * math.Sqrt2, math.Pi / 4, image.Point{4, 4}, image.Point{1, -1}},
+	}
+	for _, tt := range tests {
+		img := Sinusoid(32, 32, tt.freq, tt.angle)
+		if img.Chancnt != 1 || img.Bounds() != image.Rect(0, 0, 32, 32) {
+			t.Fatalf("%s: %d channels and bounds %v", tt.name, img.Chancnt, img.Bounds())
+		}
+		var sum float64
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				v := img.AtF(x, y)[0]
+				if v < 0 || v > 255 {
+					t.Errorf("%s: pixel (%d, %d) = %f out of range", tt.name, x, y, v)
+				}
+				sum += float64(v)
+				for _, step := range []image.Point{tt.period, tt.along} {
+					q := image.Point{x, y}.Add(step)
+					if !q.In(img.Bounds()) {
+						continue
+					}
+					if w := img.AtF(q.X, q.Y)[0]; math.Abs(float64(w-v)) > 0.01 {
+						t.Errorf("%s: pixel %v = %f differs from (%d, %d) = %f", tt.name, q, w, x, y, v)
+					}
+				}
+			}
+		}
+		// whole periods average to the mid gray
+		if mean := sum / (32 * 32); math.Abs(mean-127.5) > 0.01 {
+			t.Errorf("%s: mean %f, want 127.5", tt.name, mean)
+		}
+	}
+
+	// the origin starts at mid gray and rises along the wave
+	img := Sinusoid(8, 1, 0.125, 0)
+	if v := img.AtF(0, 0)[0]; v != 127.5 {
+		t.Errorf("origin %f, want 127.5", v)
+	}
+	if v := img.AtF(2, 0)[0]; v != 255 {
+		t.Errorf("quarter period %f, want 255", v)
+	}
+}
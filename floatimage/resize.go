@@ -0,0 +1,95 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+)
+
+// lanczos is the Lanczos kernel with a lobes
+func lanczos(x float64, a int) float64 {
+	if x == 0 {
+		return 1
+	}
+	if x <= -float64(a) || x >= float64(a) {
+		return 0
+	}
+	px := math.Pi * x
+	return float64(a) * math.Sin(px) * math.Sin(px/float64(a)) / (px * px)
+}
+
+// lanczosTaps returns for each of the dst output positions the first source
+// index and the normalized weights of the Lanczos-a kernel resampling n
+// source samples. Pixel centers are aligned and for downscaling the kernel is
+// stretched to avoid aliasing. Taps outside of the source are dropped and the
+// remaining weights renormalized
+func lanczosTaps(n, dst, a int) (first []int, weights [][]float32) {
+	scale := float64(n) / float64(dst)
+	support := math.Max(scale, 1)
+	first = make([]int, dst)
+	weights = make([][]float32, dst)
+	for i := range first {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - float64(a)*support))
+		hi := int(math.Floor(center + float64(a)*support))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > n-1 {
+			hi = n - 1
+		}
+		w := make([]float64, hi-lo+1)
+		var sum float64
+		for k := range w {
+			w[k] = lanczos((float64(lo+k)-center)/support, a)
+			sum += w[k]
+		}
+		first[i] = lo
+		weights[i] = make([]float32, len(w))
+		for k := range w {
+			if sum != 0 {
+				weights[i][k] = float32(w[k] / sum)
+			}
+		}
+	}
+	return
+}
+
+// ResizeLanczos returns the image resampled to newW x newH pixels with a
+// separable Lanczos kernel with a lobes, usually 2 or 3. The result starts at
+// the same Rect.Min, resizing to the same size reproduces the image
+func (p *FloatImg) ResizeLanczos(newW, newH int, a int) *FloatImg {
+	bounds := p.Bounds()
+	if a < 1 {
+		a = 1
+	}
+	firstX, weightsX := lanczosTaps(bounds.Dx(), newW, a)
+	firstY, weightsY := lanczosTaps(bounds.Dy(), newH, a)
+
+	// resample the rows first
+	tmp := NewFloatImg(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+newW, bounds.Max.Y), p.Chancnt)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := 0; x < newW; x++ {
+			out := tmp.AtF(bounds.Min.X+x, y)
+			for k, w := range weightsX[x] {
+				in := p.AtF(bounds.Min.X+firstX[x]+k, y)
+				for c := range out {
+					out[c] += w * in[c]
+				}
+			}
+		}
+	}
+
+	resized := NewFloatImg(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+newW, bounds.Min.Y+newH), p.Chancnt)
+	for y := 0; y < newH; y++ {
+		for x := bounds.Min.X; x < bounds.Min.X+newW; x++ {
+			out := resized.AtF(x, bounds.Min.Y+y)
+			for k, w := range weightsY[y] {
+				in := tmp.AtF(x, bounds.Min.Y+firstY[y]+k)
+				for c := range out {
+					out[c] += w * in[c]
+				}
+			}
+		}
+	}
+	return resized
+}
@@ -0,0 +1,82 @@
+package floatimage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestResizeLanczosIdentity(t *testing.T) {
+	img := randomImg(13, 9, 2, 4).Reorigin(image.Point{-3, 5})
+	for _, a := range []int{1, 2, 3} {
+		resized := img.ResizeLanczos(13, 9, a)
+		if resized.Bounds() != img.Bounds() || resized.Chancnt != 2 {
+			t.Fatalf("a = %d: bounds %v with %d channels", a, resized.Bounds(), resized.Chancnt)
+		}
+		for i, v := range resized.Pix {
+			if !nearEq(float64(v), float64(img.Pix[i]), 1e-5) {
+				t.Fatalf("a = %d: value %d is %f, want %f", a, i, v, img.Pix[i])
+			}
+		}
+	}
+}
+
+func TestResizeLanczosConstant(t *testing.T) {
+	// the weights are renormalized where the kernel leaves the image, so a
+	// constant image stays constant up to the border
+	img := filledImg(image.Pt(2, -1), 10, 8, 1, 42)
+	tests := []struct {
+		w, h, a int
+	}{
+		{20, 16, 2},
+		{37, 5, 3},
+		{5, 4, 2},
+		{3, 3, 3},
+		{1, 1, 2},
+	}
+	for _, tt := range tests {
+		resized := img.ResizeLanczos(tt.w, tt.h, tt.a)
+		if want := image.Rect(2, -1, 2+tt.w, -1+tt.h); resized.Bounds() != want {
+			t.Errorf("%dx%d a = %d: bounds %v, want %v", tt.w, tt.h, tt.a, resized.Bounds(), want)
+			continue
+		}
+		for i, v := range resized.Pix {
+			if !nearEq(float64(v), 42, 1e-5) {
+				t.Errorf("%dx%d a = %d: value %d is %f, want 42", tt.w, tt.h, tt.a, i, v)
+				break
+			}
+		}
+	}
+}
+
+func TestResizeLanczosEdge(t *testing.T) {
+	// a step from 0 to 255 upsampled 4 times, the width of the 10% to 90%
+	// rise measures the sharpness
+	img := NewFloatImg(image.Rect(0, 0, 16, 4), 1)
+	for y := 0; y < 4; y++ {
+		for x := 8; x < 16; x++ {
+			img.Set(x, y, 0, 255)
+		}
+	}
+	riseWidth := func(value func(x int) float32) int {
+		n := 0
+		for x := 0; x < 64; x++ {
+			if v := value(x); v > 25.5 && v < 229.5 {
+				n++
+			}
+		}
+		return n
+	}
+	// bilinear sampling at the same pixel centers
+	out := make([]float32, 1)
+	bilinear := riseWidth(func(x int) float32 {
+		img.AtBilinear((float32(x)+0.5)/4-0.5, 1, out)
+		return out[0]
+	})
+	for _, a := range []int{2, 3} {
+		resized := img.ResizeLanczos(64, 4, a)
+		lanczos := riseWidth(func(x int) float32 { return resized.AtF(x, 1)[0] })
+		if lanczos >= bilinear {
+			t.Errorf("a = %d: edge rises over %d pixels, bilinear over %d", a, lanczos, bilinear)
+		}
+	}
+}
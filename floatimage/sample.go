@@ -0,0 +1,24 @@
+package floatimage
+
+// FlowSample is a single flow vector U, V at the pixel X, Y
+type FlowSample struct {
+	X, Y int
+	U, V float32
+}
+
+// SampleGrid returns every step-th vector of the 2 channel flow field in both
+// directions starting at Rect.Min, row by row. A step < 1 is treated as 1
+func (p *FloatImg) SampleGrid(step int) []FlowSample {
+	if step < 1 {
+		step = 1
+	}
+	bounds := p.Bounds()
+	samples := make([]FlowSample, 0, ((bounds.Dx()+step-1)/step)*((bounds.Dy()+step-1)/step))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			vec := p.AtF(x, y)
+			samples = append(samples, FlowSample{x, y, vec[0], vec[1]})
+		}
+	}
+	return samples
+}
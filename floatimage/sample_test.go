@@ -0,0 +1,45 @@
+package floatimage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSampleGrid(t *testing.T) {
+	r := image.Rect(-1, 2, 9, 7)
+	flow := NewFloatImg(r, 2)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			flow.Set(x, y, 0, float32(x)/2)
+			flow.Set(x, y, 1, float32(y)*3)
+		}
+	}
+	tests := []struct {
+		step   int
+		xs, ys []int
+	}{
+		{1, []int{-1, 0, 1, 2, 3, 4, 5, 6, 7, 8}, []int{2, 3, 4, 5, 6}},
+		{2, []int{-1, 1, 3, 5, 7}, []int{2, 4, 6}},
+		{3, []int{-1, 2, 5, 8}, []int{2, 5}},
+		{10, []int{-1}, []int{2}},
+		{20, []int{-1}, []int{2}},
+		{0, []int{-1, 0, 1, 2, 3, 4, 5, 6, 7, 8}, []int{2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		samples := flow.SampleGrid(tt.step)
+		if len(samples) != len(tt.xs)*len(tt.ys) {
+			t.Errorf("step %d: %d samples, want %d", tt.step, len(samples), len(tt.xs)*len(tt.ys))
+			continue
+		}
+		i := 0
+		for _, y := range tt.ys {
+			for _, x := range tt.xs {
+				want := FlowSample{x, y, float32(x) / 2, float32(y) * 3}
+				if samples[i] != want {
+					t.Errorf("step %d: sample %d = %+v, want %+v", tt.step, i, samples[i], want)
+				}
+				i++
+			}
+		}
+	}
+}
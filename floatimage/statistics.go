@@ -0,0 +1,140 @@
+package floatimage
+
+import (
+	"math"
+	"sync"
+)
+
+// forwardDiffs calls fn with the forward differences dx, dy of channel at
+// every pixel of the interior (excluding the dummy borders), differences
+// that would reach into the dummy border are 0
+func (p *FloatImg) forwardDiffs(channel int, fn func(dx, dy float32)) {
+	bounds := p.Bounds()
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			v := p.AtF(x, y)[channel]
+			var dx, dy float32
+			if x+1 < bounds.Max.X-1 {
+				dx = p.AtF(x+1, y)[channel] - v
+			}
+			if y+1 < bounds.Max.Y-1 {
+				dy = p.AtF(x, y+1)[channel] - v
+			}
+			fn(dx, dy)
+		}
+	}
+}
+
+// TotalVariation computes the isotropic total variation of channel, that is
+// the sum of the gradient magnitudes sqrt(dx² + dy²) over the interior
+func (p *FloatImg) TotalVariation(channel int) float32 {
+	var tv float64
+	p.forwardDiffs(channel, func(dx, dy float32) {
+		tv += math.Sqrt(float64(dx*dx + dy*dy))
+	})
+	return float32(tv)
+}
+
+// TotalVariationL1 computes the anisotropic total variation of channel, that
+// is the sum of |dx| + |dy| over the interior
+func (p *FloatImg) TotalVariationL1(channel int) float32 {
+	var tv float64
+	p.forwardDiffs(channel, func(dx, dy float32) {
+		tv += math.Abs(float64(dx)) + math.Abs(float64(dy))
+	})
+	return float32(tv)
+}
+
+// reduceInterior accumulates n float64 values over the interior (excluding the
+// dummy borders) in parallel row chunks, fn adds the contribution of the
+// channels of a single pixel to acc
+func (p *FloatImg) reduceInterior(n int, fn func(chans []float32, acc []float64)) []float64 {
+	total := make([]float64, n)
+	var mu sync.Mutex
+	ParallelRows(p.Bounds().Inset(1), 0, func(minY, maxY int) {
+		acc := make([]float64, n)
+		for y := minY; y < maxY; y++ {
+			for x := p.Rect.Min.X + 1; x < p.Rect.Max.X-1; x++ {
+				fn(p.AtF(x, y), acc)
+			}
+		}
+		mu.Lock()
+		for i, v := range acc {
+			total[i] += v
+		}
+		mu.Unlock()
+	})
+	return total
+}
+
+// interiorSize is the number of pixels without the dummy borders
+func (p *FloatImg) interiorSize() int {
+	interior := p.Bounds().Inset(1)
+	return interior.Dx() * interior.Dy()
+}
+
+// Sum computes the sum of each channel over the interior
+func (p *FloatImg) Sum() []float32 {
+	total := p.reduceInterior(p.Chancnt, func(chans []float32, acc []float64) {
+		for c, v := range chans {
+			acc[c] += float64(v)
+		}
+	})
+	sum := make([]float32, p.Chancnt)
+	for c, v := range total {
+		sum[c] = float32(v)
+	}
+	return sum
+}
+
+// L2Norm computes the Euclidean norm over all channels of the interior
+func (p *FloatImg) L2Norm() float32 {
+	total := p.reduceInterior(1, func(chans []float32, acc []float64) {
+		for _, v := range chans {
+			acc[0] += float64(v) * float64(v)
+		}
+	})
+	return float32(math.Sqrt(total[0]))
+}
+
+// MeanAbs computes the mean absolute value of each channel over the interior
+func (p *FloatImg) MeanAbs() []float32 {
+	total := p.reduceInterior(p.Chancnt, func(chans []float32, acc []float64) {
+		for c, v := range chans {
+			acc[c] += math.Abs(float64(v))
+		}
+	})
+	mean := make([]float32, p.Chancnt)
+	if n := p.interiorSize(); n > 0 {
+		for c, v := range total {
+			mean[c] = float32(v / float64(n))
+		}
+	}
+	return mean
+}
+
+// RemoveDC subtracts the mean of channel over the interior from the channel
+// at every pixel in place, so its interior mean becomes 0
+func (p *FloatImg) RemoveDC(channel int) {
+	n := p.interiorSize()
+	if n == 0 {
+		return
+	}
+	total := p.reduceInterior(1, func(chans []float32, acc []float64) {
+		acc[0] += float64(chans[channel])
+	})
+	mean := float32(total[0] / float64(n))
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p.AtF(x, y)[channel] -= mean
+		}
+	}
+}
+
+// RemoveDCAll applies RemoveDC to all channels
+func (p *FloatImg) RemoveDCAll() {
+	for c := 0; c < p.Chancnt; c++ {
+		p.RemoveDC(c)
+	}
+}
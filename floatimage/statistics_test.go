@@ -0,0 +1,176 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// fromFunc returns a single channel image with dummy borders whose n x n
+// interior starting at (1, 1) holds f(x, y)
+func fromFunc(n int, f func(x, y int) float32) *FloatImg {
+	img := NewFloatImg(image.Rect(0, 0, n+2, n+2), 1)
+	for y := 1; y <= n; y++ {
+		for x := 1; x <= n; x++ {
+			img.Set(x, y, 0, f(x, y))
+		}
+	}
+	img.Dummies()
+	return img
+}
+
+func TestTotalVariation(t *testing.T) {
+	// a ramp and a step rising by the same amount have the same total
+	// variation, for the step it is just concentrated on a single column
+	tests := []struct {
+		name   string
+		f      func(x, y int) float32
+		tv, l1 float64
+	}{
+		{"constant", func(x, y int) float32 { return 42 }, 0, 0},
+		{"ramp", func(x, y int) float32 { return float32(10 * x) }, 16 * 15 * 10, 16 * 15 * 10},
+		{"step", func(x, y int) float32 {
+			if x > 8 {
+				return 150
+			}
+			return 0
+		}, 16 * 150, 16 * 150},
+		{"high step", func(x, y int) float32 {
+			if x > 8 {
+				return 300
+			}
+			return 0
+		}, 16 * 300, 16 * 300},
+		// 15x15 pixels with both differences, 30 with only one of them
+		{"diagonal ramp", func(x, y int) float32 { return float32(10 * (x + y)) },
+			15*15*math.Sqrt(200) + 30*10, 15*15*20 + 30*10},
+	}
+	for _, tt := range tests {
+		img := fromFunc(16, tt.f)
+		if tv := img.TotalVariation(0); !nearEq(float64(tv), tt.tv, 1e-3) {
+			t.Errorf("%s: TotalVariation = %f, want %f", tt.name, tv, tt.tv)
+		}
+		if l1 := img.TotalVariationL1(0); !nearEq(float64(l1), tt.l1, 1e-3) {
+			t.Errorf("%s: TotalVariationL1 = %f, want %f", tt.name, l1, tt.l1)
+		}
+	}
+}
+
+// nearEq reports whether a and b differ by at most the fraction eps of b
+func nearEq(a, b, eps float64) bool {
+	return math.Abs(a-b) <= eps*math.Max(math.Abs(b), 1)
+}
+
+// randomImg returns a w x h image with chancnt channels of uniform values in
+// -100 <= v < 100, with dummy borders holding different values than the
+// interior
+func randomImg(w, h, chancnt int, seed int64) *FloatImg {
+	rng := rand.New(rand.NewSource(seed))
+	img := NewFloatImg(image.Rect(0, 0, w, h), chancnt)
+	for i := range img.Pix {
+		img.Pix[i] = 200*rng.Float32() - 100
+	}
+	return img
+}
+
+func TestReductions(t *testing.T) {
+	tests := []struct {
+		w, h, chancnt int
+	}{
+		{3, 3, 1},
+		{17, 9, 2},
+		{64, 200, 3},
+		{2, 10, 1},
+	}
+	for i, tt := range tests {
+		img := randomImg(tt.w, tt.h, tt.chancnt, int64(i))
+		// serial references over the interior
+		sum := make([]float64, tt.chancnt)
+		abs := make([]float64, tt.chancnt)
+		var sq float64
+		n := 0
+		for y := 1; y < tt.h-1; y++ {
+			for x := 1; x < tt.w-1; x++ {
+				for c, v := range img.AtF(x, y) {
+					sum[c] += float64(v)
+					abs[c] += math.Abs(float64(v))
+					sq += float64(v) * float64(v)
+				}
+				n++
+			}
+		}
+
+		gotSum, gotAbs := img.Sum(), img.MeanAbs()
+		for c := 0; c < tt.chancnt; c++ {
+			if !nearEq(float64(gotSum[c]), sum[c], 1e-5) {
+				t.Errorf("%+v: Sum[%d] = %f, want %f", tt, c, gotSum[c], sum[c])
+			}
+			mean := 0.0
+			if n > 0 {
+				mean = abs[c] / float64(n)
+			}
+			if !nearEq(float64(gotAbs[c]), mean, 1e-5) {
+				t.Errorf("%+v: MeanAbs[%d] = %f, want %f", tt, c, gotAbs[c], mean)
+			}
+		}
+		if got := img.L2Norm(); !nearEq(float64(got), math.Sqrt(sq), 1e-5) {
+			t.Errorf("%+v: L2Norm = %f, want %f", tt, got, math.Sqrt(sq))
+		}
+	}
+}
+
+func TestRemoveDC(t *testing.T) {
+	tests := []struct {
+		w, h, chancnt int
+		offset        float32
+	}{
+		{3, 3, 1, 0},
+		{17, 9, 2, 1000},
+		{40, 31, 3, -250},
+	}
+	for _, tt := range tests {
+		img := randomImg(tt.w, tt.h, tt.chancnt, int64(tt.w))
+		for i := range img.Pix {
+			img.Pix[i] += tt.offset
+		}
+		n := float64((tt.w - 2) * (tt.h - 2))
+		for c := 0; c < tt.chancnt; c++ {
+			orig := img.Clone()
+			img.RemoveDC(c)
+			if mean := float64(img.Sum()[c]) / n; math.Abs(mean) > 1e-3 {
+				t.Errorf("%dx%d channel %d: mean %f after RemoveDC", tt.w, tt.h, c, mean)
+			}
+			// the whole channel including the dummy border is shifted by
+			// the same amount and the other channels stay
+			shift := img.Pix[c] - orig.Pix[c]
+			for i, v := range img.Pix {
+				want := orig.Pix[i]
+				if i%tt.chancnt == c {
+					want += shift
+				}
+				if !nearEq(float64(v), float64(want), 1e-5) {
+					t.Fatalf("%dx%d channel %d: value %d is %f, want %f", tt.w, tt.h, c, i, v, want)
+				}
+			}
+		}
+
+		img = randomImg(tt.w, tt.h, tt.chancnt, int64(tt.h))
+		img.RemoveDCAll()
+		for c, sum := range img.Sum() {
+			if mean := float64(sum) / n; math.Abs(mean) > 1e-3 {
+				t.Errorf("%dx%d channel %d: mean %f after RemoveDCAll", tt.w, tt.h, c, mean)
+			}
+		}
+	}
+
+	// nothing to do without interior
+	img := randomImg(2, 2, 1, 1)
+	orig := img.Clone()
+	img.RemoveDCAll()
+	for i, v := range img.Pix {
+		if v != orig.Pix[i] {
+			t.Fatalf("2x2 image: value %d changed from %f to %f", i, orig.Pix[i], v)
+		}
+	}
+}
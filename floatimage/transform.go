@@ -0,0 +1,96 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+)
+
+// RotateVectors rotates each (u, v) vector of the 2 channel flow field in
+// place by radians, pixel positions are unchanged. As the y axis points down
+// positive angles rotate counter-clockwise as seen on screen, e.g. a
+// rightward vector (1, 0) rotated by π/2 becomes the upward vector (0, -1)
+func (p *FloatImg) RotateVectors(radians float32) {
+	sin, cos := math.Sincos(float64(radians))
+	s, c := float32(sin), float32(cos)
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := p.AtF(x, y)
+			u, v := vec[0], vec[1]
+			vec[0], vec[1] = c*u+s*v, -s*u+c*v
+		}
+	}
+}
+
+// Rotate90 returns the image rotated counter-clockwise by 90 degrees as seen on
+// screen, the result starts at the same Rect.Min. Only pixel positions change,
+// to rotate a flow field use RotateVectors(math.Pi / 2) on the result as well
+func (p *FloatImg) Rotate90() *FloatImg {
+	bounds := p.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	r := NewFloatImg(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+h, bounds.Min.Y+w), p.Chancnt)
+	r.ColorFunc = p.ColorFunc
+	r.ColorModelFunc = p.ColorModelFunc
+	r.Boundary = p.Boundary
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copy(r.AtF(bounds.Min.X+y, bounds.Min.Y+w-1-x), p.AtF(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return r
+}
+
+// Transpose returns a new image with rows and columns swapped, the pixel at
+// x, y ends up at y, x and the Rect is transposed accordingly. For flow fields
+// use TransposeFlow which also swaps the vector components
+func (p *FloatImg) Transpose() *FloatImg {
+	bounds := p.Bounds()
+	t := NewFloatImg(image.Rect(bounds.Min.Y, bounds.Min.X, bounds.Max.Y, bounds.Max.X), p.Chancnt)
+	t.ColorFunc = p.ColorFunc
+	t.ColorModelFunc = p.ColorModelFunc
+	t.Boundary = p.Boundary
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			copy(t.AtF(y, x), p.AtF(x, y))
+		}
+	}
+	return t
+}
+
+// TransposeFlow is Transpose for 2 channel flow fields, additionally u and v
+// are swapped so the vectors match the transposed grid
+func (p *FloatImg) TransposeFlow() *FloatImg {
+	t := p.Transpose()
+	for i := 0; i+1 < len(t.Pix); i += 2 {
+		t.Pix[i], t.Pix[i+1] = t.Pix[i+1], t.Pix[i]
+	}
+	return t
+}
+
+// SwapFlowComponents swaps channels 0 and 1 of the 2 channel flow field in
+// place, converting between (drow, dcol) and the (u, v) = (dx, dy) convention
+// of this package
+func (p *FloatImg) SwapFlowComponents() {
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := p.AtF(x, y)
+			vec[0], vec[1] = vec[1], vec[0]
+		}
+	}
+}
+
+// NegateFlow negates the given channels of the flow field in place, e.g.
+// NegateFlow(1) converts a field with upward positive v and NegateFlow(0, 1)
+// reverses the direction of all vectors
+func (p *FloatImg) NegateFlow(components ...int) {
+	bounds := p.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			vec := p.AtF(x, y)
+			for _, c := range components {
+				vec[c] = -vec[c]
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package floatimage
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestRotateVectors(t *testing.T) {
+	tests := []struct {
+		name         string
+		u, v         float32
+		radians      float64
+		wantU, wantV float32
+	}{
+		{"right by 90°", 1, 0, math.Pi / 2, 0, -1},
+		{"up by 90°", 0, -1, math.Pi / 2, -1, 0},
+		{"right by -90°", 1, 0, -math.Pi / 2, 0, 1},
+		{"right by 180°", 2, 0, math.Pi, -2, 0},
+		{"diagonal by 45°", 1, 1, math.Pi / 4, math.Sqrt2, 0},
+		{"any by 0°", 3, -4, 0, 3, -4},
+		{"any by 360°", 3, -4, 2 * math.Pi, 3, -4},
+	}
+	for _, tt := range tests {
+		flow := NewFloatImg(image.Rect(0, 0, 3, 2), 2)
+		for i := 0; i < len(flow.Pix); i += 2 {
+			flow.Pix[i], flow.Pix[i+1] = tt.u, tt.v
+		}
+		flow.RotateVectors(float32(tt.radians))
+		for i := 0; i < len(flow.Pix); i += 2 {
+			if math.Abs(float64(flow.Pix[i]-tt.wantU)) > 1e-5 || math.Abs(float64(flow.Pix[i+1]-tt.wantV)) > 1e-5 {
+				t.Errorf("%s: got (%f, %f), want (%f, %f)", tt.name, flow.Pix[i], flow.Pix[i+1], tt.wantU, tt.wantV)
+				break
+			}
+		}
+	}
+}
+
+func TestRotateFlowFrame(t *testing.T) {
+	// rotating the frame with Rotate90 and the vectors with RotateVectors
+	// keeps each vector pointing at the rotated position of its target
+	const w, h = 5, 3
+	flow := NewFloatImg(image.Rect(0, 0, w, h), 2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			flow.Set(x, y, 0, float32(x-y))
+			flow.Set(x, y, 1, float32(2*y-x+1))
+		}
+	}
+	rotated := flow.Rotate90()
+	rotated.RotateVectors(math.Pi / 2)
+	// Rotate90 moves x, y to y, w-1-x
+	rot := func(x, y float32) (float32, float32) { return y, w - 1 - x }
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			vec := flow.AtF(x, y)
+			px, py := rot(float32(x), float32(y))
+			qx, qy := rot(float32(x)+vec[0], float32(y)+vec[1])
+			got := rotated.AtF(int(px), int(py))
+			if math.Abs(float64(got[0]-(qx-px))) > 1e-5 || math.Abs(float64(got[1]-(qy-py))) > 1e-5 {
+				t.Errorf("vector of %d, %d rotated to %v, want (%f, %f)", x, y, got, qx-px, qy-py)
+			}
+		}
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	tests := []struct {
+		r       image.Rectangle
+		chancnt int
+	}{
+		{image.Rect(0, 0, 5, 3), 1},
+		{image.Rect(-2, 4, 3, 11), 2},
+		{image.Rect(1, 1, 2, 6), 3},
+	}
+	for _, tt := range tests {
+		img := NewFloatImg(tt.r, tt.chancnt)
+		for i := range img.Pix {
+			img.Pix[i] = float32(i)
+		}
+		img.Boundary = BoundaryMirror
+		tr := img.Transpose()
+		want := image.Rect(tt.r.Min.Y, tt.r.Min.X, tt.r.Max.Y, tt.r.Max.X)
+		if tr.Bounds() != want || tr.Chancnt != tt.chancnt || tr.Stride != tt.chancnt*tt.r.Dy() {
+			t.Errorf("%v: transposed %v with %d channels and stride %d", tt.r, tr.Bounds(), tr.Chancnt, tr.Stride)
+			continue
+		}
+		if tr.Boundary != BoundaryMirror {
+			t.Errorf("%v: boundary mode %d not kept", tt.r, tr.Boundary)
+		}
+		for y := tt.r.Min.Y; y < tt.r.Max.Y; y++ {
+			for x := tt.r.Min.X; x < tt.r.Max.X; x++ {
+				a, b := img.AtF(x, y), tr.AtF(y, x)
+				for c := range a {
+					if a[c] != b[c] {
+						t.Errorf("%v: %v at %d, %d but %v at %d, %d", tt.r, a, x, y, b, y, x)
+					}
+				}
+			}
+		}
+		back := tr.Transpose()
+		if back.Bounds() != tt.r {
+			t.Errorf("%v: transposed twice %v", tt.r, back.Bounds())
+			continue
+		}
+		for i := range img.Pix {
+			if back.Pix[i] != img.Pix[i] {
+				t.Errorf("%v: transposed twice differs at %d", tt.r, i)
+				break
+			}
+		}
+	}
+}
+
+func TestTransposeFlow(t *testing.T) {
+	flow := NewFloatImg(image.Rect(0, 0, 4, 3), 2)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			flow.Set(x, y, 0, float32(x))
+			flow.Set(x, y, 1, float32(10*y))
+		}
+	}
+	tr := flow.TransposeFlow()
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			if vec := tr.AtF(y, x); vec[0] != float32(10*y) || vec[1] != float32(x) {
+				t.Errorf("vector at %d, %d = %v, want (%d, %d)", y, x, vec, 10*y, x)
+			}
+		}
+	}
+}
+
+func TestFlowConventions(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform func(flow *FloatImg)
+		want      func(u, v float32) (float32, float32)
+	}{
+		{"swap", func(f *FloatImg) { f.SwapFlowComponents() },
+			func(u, v float32) (float32, float32) { return v, u }},
+		{"swap twice", func(f *FloatImg) { f.SwapFlowComponents(); f.SwapFlowComponents() },
+			func(u, v float32) (float32, float32) { return u, v }},
+		{"negate u", func(f *FloatImg) { f.NegateFlow(0) },
+			func(u, v float32) (float32, float32) { return -u, v }},
+		{"negate v", func(f *FloatImg) { f.NegateFlow(1) },
+			func(u, v float32) (float32, float32) { return u, -v }},
+		{"reverse", func(f *FloatImg) { f.NegateFlow(0, 1) },
+			func(u, v float32) (float32, float32) { return -u, -v }},
+		{"negate nothing", func(f *FloatImg) { f.NegateFlow() },
+			func(u, v float32) (float32, float32) { return u, v }},
+		// (drow, dcol) with upward positive rows to (dx, dy)
+		{"swap and negate v", func(f *FloatImg) { f.SwapFlowComponents(); f.NegateFlow(1) },
+			func(u, v float32) (float32, float32) { return v, -u }},
+	}
+	for _, tt := range tests {
+		flow := NewFloatImg(image.Rect(-2, 1, 4, 5), 2)
+		for y := 1; y < 5; y++ {
+			for x := -2; x < 4; x++ {
+				flow.Set(x, y, 0, float32(x))
+				flow.Set(x, y, 1, float32(10*y+1))
+			}
+		}
+		// only the sub image is transformed
+		sub := image.Rect(-1, 2, 3, 4)
+		tt.transform(flow.SubImage(sub))
+		for y := 1; y < 5; y++ {
+			for x := -2; x < 4; x++ {
+				u, v := float32(x), float32(10*y+1)
+				if (image.Point{x, y}).In(sub) {
+					u, v = tt.want(u, v)
+				}
+				if vec := flow.AtF(x, y); vec[0] != u || vec[1] != v {
+					t.Errorf("%s: vector at %d, %d = %v, want (%g, %g)", tt.name, x, y, vec, u, v)
+				}
+			}
+		}
+	}
+}
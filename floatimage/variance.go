@@ -0,0 +1,107 @@
+package floatimage
+
+import (
+	"image"
+)
+
+// integralTable computes the (w+1)x(h+1) summed-area table of f applied to
+// channel 0 in float64, entry (y*(w+1) + x) holds the sum over the w x h
+// image region [0, x) x [0, y) relative to the image origin
+func (p *FloatImg) integralTable(f func(v float64) float64) []float64 {
+	bounds := p.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	table := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row float64
+		for x := 0; x < w; x++ {
+			row += f(float64(p.AtF(bounds.Min.X+x, bounds.Min.Y+y)[0]))
+			table[(y+1)*(w+1)+x+1] = table[y*(w+1)+x+1] + row
+		}
+	}
+	return table
+}
+
+// tableSum returns the sum over [x0, x1) x [y0, y1) from an integral table
+// of width w+1
+func tableSum(table []float64, w, x0, y0, x1, y1 int) float64 {
+	stride := w + 1
+	return table[y1*stride+x1] - table[y0*stride+x1] - table[y1*stride+x0] + table[y0*stride+x0]
+}
+
+// IntegralImage returns the summed-area table of channel 0 as single channel
+// image with bounds one larger than p in both directions. The value at
+// (Min.X+i, Min.Y+j) is the sum of channel 0 over [Min.X, Min.X+i) x
+// [Min.Y, Min.Y+j) so any rectangle sum needs 4 lookups (see IntegralSum).
+// The sums are accumulated in float64 and rounded to float32
+func (p *FloatImg) IntegralImage() *FloatImg {
+	bounds := p.Bounds()
+	table := p.integralTable(func(v float64) float64 { return v })
+	integral := NewFloatImg(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X+1, bounds.Max.Y+1), 1)
+	for i, v := range table {
+		integral.Pix[i] = float32(v)
+	}
+	return integral
+}
+
+// IntegralSum returns the sum over the rectangle r of the image the integral
+// image p was computed from with IntegralImage, r must lie inside that image
+func (p *FloatImg) IntegralSum(r image.Rectangle) float32 {
+	return p.AtF(r.Max.X, r.Max.Y)[0] - p.AtF(r.Max.X, r.Min.Y)[0] - p.AtF(r.Min.X, r.Max.Y)[0] + p.AtF(r.Min.X, r.Min.Y)[0]
+}
+
+// BoxBlur returns a single channel image holding the mean of channel 0 over
+// the (2*radius+1)² window around each pixel, clipped to the image
+func (p *FloatImg) BoxBlur(radius int) *FloatImg {
+	bounds := p.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sums := p.integralTable(func(v float64) float64 { return v })
+	blurred := NewFloatImg(bounds, 1)
+	for y := 0; y < h; y++ {
+		y0, y1 := clampWindow(y, radius, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := clampWindow(x, radius, w)
+			n := float64((x1 - x0) * (y1 - y0))
+			blurred.Set(bounds.Min.X+x, bounds.Min.Y+y, 0, float32(tableSum(sums, w, x0, y0, x1, y1)/n))
+		}
+	}
+	return blurred
+}
+
+// LocalVariance returns a single channel image holding the variance of
+// channel 0 over the (2*radius+1)² window around each pixel, clipped to the
+// image. The window sums of the values and their squares are looked up in
+// integral tables
+func (p *FloatImg) LocalVariance(radius int) *FloatImg {
+	bounds := p.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sums := p.integralTable(func(v float64) float64 { return v })
+	squares := p.integralTable(func(v float64) float64 { return v * v })
+	variance := NewFloatImg(bounds, 1)
+	for y := 0; y < h; y++ {
+		y0, y1 := clampWindow(y, radius, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := clampWindow(x, radius, w)
+			n := float64((x1 - x0) * (y1 - y0))
+			mean := tableSum(sums, w, x0, y0, x1, y1) / n
+			v := tableSum(squares, w, x0, y0, x1, y1)/n - mean*mean
+			if v < 0 {
+				v = 0
+			}
+			variance.Set(bounds.Min.X+x, bounds.Min.Y+y, 0, float32(v))
+		}
+	}
+	return variance
+}
+
+// clampWindow returns the half open window [i-radius, i+radius+1) clipped to
+// 0 <= i < n
+func clampWindow(i, radius, n int) (lo, hi int) {
+	lo, hi = i-radius, i+radius+1
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > n {
+		hi = n
+	}
+	return
+}
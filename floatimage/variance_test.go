@@ -0,0 +1,140 @@
+package floatimage
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// bruteVariance is the variance of channel 0 over the window around x, y
+// clipped to the image
+func bruteVariance(img *FloatImg, x, y, radius int) float64 {
+	window := image.Rect(x-radius, y-radius, x+radius+1, y+radius+1).Intersect(img.Bounds())
+	var sum, sq float64
+	for wy := window.Min.Y; wy < window.Max.Y; wy++ {
+		for wx := window.Min.X; wx < window.Max.X; wx++ {
+			v := float64(img.AtF(wx, wy)[0])
+			sum += v
+			sq += v * v
+		}
+	}
+	n := float64(window.Dx() * window.Dy())
+	return sq/n - (sum/n)*(sum/n)
+}
+
+func TestLocalVariance(t *testing.T) {
+	// the left half is flat, the right half a checkerboard of 0 and 100
+	img := NewFloatImg(image.Rect(2, 1, 26, 17), 1)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := float32(50)
+			if x >= 14 {
+				v = float32(100 * ((x + y) % 2))
+			}
+			img.Set(x, y, 0, v)
+		}
+	}
+	tests := []struct {
+		radius int
+		// the variance inside the checkerboard where the window has n
+		// samples, 1 more of one value than of the other
+		board float64
+	}{
+		{1, 100 * 100 * 5 * 4 / 81.0},
+		{2, 100 * 100 * 13 * 12 / 625.0},
+		{3, 100 * 100 * 25 * 24 / 2401.0},
+	}
+	for _, tt := range tests {
+		variance := img.LocalVariance(tt.radius)
+		if variance.Bounds() != bounds || variance.Chancnt != 1 {
+			t.Fatalf("radius %d: variance bounds %v with %d channels", tt.radius, variance.Bounds(), variance.Chancnt)
+		}
+		if got := variance.AtF(5, 8)[0]; got > 1e-3 {
+			t.Errorf("radius %d: flat variance %f, want 0", tt.radius, got)
+		}
+		if got := variance.AtF(20, 8)[0]; !nearEq(float64(got), tt.board, 1e-4) {
+			t.Errorf("radius %d: checkerboard variance %f, want %f", tt.radius, got, tt.board)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := bruteVariance(img, x, y, tt.radius)
+				if got := variance.AtF(x, y)[0]; !nearEq(float64(got), want, 1e-3) {
+					t.Errorf("radius %d: variance at %d, %d = %f, want %f", tt.radius, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// bruteSum sums channel 0 of img over r
+func bruteSum(img *FloatImg, r image.Rectangle) float64 {
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sum += float64(img.AtF(x, y)[0])
+		}
+	}
+	return sum
+}
+
+func TestIntegralImage(t *testing.T) {
+	// channel 1 must not leak into the sums
+	img := randomImg(13, 9, 2, 5).Reorigin(image.Point{-4, 3})
+	bounds := img.Bounds()
+	integral := img.IntegralImage()
+	if want := image.Rect(-4, 3, 10, 13); integral.Bounds() != want || integral.Chancnt != 1 {
+		t.Fatalf("integral image bounds %v with %d channels, want %v with 1", integral.Bounds(), integral.Chancnt, want)
+	}
+	tests := []image.Rectangle{
+		bounds,
+		image.Rect(-4, 3, -3, 4),
+		image.Rect(0, 5, 7, 11),
+		image.Rect(8, 3, 9, 12),
+		image.Rect(-4, 11, 9, 12),
+		image.Rect(2, 6, 2, 9),
+	}
+	rng := rand.New(rand.NewSource(9))
+	for i := 0; i < 50; i++ {
+		x0, y0 := bounds.Min.X+rng.Intn(bounds.Dx()), bounds.Min.Y+rng.Intn(bounds.Dy())
+		x1, y1 := x0+rng.Intn(bounds.Max.X-x0+1), y0+rng.Intn(bounds.Max.Y-y0+1)
+		tests = append(tests, image.Rect(x0, y0, x1, y1))
+	}
+	for _, r := range tests {
+		want := bruteSum(img, r)
+		if got := integral.IntegralSum(r); !nearEq(float64(got), want, 1e-4) {
+			t.Errorf("sum over %v is %f, want %f", r, got, want)
+		}
+	}
+	// the first row and column are zero
+	for x := bounds.Min.X; x <= bounds.Max.X; x++ {
+		if v := integral.AtF(x, bounds.Min.Y)[0]; v != 0 {
+			t.Errorf("integral at %d, %d is %f, want 0", x, bounds.Min.Y, v)
+		}
+	}
+	for y := bounds.Min.Y; y <= bounds.Max.Y; y++ {
+		if v := integral.AtF(bounds.Min.X, y)[0]; v != 0 {
+			t.Errorf("integral at %d, %d is %f, want 0", bounds.Min.X, y, v)
+		}
+	}
+}
+
+func TestBoxBlur(t *testing.T) {
+	img := randomImg(11, 8, 1, 2).Reorigin(image.Point{3, -1})
+	bounds := img.Bounds()
+	for _, radius := range []int{0, 1, 2, 6} {
+		blurred := img.BoxBlur(radius)
+		if blurred.Bounds() != bounds || blurred.Chancnt != 1 {
+			t.Fatalf("radius %d: blurred bounds %v with %d channels", radius, blurred.Bounds(), blurred.Chancnt)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				window := image.Rect(x-radius, y-radius, x+radius+1, y+radius+1).Intersect(bounds)
+				want := bruteSum(img, window) / float64(window.Dx()*window.Dy())
+				if got := blurred.AtF(x, y)[0]; !nearEq(float64(got), want, 1e-4) {
+					t.Errorf("radius %d: mean at %d, %d = %f, want %f", radius, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"github.com/harrydb/go/img/pnm"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// encodeImage writes img to w in the given format ("pgm", "ppm" or "png").
+// Grayscale formats need a single channel image, color formats a 3 channel one
+func encodeImage(w io.Writer, img *floatimage.FloatImg, format string) error {
+	switch format {
+	case "pgm":
+		if img.Chancnt != 1 {
+			return fmt.Errorf("pgm needs a 1 channel image, got %d channels", img.Chancnt)
+		}
+		return pnm.Encode(w, img, pnm.PGM)
+	case "ppm":
+		if img.Chancnt != 3 {
+			return fmt.Errorf("ppm needs a 3 channel image, got %d channels", img.Chancnt)
+		}
+		return pnm.Encode(w, img, pnm.PPM)
+	case "png":
+		if img.Chancnt != 1 && img.Chancnt != 3 {
+			return fmt.Errorf("png needs a 1 or 3 channel image, got %d channels", img.Chancnt)
+		}
+		return png.Encode(w, img)
+	}
+	return fmt.Errorf("unknown image format %q", format)
+}
+
+// formatFromName derives the image format from the file extension of name
+func formatFromName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+}
+
+// writeImage saves img to the file name using the format given by its
+// extension, any error is fatal
+func writeImage(name string, img *floatimage.FloatImg) {
+	fout, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = encodeImage(fout, img, formatFromName(name))
+	if err != nil {
+		log.Fatalf("Writing %s: %v", name, err)
+	}
+	// a failed close can mean the data never reached the file
+	if err := fout.Close(); err != nil {
+		log.Fatalf("Closing %s: %v", name, err)
+	}
+}
+
+// encodeImage16 writes the single channel img with values 0 <= val <= 65535
+// to w as 16 bit grayscale in the given format ("pgm" or "png")
+func encodeImage16(w io.Writer, img *floatimage.FloatImg, format string) error {
+	if img.Chancnt != 1 {
+		return fmt.Errorf("16 bit output needs a 1 channel image, got %d channels", img.Chancnt)
+	}
+	switch format {
+	case "pgm":
+		return encodePGM16(w, img.ToGray16())
+	case "png":
+		return png.Encode(w, img.ToGray16())
+	}
+	return fmt.Errorf("16 bit output needs pgm or png, got %q", format)
+}
+
+// encodePGM16 writes g as binary PGM with maxval 65535, the samples are
+// big endian just like the Pix of image.Gray16
+func encodePGM16(w io.Writer, g *image.Gray16) error {
+	bounds := g.Bounds()
+	if _, err := fmt.Fprintf(w, "P5\n%d %d\n65535\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return fmt.Errorf("writing pgm header: %v", err)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := g.PixOffset(bounds.Min.X, y)
+		if _, err := w.Write(g.Pix[i : i+2*bounds.Dx()]); err != nil {
+			return fmt.Errorf("writing pgm row %d: %v", y-bounds.Min.Y, err)
+		}
+	}
+	return nil
+}
+
+// writeImage16 saves the single channel img with values 0 <= val <= 65535
+// as 16 bit grayscale to the file name using the format given by its
+// extension, any error is fatal
+func writeImage16(name string, img *floatimage.FloatImg) {
+	fout, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = encodeImage16(fout, img, formatFromName(name))
+	if err != nil {
+		log.Fatalf("Writing %s: %v", name, err)
+	}
+	if err := fout.Close(); err != nil {
+		log.Fatalf("Closing %s: %v", name, err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodeImage16(t *testing.T) {
+	img := floatimage.NewFloatImg(image.Rect(0, 0, 3, 2), 1)
+	copy(img.Pix, []float32{0, 255, 256, 1000, 65535, 70000})
+	want := []uint16{0, 255, 256, 1000, 65535, 65535}
+
+	var buf bytes.Buffer
+	if err := encodeImage16(&buf, img, "pgm"); err != nil {
+		t.Fatalf("pgm: %v", err)
+	}
+	header := "P5\n3 2\n65535\n"
+	if got := buf.String()[:len(header)]; got != header {
+		t.Errorf("pgm header %q, want %q", got, header)
+	}
+	samples := buf.Bytes()[len(header):]
+	if len(samples) != 2*len(want) {
+		t.Fatalf("pgm has %d sample bytes, want %d", len(samples), 2*len(want))
+	}
+	for i, w := range want {
+		if got := uint16(samples[2*i])<<8 | uint16(samples[2*i+1]); got != w {
+			t.Errorf("pgm sample %d = %d, want %d", i, got, w)
+		}
+	}
+
+	buf.Reset()
+	if err := encodeImage16(&buf, img, "png"); err != nil {
+		t.Fatalf("png: %v", err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding png: %v", err)
+	}
+	g, ok := decoded.(*image.Gray16)
+	if !ok {
+		t.Fatalf("png decodes to %T, want *image.Gray16", decoded)
+	}
+	for i, w := range want {
+		if got := g.Gray16At(i%3, i/3).Y; got != w {
+			t.Errorf("png sample %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestEncodeImage16Invalid(t *testing.T) {
+	tests := []struct {
+		chancnt int
+		format  string
+	}{
+		{1, "ppm"},
+		{1, "jpg"},
+		{3, "pgm"},
+		{2, "png"},
+	}
+	for _, tc := range tests {
+		img := floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), tc.chancnt)
+		if err := encodeImage16(&bytes.Buffer{}, img, tc.format); err == nil {
+			t.Errorf("%d channels as %s: no error", tc.chancnt, tc.format)
+		}
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	tests := []struct {
+		chancnt int
+		format  string
+		valid   bool
+		magic   string
+	}{
+		{1, "pgm", true, "P5"},
+		{3, "ppm", true, "P6"},
+		{1, "png", true, "\x89PNG"},
+		{3, "png", true, "\x89PNG"},
+		{3, "pgm", false, ""},
+		{2, "pgm", false, ""},
+		{1, "ppm", false, ""},
+		{2, "ppm", false, ""},
+		{2, "png", false, ""},
+		{4, "png", false, ""},
+		{1, "jpg", false, ""},
+		{3, "", false, ""},
+	}
+	for _, tc := range tests {
+		img := floatimage.NewFloatImg(image.Rect(0, 0, 4, 3), tc.chancnt)
+		var buf bytes.Buffer
+		err := encodeImage(&buf, img, tc.format)
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("%d channels as %q: no error", tc.chancnt, tc.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d channels as %q: %v", tc.chancnt, tc.format, err)
+			continue
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte(tc.magic)) {
+			t.Errorf("%d channels as %q: output starts with %.4q, want %q",
+				tc.chancnt, tc.format, buf.String(), tc.magic)
+		}
+	}
+}
+
+func TestFormatFromName(t *testing.T) {
+	tests := []struct {
+		name, format string
+	}{
+		{"mag.pgm", "pgm"},
+		{"dir.PPM", "ppm"},
+		{"out/flow.field.png", "png"},
+		{"noext", ""},
+	}
+	for _, tc := range tests {
+		if got := formatFromName(tc.name); got != tc.format {
+			t.Errorf("formatFromName(%q) = %q, want %q", tc.name, got, tc.format)
+		}
+	}
+}
+
+// errWriteFailed is returned by limitWriter once its limit is used up
+var errWriteFailed = errors.New("write failed")
+
+// limitWriter accepts n bytes and then fails with errWriteFailed, writing the
+// part of the last buffer that still fits
+type limitWriter struct {
+	n int
+}
+
+func (p *limitWriter) Write(b []byte) (int, error) {
+	if len(b) <= p.n {
+		p.n -= len(b)
+		return len(b), nil
+	}
+	written := p.n
+	p.n = 0
+	return written, errWriteFailed
+}
+
+func TestEncodeImage16Failing(t *testing.T) {
+	// the 13 byte header "P5\n3 2\n65535\n" and 2 rows of 6 bytes, the
+	// png encoder reports its own errors
+	img := floatimage.NewFloatImg(image.Rect(0, 0, 3, 2), 1)
+	tests := []struct {
+		format string
+		limit  int
+		ok     bool
+		stage  string
+	}{
+		{"pgm", 0, false, "pgm header"},
+		{"pgm", 12, false, "pgm header"},
+		{"pgm", 13, false, "pgm row 0"},
+		{"pgm", 18, false, "pgm row 0"},
+		{"pgm", 19, false, "pgm row 1"},
+		{"pgm", 25, true, ""},
+		{"png", 0, false, ""},
+	}
+	for _, tt := range tests {
+		err := encodeImage16(&limitWriter{tt.limit}, img, tt.format)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%s, limit %d: %v", tt.format, tt.limit, err)
+		case !tt.ok && err == nil:
+			t.Errorf("%s, limit %d: no error", tt.format, tt.limit)
+		case !tt.ok && (!strings.Contains(err.Error(), tt.stage) || !strings.Contains(err.Error(), errWriteFailed.Error())):
+			t.Errorf("%s, limit %d: error %q doesn't mention %q and the cause", tt.format, tt.limit, err, tt.stage)
+		}
+	}
+}
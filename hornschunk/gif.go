@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"image/draw"
+	"image/gif"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readGIFFrames decodes all frames of the GIF file name composed onto the
+// logical screen as they are displayed, honoring the disposal methods. It
+// returns nil if name is not a GIF
+func readGIFFrames(name string) []image.Image {
+	fin, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fin.Close()
+
+	if _, format, err := image.DecodeConfig(fin); err != nil || format != "gif" {
+		return nil
+	}
+	if _, err := fin.Seek(0, 0); err != nil {
+		log.Fatal(err)
+	}
+	g, err := gif.DecodeAll(fin)
+	if err != nil {
+		log.Fatalf("Reading %s: %v", name, err)
+	}
+	return composeGIF(g)
+}
+
+// composeGIF renders the frames of g, GIF frames may only cover part of the
+// screen and rely on the previous frames for the rest
+func composeGIF(g *gif.GIF) []image.Image {
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() && len(g.Image) > 0 {
+		screen = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(screen)
+	frames := make([]image.Image, 0, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(screen)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		composed := image.NewRGBA(screen)
+		copy(composed.Pix, canvas.Pix)
+		frames = append(frames, composed)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// numberedName inserts the frame number n before the extension of name
+func numberedName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s%04d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// numbered returns the names with the frame number n inserted (see
+// numberedName), the snapshots of the pair get the prefix <snapshots>NNNN_
+func (p outputs) numbered(n int) outputs {
+	for _, name := range []*string{&p.mag, &p.dir, &p.color, &p.csv, &p.flo, &p.combined,
+		&p.energy, &p.warp, &p.residual, &p.conf, &p.tempGrad} {
+		if *name != "" {
+			*name = numberedName(*name, n)
+		}
+	}
+	if p.snapshots != "" {
+		p.snapshots = fmt.Sprintf("%s%04d_", p.snapshots, n)
+	}
+	return p
+}
+
+// gifFlow computes the flow between each pair of consecutive frames like for
+// two images and writes all outputs numbered, the flow between frame n-1
+// and n gets number n
+func gifFlow(frames []image.Image, names outputs) {
+	for n := 1; n < len(frames); n++ {
+		fmt.Printf("Frames %d and %d\n", n-1, n)
+		f1 := floatimage.GrayFloatWithDummiesFromImage(frames[n-1])
+		f2 := floatimage.GrayFloatWithDummiesFromImage(frames[n])
+		flowPair(f1, f2, names.numbered(n))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{255, 0, 0, 255}
+	green = color.RGBA{0, 255, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+)
+
+// testPalette holds the colors of the test GIFs and 256 gray levels
+var testPalette = func() color.Palette {
+	p := color.Palette{red, green, blue}
+	for i := 0; i < 253; i++ {
+		p = append(p, color.Gray{uint8(i)})
+	}
+	return p
+}()
+
+// filledFrame returns a paletted GIF frame covering r in the color c
+func filledFrame(r image.Rectangle, c color.Color) *image.Paletted {
+	frame := image.NewPaletted(r, testPalette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			frame.Set(x, y, c)
+		}
+	}
+	return frame
+}
+
+func TestComposeGIF(t *testing.T) {
+	screen := image.Rect(0, 0, 4, 4)
+	inner := image.Rect(1, 1, 3, 3)
+	corner := image.Rect(0, 0, 1, 1)
+	tests := []struct {
+		name     string
+		disposal byte
+		// the colors of the third frame at the inner square and the
+		// corner, the rest of the screen is red from the first frame
+		inner, corner color.RGBA
+	}{
+		{"none", gif.DisposalNone, blue, green},
+		{"background", gif.DisposalBackground, color.RGBA{}, green},
+		{"previous", gif.DisposalPrevious, red, green},
+	}
+	for _, tt := range tests {
+		g := &gif.GIF{
+			Image:    []*image.Paletted{filledFrame(screen, red), filledFrame(inner, blue), filledFrame(corner, green)},
+			Delay:    []int{0, 0, 0},
+			Disposal: []byte{gif.DisposalNone, tt.disposal, gif.DisposalNone},
+			Config:   image.Config{ColorModel: testPalette, Width: 4, Height: 4},
+		}
+		frames := composeGIF(g)
+		if len(frames) != 3 {
+			t.Fatalf("%s: %d frames, want 3", tt.name, len(frames))
+		}
+		for i, frame := range frames {
+			if frame.Bounds() != screen {
+				t.Errorf("%s: frame %d bounds %v, want %v", tt.name, i, frame.Bounds(), screen)
+			}
+		}
+		// the partial second frame is drawn over the first one
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				want := red
+				if (image.Point{x, y}).In(inner) {
+					want = blue
+				}
+				if got := color.RGBAModel.Convert(frames[1].At(x, y)); got != want {
+					t.Errorf("%s: frame 1 at (%d, %d) is %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				want := red
+				switch p := (image.Point{x, y}); {
+				case p.In(corner):
+					want = tt.corner
+				case p.In(inner):
+					want = tt.inner
+				}
+				if got := color.RGBAModel.Convert(frames[2].At(x, y)); got != want {
+					t.Errorf("%s: frame 2 at (%d, %d) is %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// writeTestGIF saves an animated GIF of n frames of the smooth gray pattern,
+// each moved 1 pixel right of the previous one
+func writeTestGIF(t *testing.T, name string, n, w, h int) {
+	g := &gif.GIF{Config: image.Config{ColorModel: testPalette, Width: w, Height: h}}
+	framePNG := filepath.Join(filepath.Dir(name), "frame.png")
+	for i := 0; i < n; i++ {
+		writeTestPNG(t, framePNG, w, h, float64(i))
+		src := readTestPNG(t, framePNG)
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), testPalette)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				frame.Set(x, y, src.At(x, y))
+			}
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := gif.EncodeAll(f, g); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGIFFlow(t *testing.T) {
+	tests := []struct {
+		frames int
+		// number of flow fields, a single frame GIF is read as still image
+		// and has no second image to compare with
+		flows int
+		ok    bool
+	}{
+		{2, 1, true},
+		{3, 2, true},
+		{1, 0, false},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		in := filepath.Join(dir, "in.gif")
+		writeTestGIF(t, in, tt.frames, 24, 20)
+		mag, dirImg := filepath.Join(dir, "mag.png"), filepath.Join(dir, "dir.png")
+		out, ok := runMain(t, "-infile1", in, "-infile2", filepath.Join(dir, "missing.png"),
+			"-magimg", mag, "-dirimg", dirImg, "-iterations", "5")
+		if ok != tt.ok {
+			t.Errorf("%d frames: success %v, want %v, output:\n%s", tt.frames, ok, tt.ok, out)
+			continue
+		}
+		for n := 0; n <= tt.flows+1; n++ {
+			for _, name := range []string{numberedName(mag, n), numberedName(dirImg, n)} {
+				_, err := os.Stat(name)
+				if exists, want := err == nil, n >= 1 && n <= tt.flows; exists != want {
+					t.Errorf("%d frames: %s exists %v, want %v", tt.frames, filepath.Base(name), exists, want)
+				}
+				if err == nil {
+					if size := readTestPNG(t, name).Bounds().Size(); size != (image.Point{24, 20}) {
+						t.Errorf("%d frames: %s is %v, want 24x20", tt.frames, filepath.Base(name), size)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGIFFlowOutputs(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.gif")
+	writeTestGIF(t, in, 3, 24, 20)
+	name := func(base string) string { return filepath.Join(dir, base) }
+	out, ok := runMain(t, "-infile1", in, "-magimg", name("mag.png"), "-dirimg", name("dir.png"),
+		"-csv", name("flow.csv"), "-floout", name("flow.flo"), "-warpimg", name("warp.png"),
+		"-colorimg", name("color.png"), "-snapshots", name("snap"), "-snapevery", "5",
+		"-iterations", "5")
+	if !ok {
+		t.Fatalf("failed, output:\n%s", out)
+	}
+	for n := 1; n <= 2; n++ {
+		for _, base := range []string{"mag.png", "dir.png", "flow.csv", "flow.flo", "warp.png", "color.png"} {
+			if _, err := os.Stat(numberedName(name(base), n)); err != nil {
+				t.Errorf("pair %d: %v", n, err)
+			}
+		}
+		if _, err := os.Stat(name(fmt.Sprintf("snap%04d_0005.png", n))); err != nil {
+			t.Errorf("pair %d: %v", n, err)
+		}
+		// the frames move 1 pixel right like the still images
+		if u := meanU(readTestFlo(t, numberedName(name("flow.flo"), n))); u < 0.3 {
+			t.Errorf("pair %d: mean u %f, want the rightward motion", n, u)
+		}
+	}
+}
+
+func TestNumberedName(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"mag.png", 1, "mag0001.png"},
+		{"out/dir.ppm", 12, "out/dir0012.ppm"},
+		{"flow", 3, "flow0003"},
+		{"a.b.pgm", 10000, "a.b10000.pgm"},
+	}
+	for _, tt := range tests {
+		if got := numberedName(tt.name, tt.n); got != tt.want {
+			t.Errorf("numberedName(%q, %d) = %q, want %q", tt.name, tt.n, got, tt.want)
+		}
+	}
+}
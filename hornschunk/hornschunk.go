@@ -7,16 +7,16 @@ package main
 import (
 	"flag"
 	"fmt"
-	"github.com/harrydb/go/img/pnm"
 	"github.com/niklas88/imgtest/algorithms"
 	"github.com/niklas88/imgtest/floatimage"
 	"image"
-	"image/color"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"log"
+	"math"
 	"os"
+	"time"
 )
 
 func analyse(img *floatimage.FloatImg) (min, max, mean, variance float32) {
@@ -27,8 +27,10 @@ func analyse(img *floatimage.FloatImg) (min, max, mean, variance float32) {
 	}
 
 	sum = 0.0
-	min = img.Pix[0]
-	max = img.Pix[0]
+	// start with the first interior pixel, Pix[0] is a dummy and for sub
+	// images not even part of the image
+	min = img.Pix[img.PixOffset(bounds.Min.X+1, bounds.Min.Y+1)]
+	max = min
 	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
 		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
 			value := img.AtF(x, y)[0]
@@ -42,34 +44,143 @@ func analyse(img *floatimage.FloatImg) (min, max, mean, variance float32) {
 		}
 	}
 	imgsize := float64(bounds.Dx()-2) * float64(bounds.Dy()-2)
-	mean = float32(sum / imgsize)
-	variance = 0.0
+	mean64 := sum / imgsize
+	mean = float32(mean64)
+	var varsum float64
 	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
 		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
-			temp := img.AtF(x, y)[0] - mean
-			variance += temp * temp
+			temp := float64(img.AtF(x, y)[0]) - mean64
+			varsum += temp * temp
 		}
 	}
-	variance = float32(float64(variance) / imgsize)
+	variance = float32(varsum / imgsize)
+	return
+}
+
+// analyseMasked is like analyse but only takes the interior pixels into
+// account where the single channel mask is > 0
+func analyseMasked(img, mask *floatimage.FloatImg) (min, max, mean, variance float32) {
+	var sum float64
+	var count int
+	bounds := img.Bounds()
+
+	min = math.MaxFloat32
+	max = -math.MaxFloat32
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			if mask.AtF(x, y)[0] <= 0 {
+				continue
+			}
+			value := img.AtF(x, y)[0]
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max = value
+			}
+			sum += float64(value)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, 0, 0
+	}
+	mean = float32(sum / float64(count))
+	var varsum float64
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			if mask.AtF(x, y)[0] <= 0 {
+				continue
+			}
+			temp := float64(img.AtF(x, y)[0] - mean)
+			varsum += temp * temp
+		}
+	}
+	variance = float32(varsum / float64(count))
 	return
 }
 
 var finame1, finame2 string
 var magImageName, dirImageName string
+var warpImageName string
+var residualImageName string
+var confImageName string
+var consistency float64
+var csvName string
+var csvStep int
+var cropMatch bool
+var progress bool
+var initFlowName string
+var maskName string
+var snapshotPrefix string
+var snapshotEvery int
+var mag16 bool
+var energyImageName string
+var staticThreshold float64
+var colorImageName string
+var visOnlyName string
+var floOutName string
+var tempGradName string
+var combinedName string
 var alpha float64
 var iterations int
+var logInterval int
+var omega float64
+var convergence bool
+var clip float64
+var derivName string
 
 func init() {
-	flag.StringVar(&finame1, "infile1", "img1.pgm", "The first image for optical flow computation")
+	flag.StringVar(&finame1, "infile1", "img1.pgm", "The first image for optical flow computation, for an animated GIF the flow between all consecutive frames is computed")
 	flag.StringVar(&finame2, "infile2", "img2.pgm", "The second image for optical flow computation")
 	flag.StringVar(&magImageName, "magimg", "mag.pgm", "The flow magnitude image")
-	flag.StringVar(&dirImageName, "dirimg", "direction.ppm", "The flow direction image")
+	flag.StringVar(&dirImageName, "dirimg", "direction.ppm", "The flow direction image in the Middlebury color code")
+	flag.StringVar(&warpImageName, "warpimg", "", "If set the second image warped back by the flow is saved here, it should look like the first image if the flow is good")
+	flag.StringVar(&residualImageName, "residualimg", "", "If set the residual of the first image minus the warped second image is saved here as gray level 127.5 + residual/2")
+	flag.StringVar(&confImageName, "confimg", "", "If set the direction image dimmed where the forward-backward consistency check fails is saved here")
+	flag.Float64Var(&consistency, "consistency", 1.0, "The maximum forward-backward distance in pixels for a consistent flow vector")
+	flag.StringVar(&csvName, "csv", "", "If set the flow field is saved here as CSV with columns x,y,u,v")
+	flag.IntVar(&csvStep, "csvstep", 1, "Only write every csvstep-th flow vector in both directions to the CSV")
+	flag.BoolVar(&cropMatch, "cropmatch", false, "If the image sizes differ crop both to their common region instead of aborting")
+	flag.BoolVar(&progress, "progress", false, "Print the solver progress to stderr")
+	flag.StringVar(&initFlowName, "initflow", "", "If set the solver starts from the flow in this .flo file")
+	flag.StringVar(&maskName, "mask", "", "If set only pixels that are not black in this image are used for the image statistics")
+	flag.StringVar(&snapshotPrefix, "snapshots", "", "If set direction images of intermediate flows are saved as <prefix>NNNN.png, for GIF input as <prefix>FFFF_NNNN.png with the frame number FFFF")
+	flag.IntVar(&snapshotEvery, "snapevery", 10, "Number of iterations between snapshots")
+	flag.BoolVar(&mag16, "mag16", false, "Write the flow magnitude image with 16 bit precision, needs a .pgm or .png magimg")
+	flag.StringVar(&energyImageName, "energyimg", "", "If set the per pixel Horn & Schunk energy is saved here, bright regions violate the model")
+	flag.Float64Var(&staticThreshold, "static", 0.0, "If the mean absolute difference of the images is below this many gray levels the flow is zero without solving, 0 always solves")
+	flag.StringVar(&colorImageName, "colorimg", "", "If set the flow is saved here color coded with the direction as hue and the magnitude as saturation")
+	flag.StringVar(&floOutName, "floout", "", "If set the raw flow field is saved here as .flo file")
+	flag.StringVar(&tempGradName, "tempgrad", "", "If set the absolute difference of the two images is saved here as quick motion indicator")
+	flag.StringVar(&combinedName, "combined", "", "If set the first image, the magnitude and the direction image are saved here side by side")
+	flag.StringVar(&visOnlyName, "visonly", "", "If set the flow is read from this .flo file and only the flow visualizations are written, skipping the solver")
 	flag.Float64Var(&alpha, "alpha", 100.0, "The smoothing weight alpha > 0")
 	flag.IntVar(&iterations, "iterations", 160, "Number of iterations")
+	flag.Float64Var(&omega, "omega", 0.0, "If > 0 solve with red-black SOR using this relaxation factor (1 is Gauss-Seidel, < 2 for convergence) instead of Jacobi")
+	flag.BoolVar(&convergence, "convergence", false, "Print the convergence factor of the solver estimated from the residuals every loginterval iterations")
+	flag.IntVar(&logInterval, "loginterval", 1, "Number of iterations between progress updates, snapshots and residuals, a negative value disables them")
+	flag.StringVar(&derivName, "deriv", "central", "The spatial derivative kernel: central, sobel or scharr")
+	flag.Float64Var(&clip, "clip", 0.0, "Clip the flow magnitude to the clip and 100-clip percentiles for visualization, 0 scales to the maximum")
 }
 
 func main() {
 	flag.Parse()
+	if format := formatFromName(magImageName); mag16 && format != "pgm" && format != "png" {
+		log.Fatalf("-mag16 needs a .pgm or .png magimg, got %q", magImageName)
+	}
+	names := flagOutputs()
+	if visOnlyName != "" {
+		fmt.Printf("Visualizing the optical flow in %s, result will be saved in %s and %s\n", visOnlyName, magImageName, dirImageName)
+		uv := readFlow(visOnlyName).AddDummies()
+		writeFlowOutputs(uv, names)
+		return
+	}
+	if frames := readGIFFrames(finame1); len(frames) > 1 {
+		fmt.Printf("Computing optical flow between the %d frames of %s, results will be saved numbered as %s and %s\n", len(frames), finame1, magImageName, dirImageName)
+		gifFlow(frames, names)
+		return
+	}
 	fmt.Printf("Computing optical flow betwen %s and %s, result will be saved in %s and %s\n", finame1, finame2, magImageName, dirImageName)
 
 	fin1, err := os.Open(finame1)
@@ -95,52 +206,349 @@ func main() {
 	}
 
 	if !img1.Bounds().Eq(img2.Bounds()) {
-		log.Fatal("The image bounds need to match")
+		if !cropMatch {
+			log.Fatal("The image bounds need to match")
+		}
+		bounds1, bounds2 := img1.Bounds(), img2.Bounds()
+		img1, img2, err = cropToCommon(img1, img2)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Cropping %v and %v to the common region %v", bounds1, bounds2, img1.Bounds())
 	}
 
 	// Create Gray float based images with overlap for mirroring boundaries
 	f1 := floatimage.GrayFloatWithDummiesFromImage(img1)
 	f2 := floatimage.GrayFloatWithDummiesFromImage(img2)
+	flowPair(f1, f2, names)
+}
 
-	min1, max1, mean1, var1 := analyse(f1)
-	min2, max2, mean2, var2 := analyse(f2)
+// flowPair computes the flow between the gray images f1 and f2 with dummy
+// borders, prints their statistics and the flow diagnostics and writes all
+// outputs to names
+func flowPair(f1, f2 *floatimage.FloatImg, names outputs) {
+	var min1, max1, mean1, var1, min2, max2, mean2, var2 float32
+	if maskName != "" {
+		mask := floatimage.GrayFloatWithDummiesFromImage(readImage(maskName))
+		if !mask.Bounds().Eq(f1.Bounds()) {
+			log.Fatal("The mask bounds need to match the image bounds")
+		}
+		min1, max1, mean1, var1 = analyseMasked(f1, mask)
+		min2, max2, mean2, var2 = analyseMasked(f2, mask)
+	} else {
+		min1, max1, mean1, var1 = analyse(f1)
+		min2, max2, mean2, var2 = analyse(f2)
+	}
 	fmt.Printf("min1 = %f, max1 = %f, mean1 = %f, var1 = %f\n", min1, max1, mean1, var1)
 	fmt.Printf("min2 = %f, max2 = %f, mean2 = %f, var2 = %f\n", min2, max2, mean2, var2)
+	fmt.Printf("noise1 = %f, noise2 = %f\n", algorithms.EstimateNoise(f1), algorithms.EstimateNoise(f2))
+	if names.tempGrad != "" {
+		writeImage(names.tempGrad, algorithms.TemporalGradient(f1, f2).Dedummify())
+	}
+
+	opts := &algorithms.HornSchunkOptions{
+		Alpha:       float32(alpha),
+		Iterations:  iterations,
+		Deriv:       parseDeriv(derivName),
+		Omega:       float32(omega),
+		LogInterval: logInterval,
+	}
+	if progress {
+		opts.OnIteration = progressPrinter(iterations, logInterval)
+	}
+	if names.snapshots != "" {
+		opts.SnapshotEvery = snapshotEvery
+		opts.OnSnapshot = func(iter int, uv *floatimage.FloatImg) {
+			writeImage(fmt.Sprintf("%s%04d.png", names.snapshots, iter), algorithms.StandardFlowColor(uv).Dedummify())
+		}
+	}
+	var uv *floatimage.FloatImg
+	var err error
+	if staticThreshold > 0 && algorithms.IsStatic(f1, f2, float32(staticThreshold)) {
+		fmt.Println("The scene is static, skipping the solver")
+		uv = floatimage.NewFloatImg(f1.Bounds(), 2)
+	} else if initFlowName != "" {
+		uv, err = algorithms.OpticFlowHornSchunkInitOptions(f1, f2, readInitFlow(initFlowName, f1.Bounds().Inset(1)), opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if convergence {
+		var factor float32
+		uv, factor = algorithms.OpticFlowHornSchunkConvergence(f1, f2, opts)
+		fmt.Printf("convergence factor = %f\n", factor)
+	} else {
+		uv = algorithms.OpticFlowHornSchunkOptions(f1, f2, opts)
+	}
+	opts.OnIteration = nil
+	opts.OnSnapshot = nil
+	if names.flo != "" {
+		writeFlow(names.flo, uv.Dedummify())
+	}
+	magImg, dirImg := writeFlowOutputs(uv, names)
+	if names.combined != "" {
+		parts := []*floatimage.FloatImg{promoteRGB(f1.Dedummify()), promoteRGB(magImg.Dedummify()), dirImg.Dedummify()}
+		combined, err := floatimage.Montage(parts, len(parts), combinedGap, 255)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeImage(names.combined, combined)
+	}
 
-	uv := algorithms.OpticFlowHornSchunk(f1, f2, float32(alpha), iterations)
-	magImg := algorithms.MagImage(uv)
+	if names.energy != "" {
+		energy := algorithms.EnergyMapOptions(f1, f2, uv, opts)
+		energy.ScaleToUnsignedByte()
+		writeImage(names.energy, energy.Dedummify())
+	}
 
-	fout, err := os.Create(magImageName)
+	warped := algorithms.WarpBackward(f2, uv)
+	psnr, err := algorithms.PSNR(f1.Dedummify(), warped.Dedummify())
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer fout.Close()
-	magImg.ScaleToUnsignedByte()
-	mag := magImg.Dedummify()
+	fmt.Printf("psnr = %f dB\n", psnr)
+	// images smaller than the window have no ssim but are still solved
+	if ssim, err := algorithms.SSIM(f1.Dedummify(), warped.Dedummify(), ssimWindow); err != nil {
+		log.Print(err)
+	} else {
+		fmt.Printf("ssim = %f\n", ssim)
+	}
+	if names.warp != "" {
+		writeImage(names.warp, warped.Dedummify())
+	}
+
+	if names.residual != "" {
+		residual := algorithms.WarpResidual(f1, f2, uv)
+		for i := range residual.Pix {
+			residual.Pix[i] = 127.5 + residual.Pix[i]/2
+		}
+		writeImage(names.residual, residual.Dedummify())
+	}
 
-	err = pnm.Encode(fout, mag, pnm.PGM)
+	if names.conf != "" {
+		uvBack := algorithms.OpticFlowHornSchunkOptions(f2, f1, opts)
+		mask := algorithms.ConsistencyMask(uv, uvBack, float32(consistency))
+		fmt.Printf("occluded = %.2f%%\n", 100*algorithms.OcclusionFraction(mask))
+		writeImage(names.conf, algorithms.ApplyConfidenceOverlay(dirImg, mask).Dedummify())
+	}
+}
+
+// writeFlowOutputs writes all outputs that only depend on the flow field uv
+// with dummy borders to names, i.e. the CSV export and the magnitude,
+// direction and color images. It returns the scaled magnitude and the
+// direction image
+func writeFlowOutputs(uv *floatimage.FloatImg, names outputs) (magImg, dirImg *floatimage.FloatImg) {
+	if names.csv != "" {
+		fcsv, err := os.Create(names.csv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = algorithms.WriteFlowCSV(fcsv, uv.Dedummify(), csvStep)
+		if err != nil {
+			log.Fatalf("Writing %s: %v", names.csv, err)
+		}
+		if err := fcsv.Close(); err != nil {
+			log.Fatalf("Closing %s: %v", names.csv, err)
+		}
+	}
+
+	if names.color != "" {
+		writeImage(names.color, algorithms.FlowToColor(uv, 0).Dedummify())
+	}
+
+	magImg = algorithms.MagImage(uv)
+	if clip > 0.0 {
+		// only the interior, the zero dummy ring would bias the low percentile
+		low, high := magImg.Dedummify().PercentileRange(0, float32(clip), float32(100.0-clip))
+		magImg.ScaleRangeToUnsignedByte(0, low, high)
+	} else {
+		magImg.ScaleToUnsignedByte()
+	}
+	if mag16 {
+		// the scaled magnitude isn't quantized yet, spread it to 16 bit
+		mag := magImg.Dedummify().Clone()
+		for i := range mag.Pix {
+			mag.Pix[i] *= 257
+		}
+		writeImage16(names.mag, mag)
+	} else {
+		writeImage(names.mag, magImg.Dedummify())
+	}
+	dirImg = algorithms.StandardFlowColor(uv)
+	writeImage(names.dir, dirImg.Dedummify())
+	return
+}
+
+// outputs holds the names of the files written for a pair of images, empty
+// names are skipped
+type outputs struct {
+	mag, dir, color, csv, flo, combined string
+	energy, warp, residual, conf        string
+	tempGrad                            string
+	// snapshots is the prefix of the snapshot images
+	snapshots string
+}
+
+// flagOutputs returns the output names given on the command line
+func flagOutputs() outputs {
+	return outputs{
+		mag:       magImageName,
+		dir:       dirImageName,
+		color:     colorImageName,
+		csv:       csvName,
+		flo:       floOutName,
+		combined:  combinedName,
+		energy:    energyImageName,
+		warp:      warpImageName,
+		residual:  residualImageName,
+		conf:      confImageName,
+		tempGrad:  tempGradName,
+		snapshots: snapshotPrefix,
+	}
+}
+
+// ssimWindow is the window size of the SSIM diagnostic, the standard 11 x 11
+// Gaussian window
+const ssimWindow = 11
+
+// combinedGap is the width of the white gap between the parts of the
+// -combined output
+const combinedGap = 4
+
+// promoteRGB returns img as 3 channel RGB image, single channel gray images
+// are copied to all 3 channels
+func promoteRGB(img *floatimage.FloatImg) *floatimage.FloatImg {
+	if img.Chancnt == 3 {
+		return img
+	}
+	bounds := img.Bounds()
+	rgb := floatimage.NewFloatImg(bounds, 3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g := img.AtF(x, y)[0]
+			out := rgb.AtF(x, y)
+			out[0], out[1], out[2] = g, g, g
+		}
+	}
+	return rgb
+}
+
+// progressPrinter returns an iteration callback printing the progress to
+// stderr, at most every progressInterval and always for the last call. The
+// callback is called every logInterval iterations, 0 meaning every iteration
+func progressPrinter(total, logInterval int) func(iter int, uv *floatimage.FloatImg) {
+	const progressInterval = 250 * time.Millisecond
+	if logInterval < 1 {
+		logInterval = 1
+	}
+	var last time.Time
+	return func(iter int, uv *floatimage.FloatImg) {
+		final := iter+logInterval > total
+		if !final && time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\riteration %d/%d (%3.0f%%)", iter, total, 100*float64(iter)/float64(total))
+		if final {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// parseDeriv returns the derivative kernel called name, an unknown name is
+// fatal
+func parseDeriv(name string) algorithms.DerivMode {
+	switch name {
+	case "central":
+		return algorithms.DerivCentral
+	case "sobel":
+		return algorithms.DerivSobel
+	case "scharr":
+		return algorithms.DerivScharr
+	}
+	log.Fatalf("Unknown derivative kernel %q", name)
+	return algorithms.DerivCentral
+}
+
+// readImage decodes the image file name, any error is fatal
+func readImage(name string) image.Image {
+	fin, err := os.Open(name)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer fin.Close()
 
-	uv.ColorFunc = func(x, y int, d []float32) color.Color {
-		const mult = 100.0
-		g := magImg.AtF(x, y)[0]
-		return color.YCbCr{floatimage.Tu8c(g), floatimage.Tu8c(d[0]*mult + 127.5), floatimage.Tu8c(d[1]*mult + 127.5)}
+	img, _, err := image.Decode(fin)
+	if err != nil {
+		log.Fatalf("Reading %s: %v", name, err)
 	}
+	return img
+}
 
-	uv.ColorModelFunc = func() color.Model {
-		return color.YCbCrModel
+// readFlow reads the .flo file name, any error is fatal
+func readFlow(name string) *floatimage.FloatImg {
+	fin, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer fin.Close()
 
-	fout2, err := os.Create(dirImageName)
+	flow, err := algorithms.ReadFlo(fin)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Reading %s: %v", name, err)
 	}
-	defer fout2.Close()
+	return flow
+}
 
-	err = pnm.Encode(fout2, uv.Dedummify(), pnm.PPM)
+// writeFlow saves the flow field to the .flo file name, any error is fatal
+func writeFlow(name string, flow *floatimage.FloatImg) {
+	fout, err := os.Create(name)
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = algorithms.WriteFlo(fout, flow)
+	if err != nil {
+		log.Fatalf("Writing %s: %v", name, err)
+	}
+	if err := fout.Close(); err != nil {
+		log.Fatalf("Closing %s: %v", name, err)
+	}
+}
+
+// readInitFlow reads the .flo file name and returns its flow with dummy
+// borders for images covering bounds, any error is fatal
+func readInitFlow(name string, bounds image.Rectangle) *floatimage.FloatImg {
+	flow := readFlow(name)
+	if flow.Bounds().Dx() != bounds.Dx() || flow.Bounds().Dy() != bounds.Dy() {
+		log.Fatalf("The initial flow is %dx%d but the images are %dx%d",
+			flow.Bounds().Dx(), flow.Bounds().Dy(), bounds.Dx(), bounds.Dy())
+	}
+	return flow.Reorigin(bounds.Min).AddDummies()
+}
+
+// cropImage returns the part of img inside r
+func cropImage(img image.Image, r image.Rectangle) (image.Image, error) {
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("can't crop images of type %T", img)
+	}
+	return sub.SubImage(r), nil
+}
+
+// cropToCommon crops img1 and img2 to the intersection of their bounds
+func cropToCommon(img1, img2 image.Image) (image.Image, image.Image, error) {
+	common := img1.Bounds().Intersect(img2.Bounds())
+	if common.Empty() {
+		return nil, nil, fmt.Errorf("the images %v and %v don't overlap", img1.Bounds(), img2.Bounds())
+	}
+	crop1, err := cropImage(img1, common)
+	if err != nil {
+		return nil, nil, err
+	}
+	crop2, err := cropImage(img2, common)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crop1, crop2, nil
 }
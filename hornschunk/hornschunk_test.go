@@ -0,0 +1,617 @@
+package main
+
+import (
+	"github.com/niklas88/imgtest/algorithms"
+	"github.com/niklas88/imgtest/floatimage"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv marks the test binary running as the hornschunk tool
+const runMainEnv = "HORNSCHUNK_RUN_MAIN"
+
+// TestRunMain runs main with the arguments after "--" when started by
+// runMain, otherwise it does nothing
+func TestRunMain(t *testing.T) {
+	if os.Getenv(runMainEnv) != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"hornschunk"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+// runMain runs the tool with args in a subprocess and returns its combined
+// output and whether it exited successfully
+func runMain(t *testing.T, args ...string) (string, bool) {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestRunMain$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatalf("running hornschunk: %v", err)
+		}
+	}
+	return string(out), err == nil
+}
+
+// writeTestPNG saves a w x h gray image of a smooth pattern moved by dx to
+// the PNG file name
+func writeTestPNG(t *testing.T, name string, w, h int, dx float64) {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx := float64(x) - dx
+			v := 127.5 + 60*math.Sin(0.4*fx+0.2*float64(y)) + 40*math.Cos(0.3*float64(y)-0.1*fx)
+			img.SetGray(x, y, color.Gray{uint8(v)})
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestPNG decodes the PNG file name
+func readTestPNG(t *testing.T, name string) image.Image {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	return img
+}
+
+func TestCropMatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		w2, h2       int
+		cropMatch    bool
+		ok           bool
+		wantW, wantH int
+	}{
+		{"same size", 24, 20, false, true, 24, 20},
+		{"1px narrower", 23, 20, true, true, 23, 20},
+		{"1px taller", 24, 21, true, true, 24, 20},
+		{"1px larger both", 25, 21, true, true, 24, 20},
+		{"differing without cropmatch", 23, 20, false, false, 0, 0},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		in1, in2 := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+		mag, dir2 := filepath.Join(dir, "mag.png"), filepath.Join(dir, "dir.png")
+		writeTestPNG(t, in1, 24, 20, 0)
+		writeTestPNG(t, in2, tt.w2, tt.h2, 1)
+		args := []string{"-infile1", in1, "-infile2", in2, "-magimg", mag, "-dirimg", dir2, "-iterations", "5"}
+		if tt.cropMatch {
+			args = append(args, "-cropmatch")
+		}
+		out, ok := runMain(t, args...)
+		if ok != tt.ok {
+			t.Errorf("%s: success %v, want %v, output:\n%s", tt.name, ok, tt.ok, out)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for _, name := range []string{mag, dir2} {
+			if size := readTestPNG(t, name).Bounds().Size(); size.X != tt.wantW || size.Y != tt.wantH {
+				t.Errorf("%s: %s is %v, want %dx%d", tt.name, filepath.Base(name), size, tt.wantW, tt.wantH)
+			}
+		}
+	}
+}
+
+func TestCropToCommon(t *testing.T) {
+	tests := []struct {
+		r1, r2, common image.Rectangle
+	}{
+		{image.Rect(0, 0, 10, 8), image.Rect(0, 0, 10, 8), image.Rect(0, 0, 10, 8)},
+		{image.Rect(0, 0, 10, 8), image.Rect(0, 0, 9, 8), image.Rect(0, 0, 9, 8)},
+		{image.Rect(0, 0, 10, 8), image.Rect(1, 1, 12, 9), image.Rect(1, 1, 10, 8)},
+	}
+	for _, tt := range tests {
+		crop1, crop2, err := cropToCommon(image.NewGray(tt.r1), image.NewGray(tt.r2))
+		if err != nil {
+			t.Errorf("%v and %v: %v", tt.r1, tt.r2, err)
+			continue
+		}
+		if crop1.Bounds() != tt.common || crop2.Bounds() != tt.common {
+			t.Errorf("%v and %v: cropped to %v and %v, want %v", tt.r1, tt.r2, crop1.Bounds(), crop2.Bounds(), tt.common)
+		}
+	}
+	if _, _, err := cropToCommon(image.NewGray(image.Rect(0, 0, 4, 4)), image.NewGray(image.Rect(4, 4, 8, 8))); err == nil {
+		t.Error("no error for disjoint images")
+	}
+}
+
+// writeTestFlo saves a constant w x h flow field (u, v) to the .flo file name
+func writeTestFlo(t *testing.T, name string, w, h int, u, v float32) {
+	flow := floatimage.NewFloatImg(image.Rect(0, 0, w, h), 2)
+	for i := 0; i < len(flow.Pix); i += 2 {
+		flow.Pix[i], flow.Pix[i+1] = u, v
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := algorithms.WriteFlo(f, flow); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFlo reads the .flo file name
+func readTestFlo(t *testing.T, name string) *floatimage.FloatImg {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	flow, err := algorithms.ReadFlo(f)
+	if err != nil {
+		t.Fatalf("reading %s: %v", name, err)
+	}
+	return flow
+}
+
+// meanU is the mean of channel 0 of flow
+func meanU(flow *floatimage.FloatImg) float64 {
+	var sum float64
+	for i := 0; i < len(flow.Pix); i += 2 {
+		sum += float64(flow.Pix[i])
+	}
+	return sum / float64(len(flow.Pix)/2)
+}
+
+func TestInitFlow(t *testing.T) {
+	dir := t.TempDir()
+	in1, in2 := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+	writeTestPNG(t, in1, 24, 20, 0)
+	writeTestPNG(t, in2, 24, 20, 1)
+	tests := []struct {
+		name         string
+		initW, initH int
+		ok           bool
+	}{
+		{"zero init", 0, 0, true},
+		{"true flow init", 24, 20, true},
+		{"wrong width", 23, 20, false},
+		{"wrong height", 24, 21, false},
+	}
+	means := make(map[string]float64)
+	for _, tt := range tests {
+		out := filepath.Join(dir, tt.name+".flo")
+		args := []string{"-infile1", in1, "-infile2", in2, "-iterations", "1",
+			"-magimg", filepath.Join(dir, "mag.png"), "-dirimg", filepath.Join(dir, "dir.png"), "-floout", out}
+		if tt.initW > 0 {
+			init := filepath.Join(dir, tt.name+".init.flo")
+			writeTestFlo(t, init, tt.initW, tt.initH, 1, 0)
+			args = append(args, "-initflow", init)
+		}
+		output, ok := runMain(t, args...)
+		if ok != tt.ok {
+			t.Errorf("%s: success %v, want %v, output:\n%s", tt.name, ok, tt.ok, output)
+			continue
+		}
+		if !ok {
+			if !strings.Contains(output, "The initial flow is") {
+				t.Errorf("%s: unclear error:\n%s", tt.name, output)
+			}
+			continue
+		}
+		means[tt.name] = meanU(readTestFlo(t, out))
+	}
+	// after a single iteration the zero initialized flow is still far from the
+	// true flow (1, 0) while the seeded one stays close to it
+	zero, seeded := means["zero init"], means["true flow init"]
+	if zero > 0.5 || seeded < 0.8 {
+		t.Errorf("mean u %f with zero init, %f with true flow init", zero, seeded)
+	}
+}
+
+func TestAnalyseMasked(t *testing.T) {
+	// interior 8 x 4 with the left half 10, 20, 10, 20, ... and the right
+	// half 100, the dummy border is -1000
+	img := floatimage.NewFloatImg(image.Rect(0, 0, 10, 6), 1)
+	for i := range img.Pix {
+		img.Pix[i] = -1000
+	}
+	for y := 1; y < 5; y++ {
+		for x := 1; x < 9; x++ {
+			v := float32(100)
+			if x < 5 {
+				v = float32(10 + 10*((x+y)%2))
+			}
+			img.Set(x, y, 0, v)
+		}
+	}
+	tests := []struct {
+		name                     string
+		valid                    func(x, y int) bool
+		min, max, mean, variance float32
+	}{
+		{"left half", func(x, y int) bool { return x < 5 }, 10, 20, 15, 25},
+		{"right half", func(x, y int) bool { return x >= 5 }, 100, 100, 100, 0},
+		{"all", func(x, y int) bool { return true }, 10, 100, 57.5, 1818.75},
+		{"none", func(x, y int) bool { return false }, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		mask := floatimage.NewFloatImg(img.Bounds(), 1)
+		for y := 0; y < 6; y++ {
+			for x := 0; x < 10; x++ {
+				if tt.valid(x, y) {
+					mask.Set(x, y, 0, 1)
+				}
+			}
+		}
+		min, max, mean, variance := analyseMasked(img, mask)
+		if min != tt.min || max != tt.max || mean != tt.mean || variance != tt.variance {
+			t.Errorf("%s: got %f, %f, %f, %f, want %f, %f, %f, %f", tt.name,
+				min, max, mean, variance, tt.min, tt.max, tt.mean, tt.variance)
+		}
+	}
+
+	// with a full mask it agrees with analyse
+	mask := floatimage.NewFloatImg(img.Bounds(), 1)
+	for i := range mask.Pix {
+		mask.Pix[i] = 1
+	}
+	min, max, mean, variance := analyseMasked(img, mask)
+	wMin, wMax, wMean, wVariance := analyse(img)
+	if min != wMin || max != wMax || mean != wMean || variance != wVariance {
+		t.Errorf("full mask: got %f, %f, %f, %f, analyse %f, %f, %f, %f",
+			min, max, mean, variance, wMin, wMax, wMean, wVariance)
+	}
+}
+
+func TestVisOnly(t *testing.T) {
+	dir := t.TempDir()
+	// u grows to the right so the magnitude image is a horizontal ramp
+	flow := floatimage.NewFloatImg(image.Rect(0, 0, 12, 8), 2)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			vec := flow.AtF(x, y)
+			vec[0], vec[1] = float32(x), -1
+		}
+	}
+	in := filepath.Join(dir, "in.flo")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := algorithms.WriteFlo(f, flow); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name string
+		flo  string
+		ok   bool
+	}{
+		{"known flow", in, true},
+		{"missing flow", filepath.Join(dir, "missing.flo"), false},
+	}
+	for _, tt := range tests {
+		mag, dirImg, colorImg := filepath.Join(dir, tt.name+".mag.png"), filepath.Join(dir, tt.name+".dir.png"), filepath.Join(dir, tt.name+".color.png")
+		// the input images don't exist, the solver must not run
+		out, ok := runMain(t, "-visonly", tt.flo, "-infile1", filepath.Join(dir, "none1.png"), "-infile2", filepath.Join(dir, "none2.png"),
+			"-magimg", mag, "-dirimg", dirImg, "-colorimg", colorImg)
+		if ok != tt.ok {
+			t.Errorf("%s: success %v, want %v, output:\n%s", tt.name, ok, tt.ok, out)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		for _, name := range []string{mag, dirImg, colorImg} {
+			if size := readTestPNG(t, name).Bounds().Size(); size != flow.Bounds().Size() {
+				t.Errorf("%s: %s is %v, want %v", tt.name, filepath.Base(name), size, flow.Bounds().Size())
+			}
+		}
+
+		magPNG := readTestPNG(t, mag)
+		for x := 1; x < 12; x++ {
+			left, _, _, _ := magPNG.At(x-1, 3).RGBA()
+			right, _, _, _ := magPNG.At(x, 3).RGBA()
+			if right <= left {
+				t.Errorf("%s: magnitude %d at x = %d not above %d at x = %d", tt.name, right, x, left, x-1)
+			}
+		}
+
+		want := algorithms.StandardFlowColor(flow.AddDummies()).Dedummify()
+		dirPNG := readTestPNG(t, dirImg)
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 12; x++ {
+				r, g, b, _ := dirPNG.At(x, y).RGBA()
+				for c, got := range []uint32{r >> 8, g >> 8, b >> 8} {
+					if d := float32(got) - want.AtF(x, y)[c]; d > 1 || d < -1 {
+						t.Errorf("%s: direction channel %d at (%d, %d) is %d, want %f", tt.name, c, x, y, got, want.AtF(x, y)[c])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestAnalyseSubImage(t *testing.T) {
+	img := floatimage.NewFloatImg(image.Rect(0, 0, 12, 10), 1)
+	for i := range img.Pix {
+		img.Pix[i] = float32((i*37)%101) - 20
+	}
+	for _, r := range []image.Rectangle{
+		image.Rect(3, 2, 9, 7),
+		image.Rect(1, 4, 12, 10),
+		image.Rect(0, 0, 5, 5),
+	} {
+		sub := img.SubImage(r)
+		alone := floatimage.NewFloatImg(image.Rect(0, 0, r.Dx(), r.Dy()), 1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				alone.Set(x-r.Min.X, y-r.Min.Y, 0, sub.AtF(x, y)[0])
+			}
+		}
+		min, max, mean, variance := analyse(sub)
+		wantMin, wantMax, wantMean, wantVariance := analyse(alone)
+		if min != wantMin || max != wantMax || mean != wantMean || variance != wantVariance {
+			t.Errorf("%v: analyse gives %f %f %f %f, standalone %f %f %f %f", r,
+				min, max, mean, variance, wantMin, wantMax, wantMean, wantVariance)
+		}
+		// Pix[0] of the sub image is its dummy corner, an interior value
+		// that is below all others must still be found
+		sub.Set(r.Min.X+2, r.Min.Y+2, 0, -1000)
+		if min, _, _, _ := analyse(sub); min != -1000 {
+			t.Errorf("%v: minimum %f, want -1000", r, min)
+		}
+	}
+}
+
+func TestAnalyseLarge(t *testing.T) {
+	// a 2048 x 2048 checkerboard of 1000 ± 0.1 with dummy border, summing
+	// the squared deviations of about 0.01 in float32 drifts far off
+	const n = 2048
+	img := floatimage.NewFloatImg(image.Rect(0, 0, n+2, n+2), 1)
+	hi, lo := float32(1000.1), float32(999.9)
+	for y := 1; y <= n; y++ {
+		for x := 1; x <= n; x++ {
+			v := lo
+			if (x+y)%2 == 0 {
+				v = hi
+			}
+			img.Set(x, y, 0, v)
+		}
+	}
+	wantMean := (float64(hi) + float64(lo)) / 2
+	dev := float64(hi) - wantMean
+	wantVariance := dev * dev
+
+	var naive float32
+	for y := 1; y <= n; y++ {
+		for x := 1; x <= n; x++ {
+			d := img.AtF(x, y)[0] - float32(wantMean)
+			naive += d * d
+		}
+	}
+	if naive32 := float64(naive) / (n * n); math.Abs(naive32-wantVariance) < 0.01*wantVariance {
+		t.Fatalf("float32 variance %g is close to %g, the test doesn't show any drift", naive32, wantVariance)
+	}
+
+	min, max, mean, variance := analyse(img)
+	if min != lo || max != hi {
+		t.Errorf("range %f to %f, want %f to %f", min, max, lo, hi)
+	}
+	if math.Abs(float64(mean)-wantMean) > 1e-4 {
+		t.Errorf("mean %f, want %f", mean, wantMean)
+	}
+	if math.Abs(float64(variance)-wantVariance) > 1e-4*wantVariance {
+		t.Errorf("variance %g, want %g", variance, wantVariance)
+	}
+}
+
+func TestResidualImage(t *testing.T) {
+	dir := t.TempDir()
+	in1, in2 := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+	writeTestPNG(t, in1, 24, 20, 0)
+	tests := []struct {
+		name string
+		dx   float64
+		// the range of the mean distance of the residual image from the
+		// zero residual gray level 127.5
+		min, max float64
+	}{
+		{"identical", 0, 0, 1},
+		{"moving", 3, 2, 255},
+	}
+	for _, tt := range tests {
+		writeTestPNG(t, in2, 24, 20, tt.dx)
+		residual := filepath.Join(dir, tt.name+".residual.png")
+		// no iterations keeps the flow at zero
+		out, ok := runMain(t, "-infile1", in1, "-infile2", in2, "-iterations", "0",
+			"-magimg", filepath.Join(dir, "mag.png"), "-dirimg", filepath.Join(dir, "dir.png"), "-residualimg", residual)
+		if !ok {
+			t.Fatalf("%s: failed:\n%s", tt.name, out)
+		}
+		img := readTestPNG(t, residual)
+		if size := img.Bounds().Size(); size != (image.Point{24, 20}) {
+			t.Fatalf("%s: residual image is %v, want 24x20", tt.name, size)
+		}
+		var sum float64
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 24; x++ {
+				g := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+				sum += math.Abs(float64(g) - 127.5)
+			}
+		}
+		if mean := sum / (24 * 20); mean < tt.min || mean > tt.max {
+			t.Errorf("%s: mean distance %f from 127.5, want %f to %f", tt.name, mean, tt.min, tt.max)
+		}
+	}
+}
+
+func TestFloOut(t *testing.T) {
+	dir := t.TempDir()
+	in1 := filepath.Join(dir, "1.png")
+	writeTestPNG(t, in1, 26, 18, 0)
+	tests := []struct {
+		name         string
+		dx           float64
+		minU, maxU   float64
+		iterationArg string
+	}{
+		{"static", 0, 0, 0, "50"},
+		{"no iterations", 1, 0, 0, "0"},
+		{"right", 1, 0.3, 2, "50"},
+		// the raw signed flow is saved, not its magnitude
+		{"left", -1, -2, -0.3, "50"},
+	}
+	for _, tt := range tests {
+		in2 := filepath.Join(dir, tt.name+".png")
+		writeTestPNG(t, in2, 26, 18, tt.dx)
+		out := filepath.Join(dir, tt.name+".flo")
+		output, ok := runMain(t, "-infile1", in1, "-infile2", in2, "-iterations", tt.iterationArg,
+			"-magimg", filepath.Join(dir, "mag.png"), "-dirimg", filepath.Join(dir, "dir.png"), "-floout", out)
+		if !ok {
+			t.Errorf("%s: failed:\n%s", tt.name, output)
+			continue
+		}
+		flow := readTestFlo(t, out)
+		if !flow.Bounds().Eq(image.Rect(0, 0, 26, 18)) || flow.Chancnt != 2 {
+			t.Errorf("%s: flow has bounds %v and %d channels, want 26x18 with 2", tt.name, flow.Bounds(), flow.Chancnt)
+			continue
+		}
+		for _, v := range flow.Pix {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				t.Errorf("%s: flow holds %f", tt.name, v)
+				break
+			}
+		}
+		if u := meanU(flow); u < tt.minU || u > tt.maxU {
+			t.Errorf("%s: mean u %f, want in [%f, %f]", tt.name, u, tt.minU, tt.maxU)
+		}
+	}
+}
+
+func TestTempGrad(t *testing.T) {
+	dir := t.TempDir()
+	in1, in2 := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+	writeTestPNG(t, in1, 24, 20, 0)
+	tests := []struct {
+		name string
+		dx   float64
+		// the range of the brightest pixel of the difference image
+		min, max uint8
+	}{
+		{"identical", 0, 0, 0},
+		{"moving", 3, 20, 255},
+	}
+	for _, tt := range tests {
+		writeTestPNG(t, in2, 24, 20, tt.dx)
+		tempGrad := filepath.Join(dir, tt.name+".tempgrad.png")
+		out, ok := runMain(t, "-infile1", in1, "-infile2", in2, "-iterations", "0",
+			"-magimg", filepath.Join(dir, "mag.png"), "-dirimg", filepath.Join(dir, "dir.png"), "-tempgrad", tempGrad)
+		if !ok {
+			t.Fatalf("%s: failed:\n%s", tt.name, out)
+		}
+		img := readTestPNG(t, tempGrad)
+		if size := img.Bounds().Size(); size != (image.Point{24, 20}) {
+			t.Fatalf("%s: difference image is %v, want 24x20", tt.name, size)
+		}
+		var brightest uint8
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 24; x++ {
+				if g := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y; g > brightest {
+					brightest = g
+				}
+			}
+		}
+		if brightest < tt.min || brightest > tt.max {
+			t.Errorf("%s: brightest difference %d, want %d to %d", tt.name, brightest, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCombined(t *testing.T) {
+	dir := t.TempDir()
+	in1, in2 := filepath.Join(dir, "1.png"), filepath.Join(dir, "2.png")
+	combined := filepath.Join(dir, "combined.png")
+	tests := []struct{ w, h int }{{24, 20}, {17, 9}}
+	for _, tt := range tests {
+		writeTestPNG(t, in1, tt.w, tt.h, 0)
+		writeTestPNG(t, in2, tt.w, tt.h, 1)
+		out, ok := runMain(t, "-infile1", in1, "-infile2", in2, "-iterations", "5",
+			"-magimg", filepath.Join(dir, "mag.png"), "-dirimg", filepath.Join(dir, "dir.png"), "-combined", combined)
+		if !ok {
+			t.Fatalf("%dx%d: failed:\n%s", tt.w, tt.h, out)
+		}
+		img := readTestPNG(t, combined)
+		// three parts separated by two gaps
+		want := image.Point{3*tt.w + 2*combinedGap, tt.h}
+		if size := img.Bounds().Size(); size != want {
+			t.Fatalf("%dx%d: combined image is %v, want %v", tt.w, tt.h, size, want)
+		}
+		src := readTestPNG(t, in1)
+		for y := 0; y < tt.h; y++ {
+			// the first part is the source frame in gray
+			for x := 0; x < tt.w; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				sr, _, _, _ := src.At(x, y).RGBA()
+				if r>>8 != sr>>8 || g != r || b != r {
+					t.Errorf("%dx%d: pixel (%d, %d) is (%d, %d, %d), want gray %d", tt.w, tt.h, x, y, r>>8, g>>8, b>>8, sr>>8)
+				}
+			}
+			// the gaps are white
+			for _, x0 := range []int{tt.w, 2*tt.w + combinedGap} {
+				for x := x0; x < x0+combinedGap; x++ {
+					if r, g, b, _ := img.At(x, y).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+						t.Errorf("%dx%d: gap pixel (%d, %d) is (%d, %d, %d)", tt.w, tt.h, x, y, r>>8, g>>8, b>>8)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPromoteRGB(t *testing.T) {
+	gray := floatimage.NewFloatImg(image.Rect(-1, 2, 2, 4), 1)
+	for i := range gray.Pix {
+		gray.Pix[i] = float32(10 * i)
+	}
+	rgb := promoteRGB(gray)
+	if rgb.Chancnt != 3 || rgb.Bounds() != gray.Bounds() {
+		t.Fatalf("promoted image has %d channels and bounds %v", rgb.Chancnt, rgb.Bounds())
+	}
+	for y := 2; y < 4; y++ {
+		for x := -1; x < 2; x++ {
+			g := gray.AtF(x, y)[0]
+			if c := rgb.AtF(x, y); c[0] != g || c[1] != g || c[2] != g {
+				t.Errorf("pixel (%d, %d) is %v, want gray %f", x, y, c, g)
+			}
+		}
+	}
+	rgbImg := floatimage.NewFloatImg(image.Rect(0, 0, 2, 2), 3)
+	if promoteRGB(rgbImg) != rgbImg {
+		t.Error("3 channel image was copied")
+	}
+}